@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/penguin-statistics/probe/internal/app/repository"
+	"github.com/penguin-statistics/probe/internal/app/service"
+)
+
+var exportOpts struct {
+	table  string
+	format string
+	since  string
+	until  string
+	output string
+}
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export rows of a table created within a time range",
+	Example: `  probe export --table impressions --since 24h
+  probe export --table bonjours --since 2024-01-01 --until 2024-02-01 --format jsonl -o bonjours.jsonl`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		now := time.Now()
+		since, err := parseTime(exportOpts.since, now)
+		if err != nil {
+			return fmt.Errorf("--since: %w", err)
+		}
+		until, err := parseTime(exportOpts.until, now)
+		if err != nil {
+			return fmt.Errorf("--until: %w", err)
+		}
+
+		r, err := repository.NewProbe(conf)
+		if err != nil {
+			return err
+		}
+		defer r.DB.Close()
+
+		var w io.Writer = cmd.OutOrStdout()
+		if exportOpts.output != "" && exportOpts.output != "-" {
+			f, err := os.Create(exportOpts.output)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			w = f
+		}
+
+		n, err := service.NewExport(r).Export(cmd.Context(), w, exportOpts.table, exportOpts.format, since, until)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(cmd.ErrOrStderr(), "exported", n, "rows")
+		return nil
+	},
+}
+
+func init() {
+	flags := exportCmd.Flags()
+	flags.StringVarP(&exportOpts.table, "table", "t", "", fmt.Sprintf("table to export, one of %v", service.ExportTables))
+	flags.StringVarP(&exportOpts.format, "format", "f", "csv", fmt.Sprintf("output format, one of %v", service.ExportFormats))
+	flags.StringVar(&exportOpts.since, "since", "24h", "start of the range, inclusive. a date, an RFC 3339 time or a duration before now")
+	flags.StringVar(&exportOpts.until, "until", "0s", "end of the range, exclusive. a date, an RFC 3339 time or a duration before now")
+	flags.StringVarP(&exportOpts.output, "output", "o", "-", "file to write to, - for stdout")
+	exportCmd.MarkFlagRequired("table")
+	rootCmd.AddCommand(exportCmd)
+}
+
+// parseTime parses value as a date, an RFC 3339 time or a duration before now
+func parseTime(value string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q: shall be a date, an RFC 3339 time or a duration", value)
+}
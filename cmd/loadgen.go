@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/penguin-statistics/probe/internal/app/loadgen"
+)
+
+var loadgenOpts struct {
+	scenario string
+	json     string
+	// overrides of the scenario, applied only when set
+	overrides loadgen.Scenario
+}
+
+var loadgenCmd = &cobra.Command{
+	Use:   "loadgen",
+	Short: "Generate load against a probe server as described by a scenario",
+	Example: `  probe loadgen --connections 100 --duration 30s
+  probe loadgen --scenario loadgen.example.yml --json report.json`,
+	Args:              cobra.NoArgs,
+	PersistentPreRunE: skipConfig,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s := loadgen.DefaultScenario()
+		if loadgenOpts.scenario != "" {
+			var err error
+			if s, err = loadgen.LoadScenario(loadgenOpts.scenario); err != nil {
+				return err
+			}
+		}
+		flags, o := cmd.Flags(), loadgenOpts.overrides
+		if flags.Changed("endpoint") {
+			s.Endpoint = o.Endpoint
+		}
+		if flags.Changed("duration") {
+			s.Duration = o.Duration
+		}
+		if flags.Changed("connections") {
+			s.Connections = o.Connections
+		}
+		if flags.Changed("ramp") {
+			s.Ramp = o.Ramp
+		}
+		if flags.Changed("rps") {
+			s.RPS = o.RPS
+		}
+
+		fmt.Fprintln(cmd.ErrOrStderr(), "ramping up", s.Connections, "connections against", s.Endpoint, "over", s.Ramp, "for", s.Duration)
+		report, err := loadgen.Run(cmd.Context(), s)
+		if err != nil {
+			return err
+		}
+		if err := report.WriteSummary(cmd.OutOrStdout()); err != nil {
+			return err
+		}
+		if loadgenOpts.json == "" {
+			return nil
+		}
+
+		var w io.Writer = cmd.OutOrStdout()
+		if loadgenOpts.json != "-" {
+			f, err := os.Create(loadgenOpts.json)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			w = f
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	},
+}
+
+func init() {
+	d := loadgen.DefaultScenario()
+	flags := loadgenCmd.Flags()
+	flags.StringVarP(&loadgenOpts.scenario, "scenario", "s", "", "YAML file describing the scenario, see loadgen.example.yml")
+	flags.StringVar(&loadgenOpts.json, "json", "", "file to write the report to as JSON, - for stdout")
+	flags.StringVar(&loadgenOpts.overrides.Endpoint, "endpoint", d.Endpoint, "websocket url of the probe server")
+	flags.DurationVar(&loadgenOpts.overrides.Duration, "duration", d.Duration, "length of the run")
+	flags.IntVar(&loadgenOpts.overrides.Connections, "connections", d.Connections, "amount of concurrent connections")
+	flags.DurationVar(&loadgenOpts.overrides.Ramp, "ramp", d.Ramp, "time to open the connections over")
+	flags.Float64Var(&loadgenOpts.overrides.RPS, "rps", d.RPS, "messages sent per second across all connections")
+	rootCmd.AddCommand(loadgenCmd)
+}
@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/penguin-statistics/probe/internal/app/repository"
+)
+
+var migrateDryRun bool
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Create the database and apply pending schema migrations",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		applied, err := repository.Migrate(cmd.Context(), conf, migrateDryRun)
+		verb := "applied"
+		if migrateDryRun {
+			verb = "pending"
+		}
+		for _, m := range applied {
+			fmt.Fprintf(cmd.OutOrStdout(), "%s %04d_%s\n", verb, m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Fprintln(cmd.OutOrStdout(), "schema is up to date")
+		}
+		return nil
+	},
+}
+
+func init() {
+	migrateCmd.Flags().BoolVar(&migrateDryRun, "dry-run", false, "list pending migrations without applying them")
+	rootCmd.AddCommand(migrateCmd)
+}
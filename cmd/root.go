@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	_ "github.com/joho/godotenv/autoload"
+	"github.com/spf13/cobra"
+
+	"github.com/penguin-statistics/probe/internal/app/config"
+)
+
+var (
+	configFile string
+	conf       *config.Config
+)
+
+var rootCmd = &cobra.Command{
+	Use:   "probe",
+	Short: "probe counts visits of Penguin Statistics without tracking its users",
+	Long: `probe counts visits of Penguin Statistics without tracking its users.
+
+Running probe without a command starts the server, same as "probe serve".`,
+	Args:              cobra.NoArgs,
+	SilenceUsage:      true,
+	PersistentPreRunE: loadConfig,
+	RunE:              runServe,
+}
+
+func init() {
+	rootCmd.CompletionOptions.DisableDefaultCmd = true
+	rootCmd.PersistentFlags().StringVarP(&configFile, "config", "c", "", "config file to read. config.yml in the working directory is read if present by default")
+}
+
+// loadConfig loads the config for commands which require it
+func loadConfig(cmd *cobra.Command, args []string) error {
+	var err error
+	conf, err = config.Load(configFile)
+	return err
+}
+
+// skipConfig is used by commands which do not require the config
+func skipConfig(cmd *cobra.Command, args []string) error {
+	return nil
+}
+
+// Bootstrap executes the command line
+func Bootstrap() {
+	// commands other than serve, which drains on its own, are cancelled on interrupt or termination
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := rootCmd.ExecuteContext(ctx); err != nil {
+		stop()
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	_ "net/http/pprof"
+
+	"github.com/spf13/cobra"
+
+	"github.com/penguin-statistics/probe/internal/app/server"
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Start the server",
+	Args:  cobra.NoArgs,
+	RunE:  runServe,
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+}
+
+func runServe(cmd *cobra.Command, args []string) error {
+	if conf.App.Pprof {
+		go func() {
+			fmt.Println("pprof enabled on localhost:8120")
+			http.ListenAndServe("localhost:8120", nil)
+		}()
+	}
+
+	return server.Bootstrap(conf)
+}
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/penguin-statistics/probe/internal/app/repository"
+	"github.com/penguin-statistics/probe/internal/app/service"
+)
+
+var statsOpts struct {
+	since string
+	top   int
+}
+
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Print quick statistics of the traffic recorded",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		since, err := parseTime(statsOpts.since, time.Now())
+		if err != nil {
+			return fmt.Errorf("--since: %w", err)
+		}
+
+		r, err := repository.NewProbe(conf)
+		if err != nil {
+			return err
+		}
+		defer r.DB.Close()
+
+		stats, err := service.NewStats(r).Summary(cmd.Context(), since, statsOpts.top)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+		fmt.Fprintf(w, "users in total\t%d\n", stats.Users)
+		fmt.Fprintf(w, "impressions since %s\t%d\n", stats.Since.Format(time.RFC3339), stats.Impressions)
+		fmt.Fprintln(w, "\nplatform\tclassification\tbonjours")
+		for _, c := range stats.Bonjours {
+			fmt.Fprintf(w, "%s\t%s\t%d\n", c.Platform, c.Classification, c.Count)
+		}
+		fmt.Fprintln(w, "\npath\timpressions")
+		for _, c := range stats.TopPaths {
+			fmt.Fprintf(w, "%s\t%d\n", c.Path, c.Count)
+		}
+		return w.Flush()
+	},
+}
+
+func init() {
+	statsCmd.Flags().StringVar(&statsOpts.since, "since", "24h", "start of the range. a date, an RFC 3339 time or a duration before now")
+	statsCmd.Flags().IntVar(&statsOpts.top, "top", 10, "amount of top paths to list")
+	rootCmd.AddCommand(statsCmd)
+}
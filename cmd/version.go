@@ -0,0 +1,23 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/penguin-statistics/probe/internal/pkg/version"
+)
+
+var versionCmd = &cobra.Command{
+	Use:               "version",
+	Short:             "Print the build information",
+	Args:              cobra.NoArgs,
+	PersistentPreRunE: skipConfig,
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Fprintln(cmd.OutOrStdout(), version.String())
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(versionCmd)
+}
@@ -0,0 +1,511 @@
+// Package config loads the configuration of probe from a config file and the environment
+package config
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	"github.com/penguin-statistics/probe/internal/pkg/logger"
+)
+
+// EnvPrefix is the prefix of environment variables overriding config keys, e.g. PENGUINPROBE_HTTP_SERVER
+const EnvPrefix = "penguinprobe"
+
+// Environments origins are allowed in
+const (
+	EnvironmentProduction  = "production"
+	EnvironmentStaging     = "staging"
+	EnvironmentDevelopment = "development"
+)
+
+// Environments are the environments origins can be allowed in
+var Environments = []string{EnvironmentProduction, EnvironmentStaging, EnvironmentDevelopment}
+
+// redacted replaces secrets in the output of Redacted
+const redacted = "<redacted>"
+
+var log = logger.New("config")
+
+// Config is the configuration of probe
+type Config struct {
+	HTTP       HTTP       `yaml:"http"`
+	Proxy      Proxy      `yaml:"proxy"`
+	App        App        `yaml:"app"`
+	ClickHouse ClickHouse `yaml:"clickhouse"`
+	Log        Log        `yaml:"log"`
+	Metrics    Metrics    `yaml:"metrics"`
+	Admin      Admin      `yaml:"admin"`
+	Origins    Origins    `yaml:"origins"`
+	Session    Session    `yaml:"session"`
+	Bot        Bot        `yaml:"bot"`
+	Limits     Limits     `yaml:"limits"`
+	Cluster    Cluster    `yaml:"cluster"`
+	Shutdown   Shutdown   `yaml:"shutdown"`
+	Tracing    Tracing    `yaml:"tracing"`
+	Privacy    Privacy    `yaml:"privacy"`
+	Search     Search     `yaml:"search"`
+	GeoIP      GeoIP      `yaml:"geoip"`
+	Sites      []Site     `yaml:"sites"`
+}
+
+// HTTP configures the http server
+type HTTP struct {
+	// Server is the address to listen on
+	Server string `yaml:"server"`
+}
+
+// Proxy configures how client addresses are resolved behind proxies, e.g. CDNs and load balancers
+type Proxy struct {
+	// Trusted are the CIDRs, or addresses, of the proxies trusted to report client addresses
+	Trusted []string `yaml:"trusted"`
+	// Header is the header trusted proxies report client addresses in: one of none, x-forwarded-for and x-real-ip
+	Header string `yaml:"header"`
+	// ProxyProtocol reads PROXY protocol v1 and v2 headers from the connections of trusted proxies
+	ProxyProtocol bool `yaml:"proxyProtocol"`
+	// ProxyProtocolTimeout is the time to wait for PROXY protocol headers for
+	ProxyProtocolTimeout time.Duration `yaml:"proxyProtocolTimeout"`
+}
+
+// App configures development features
+type App struct {
+	Debug bool `yaml:"debug"`
+	Pprof bool `yaml:"pprof"`
+}
+
+// ClickHouse configures the storage
+type ClickHouse struct {
+	Addr     []string `yaml:"addr"`
+	Database string   `yaml:"database"`
+	User     string   `yaml:"user"`
+	Password string   `yaml:"password"`
+}
+
+// Log configures logging. Reloadable.
+type Log struct {
+	// Level is one of trace, debug, info, warn and error
+	Level string `yaml:"level"`
+	// Format is either text or json
+	Format string `yaml:"format"`
+	// Modules overrides Level per module, e.g. wspool: debug
+	Modules map[string]string `yaml:"modules"`
+	// Sampling limits high-volume lines, e.g. of invalid messages
+	Sampling LogSampling `yaml:"sampling"`
+}
+
+// LogSampling logs only the first Burst lines of a kind within every Interval. A Burst of zero disables sampling.
+type LogSampling struct {
+	Burst    int           `yaml:"burst"`
+	Interval time.Duration `yaml:"interval"`
+}
+
+// Metrics configures the prometheus endpoint
+type Metrics struct {
+	Enabled bool   `yaml:"enabled"`
+	Path    string `yaml:"path"`
+}
+
+// Admin configures the admin endpoints, i.e. POST /broadcast and GET /sources
+type Admin struct {
+	// Token is the bearer token admin requests shall carry. Admin endpoints are disabled if empty.
+	Token string `yaml:"token"`
+}
+
+// Origins configures the origins allowed to connect, by CORS and websocket upgrades alike. Origins are rules in the
+// form of scheme://host[:port], whose host may be * or start with *. for subdomains, and whose port may be *. Reloadable.
+type Origins struct {
+	// AllowAll allows any origin, e.g. for local development
+	AllowAll bool `yaml:"allowAll"`
+	// Environment is the environment whose origins are allowed in addition to Allowed and Apps: one of production,
+	// staging and development
+	Environment string `yaml:"environment"`
+	// Allowed are the origins allowed in every environment
+	Allowed []string `yaml:"allowed"`
+	// Staging and Development are the origins allowed in the staging and development environments only
+	Staging     []string `yaml:"staging"`
+	Development []string `yaml:"development"`
+	// Apps are the origins of the mobile apps, which are not those of browsers, e.g. capacitor://localhost
+	Apps []string `yaml:"apps"`
+	// AllowMissing allows requests without an Origin header, i.e. of clients other than browsers
+	AllowMissing bool `yaml:"allowMissing"`
+	// Domains are registrable domains whose https origins, including of subdomains, are allowed.
+	// Deprecated: use Allowed instead.
+	Domains []string `yaml:"domains"`
+}
+
+// Session configures session resumption
+type Session struct {
+	Secret string `yaml:"secret"`
+	// ResumeWindow is the time a disconnected session may be resumed within, on the instance which held it only
+	ResumeWindow time.Duration `yaml:"resumeWindow"`
+}
+
+// Bot configures bot detection
+type Bot struct {
+	RulesFile string `yaml:"rulesFile"`
+}
+
+// Limits configures connection and message limits. Reloadable.
+type Limits struct {
+	MaxConnectionsPerIP     int           `yaml:"maxConnectionsPerIP"`
+	MaxConnectionsPerUID    int           `yaml:"maxConnectionsPerUID"`
+	IPv6PrefixLen           int           `yaml:"ipv6PrefixLen"`
+	ConnectionRate          float64       `yaml:"connectionRate"`
+	ConnectionBurst         int           `yaml:"connectionBurst"`
+	InvalidMessageThreshold float64       `yaml:"invalidMessageThreshold"`
+	InvalidMessageHalfLife  time.Duration `yaml:"invalidMessageHalfLife"`
+	MessageRate             float64       `yaml:"messageRate"`
+	MessageBurst            int           `yaml:"messageBurst"`
+	ThrottleThreshold       float64       `yaml:"throttleThreshold"`
+	ThrottleHalfLife        time.Duration `yaml:"throttleHalfLife"`
+}
+
+// Cluster configures the coordination with other instances
+type Cluster struct {
+	Node     string        `yaml:"node"`
+	Peers    []string      `yaml:"peers"`
+	Secret   string        `yaml:"secret"`
+	Interval time.Duration `yaml:"interval"`
+}
+
+// Shutdown configures the drain on shutdown
+type Shutdown struct {
+	Timeout        time.Duration `yaml:"timeout"`
+	ReadinessDelay time.Duration `yaml:"readinessDelay"`
+	Spread         time.Duration `yaml:"spread"`
+	// WriteTimeout bounds the wait for pending writes of disconnected clients, apart from Timeout, which may have been
+	// spent on evicting clients by then
+	WriteTimeout time.Duration `yaml:"writeTimeout"`
+}
+
+// Tracing configures the export of OpenTelemetry spans
+type Tracing struct {
+	// Exporter is one of none, otlp and stdout
+	Exporter string `yaml:"exporter"`
+	// Endpoint is the host:port of the OTLP/HTTP collector. Empty uses the OTEL_EXPORTER_OTLP_* environment variables.
+	Endpoint string            `yaml:"endpoint"`
+	Insecure bool              `yaml:"insecure"`
+	Headers  map[string]string `yaml:"headers"`
+	// File is the file the stdout exporter appends spans to. Empty writes to stdout.
+	File string `yaml:"file"`
+	// SampleRatio is the ratio of sessions traced
+	SampleRatio float64 `yaml:"sampleRatio"`
+}
+
+// Privacy configures how user data is protected
+type Privacy struct {
+	// SaltRotation is the period UIDs are pseudonymized with the same salt in, i.e. the period visits are linkable within
+	SaltRotation time.Duration `yaml:"saltRotation"`
+	// SaltsKept is the amount of salts of past periods kept in addition to the current one
+	SaltsKept int `yaml:"saltsKept"`
+	// SaltFile is the file salts are kept in across restarts. Salts are kept in memory only if empty.
+	SaltFile string `yaml:"saltFile"`
+	// DeletionInterval is the interval the opt-out list is refreshed from the database and failed deletions are retried in
+	DeletionInterval time.Duration `yaml:"deletionInterval"`
+	// Signals is the policy visits signaling not to be tracked, with DNT or Sec-GPC headers or the bonjour query, are
+	// honored with: one of ignore, anonymous or aggregate
+	Signals string `yaml:"signals"`
+}
+
+// Search configures how search queries are processed before they are stored. Reloadable.
+type Search struct {
+	// MaxQueryLength is the maximum characters of a query stored. Longer queries are truncated.
+	MaxQueryLength int `yaml:"maxQueryLength"`
+	// StoreRawQuery stores the raw form of queries along with the normalized one, unless anything has been redacted
+	StoreRawQuery bool `yaml:"storeRawQuery"`
+}
+
+// GeoIP configures the resolution of client addresses to countries. Reloadable.
+type GeoIP struct {
+	// File is the MMDB country database, e.g. GeoLite2-Country.mmdb. Countries are not resolved if empty.
+	File string `yaml:"file"`
+	// ReloadInterval is the interval the database file is checked for updates in
+	ReloadInterval time.Duration `yaml:"reloadInterval"`
+	// MetricCountries are the countries labeled on their own in metrics, so that labels are bounded.
+	// Other countries are labeled as other.
+	MetricCountries []string `yaml:"metricCountries"`
+}
+
+// Site is a property recorded apart from the main site, e.g. the developer docs or the status page, whose clients
+// present its key with s in the bonjour query. Reloadable.
+type Site struct {
+	// ID is recorded on every row of the site and labels its metrics
+	ID string `yaml:"id"`
+	// Key is the site key clients of the site present. It is not a secret, as it is embedded in the site.
+	Key string `yaml:"key"`
+	// Origins are the origins allowed to connect to the site, as the rules of origins. Origins of the main site are
+	// not allowed unless listed.
+	Origins []string `yaml:"origins"`
+	// Messages are the message types clients of the site may report, e.g. NAVIGATED. Any type is allowed if empty.
+	Messages []string `yaml:"messages"`
+	// MessageRate and MessageBurst override limits.messageRate and limits.messageBurst for clients of the site,
+	// if MessageRate is positive
+	MessageRate  float64 `yaml:"messageRate"`
+	MessageBurst int     `yaml:"messageBurst"`
+}
+
+func setDefaults(v *viper.Viper) {
+	v.SetDefault("http.server", ":8100")
+	v.SetDefault("proxy.trusted", []string{})
+	v.SetDefault("proxy.header", "x-forwarded-for")
+	v.SetDefault("proxy.proxyProtocol", false)
+	v.SetDefault("proxy.proxyProtocolTimeout", "5s")
+	v.SetDefault("app.debug", false)
+	v.SetDefault("app.pprof", false)
+	v.SetDefault("clickhouse.addr", []string{"localhost:9000"})
+	v.SetDefault("clickhouse.database", "probe")
+	v.SetDefault("clickhouse.user", "default")
+	v.SetDefault("clickhouse.password", "")
+	v.SetDefault("log.level", "info")
+	v.SetDefault("log.format", "text")
+	v.SetDefault("log.modules", map[string]string{})
+	v.SetDefault("log.sampling.burst", 10)
+	v.SetDefault("log.sampling.interval", "1s")
+	v.SetDefault("metrics.enabled", true)
+	v.SetDefault("metrics.path", "/metrics")
+	v.SetDefault("admin.token", "")
+	v.SetDefault("origins.allowAll", false)
+	v.SetDefault("origins.environment", EnvironmentProduction)
+	v.SetDefault("origins.allowed", []string{
+		"https://penguin-stats.io", "https://*.penguin-stats.io",
+		"https://penguin-stats.cn", "https://*.penguin-stats.cn",
+		"https://exusi.ai", "https://*.exusi.ai",
+	})
+	v.SetDefault("origins.staging", []string{})
+	v.SetDefault("origins.development", []string{"http://localhost:*", "http://127.0.0.1:*"})
+	v.SetDefault("origins.apps", []string{"capacitor://localhost", "https://localhost"})
+	v.SetDefault("origins.allowMissing", true)
+	v.SetDefault("session.secret", "")
+	v.SetDefault("session.resumeWindow", "10m")
+	v.SetDefault("bot.rulesFile", "")
+	v.SetDefault("limits.maxConnectionsPerIP", 64)
+	v.SetDefault("limits.maxConnectionsPerUID", 8)
+	v.SetDefault("limits.ipv6PrefixLen", 64)
+	v.SetDefault("limits.connectionRate", 2)
+	v.SetDefault("limits.connectionBurst", 20)
+	v.SetDefault("limits.invalidMessageThreshold", 5)
+	v.SetDefault("limits.invalidMessageHalfLife", "30s")
+	v.SetDefault("limits.messageRate", 3)
+	v.SetDefault("limits.messageBurst", 10)
+	v.SetDefault("limits.throttleThreshold", 30)
+	v.SetDefault("limits.throttleHalfLife", "30s")
+	v.SetDefault("cluster.node", "")
+	v.SetDefault("cluster.peers", []string{})
+	v.SetDefault("cluster.secret", "")
+	v.SetDefault("cluster.interval", "5s")
+	v.SetDefault("shutdown.timeout", "30s")
+	v.SetDefault("shutdown.readinessDelay", "5s")
+	v.SetDefault("shutdown.spread", "15s")
+	v.SetDefault("shutdown.writeTimeout", "5s")
+	v.SetDefault("tracing.exporter", "none")
+	v.SetDefault("tracing.endpoint", "")
+	v.SetDefault("tracing.insecure", false)
+	v.SetDefault("tracing.headers", map[string]string{})
+	v.SetDefault("tracing.file", "")
+	v.SetDefault("tracing.sampleRatio", 1)
+	v.SetDefault("privacy.saltRotation", "24h")
+	v.SetDefault("privacy.saltsKept", 1)
+	v.SetDefault("privacy.saltFile", "")
+	v.SetDefault("privacy.deletionInterval", "1m")
+	v.SetDefault("privacy.signals", "anonymous")
+	v.SetDefault("search.maxQueryLength", 64)
+	v.SetDefault("search.storeRawQuery", false)
+	v.SetDefault("geoip.file", "")
+	v.SetDefault("geoip.reloadInterval", "1m")
+	v.SetDefault("geoip.metricCountries", []string{"CN", "US", "JP", "KR", "TW", "HK"})
+	v.SetDefault("sites", []Site{})
+}
+
+var (
+	current atomic.Value // *Config
+	loaded  *viper.Viper
+
+	watchmu  sync.Mutex
+	watchers []*func(*Config)
+)
+
+// Load reads the config from file and the environment, validates it and makes it current. If file is empty,
+// config.yml in the working directory is read if present, otherwise the config is read from the environment only.
+func Load(file string) (*Config, error) {
+	v := viper.New()
+	setDefaults(v)
+	v.SetEnvPrefix(EnvPrefix)
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AutomaticEnv()
+	if file != "" {
+		v.SetConfigFile(file)
+	} else {
+		v.SetConfigName("config")
+		v.AddConfigPath(".")
+	}
+	if err := v.ReadInConfig(); err != nil {
+		var notFound viper.ConfigFileNotFoundError
+		if file != "" || !errors.As(err, &notFound) {
+			return nil, err
+		}
+	}
+
+	conf, err := decode(v)
+	if err != nil {
+		return nil, err
+	}
+	current.Store(conf)
+	loaded = v
+	apply(conf)
+	return conf, nil
+}
+
+// Default returns the default config, without reading a config file or the environment
+func Default() *Config {
+	v := viper.New()
+	setDefaults(v)
+	conf, err := decode(v)
+	if err != nil {
+		panic(err)
+	}
+	return conf
+}
+
+// Set validates conf and makes it current, e.g. for configs built in code rather than loaded
+func Set(conf *Config) error {
+	if err := conf.Validate(); err != nil {
+		return err
+	}
+	current.Store(conf)
+	apply(conf)
+	return nil
+}
+
+func decode(v *viper.Viper) (*Config, error) {
+	var conf Config
+	if err := v.Unmarshal(&conf); err != nil {
+		return nil, err
+	}
+	if len(conf.Origins.Domains) > 0 {
+		log.Warnln("origins.domains is deprecated, use origins.allowed instead")
+	}
+	if v.IsSet("app.allowAllOrigin") {
+		log.Warnln("app.allowAllOrigin is deprecated, use origins.allowAll instead")
+		conf.Origins.AllowAll = conf.Origins.AllowAll || v.GetBool("app.allowAllOrigin")
+	}
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+	return &conf, nil
+}
+
+// Current returns the config currently in effect. It shall be called after Load.
+func Current() *Config {
+	return current.Load().(*Config)
+}
+
+// OnReload registers f to be called with the new config whenever it gets reloaded, until the func returned is called
+func OnReload(f func(*Config)) (unregister func()) {
+	w := &f
+	watchmu.Lock()
+	watchers = append(watchers, w)
+	watchmu.Unlock()
+	return func() {
+		watchmu.Lock()
+		defer watchmu.Unlock()
+		for i := range watchers {
+			if watchers[i] == w {
+				watchers = append(watchers[:i:i], watchers[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// notify calls the funcs registered with OnReload with conf
+func notify(conf *Config) {
+	watchmu.Lock()
+	defer watchmu.Unlock()
+	for _, f := range watchers {
+		(*f)(conf)
+	}
+}
+
+// Watch reloads the config file loaded on changes. Only the reloadable settings, i.e. log, origins, limits, search, geoip
+// and sites, take effect; changes to other settings are reported and take effect after a restart. Invalid configs are ignored.
+func Watch() {
+	v := loaded
+	if v == nil || v.ConfigFileUsed() == "" {
+		return
+	}
+	v.OnConfigChange(func(e fsnotify.Event) {
+		reloaded, err := decode(v)
+		if err != nil {
+			log.Errorln("ignored invalid config reloaded from", e.Name, err)
+			return
+		}
+		conf := *Current()
+		conf.Log = reloaded.Log
+		conf.Origins = reloaded.Origins
+		conf.Limits = reloaded.Limits
+		conf.Search = reloaded.Search
+		conf.GeoIP = reloaded.GeoIP
+		conf.Sites = reloaded.Sites
+		if !reflect.DeepEqual(&conf, reloaded) {
+			log.Warnln("config reloaded with changes which take effect after a restart only")
+		}
+		current.Store(&conf)
+		apply(&conf)
+		log.Infoln("config reloaded from", e.Name)
+		notify(&conf)
+	})
+	v.WatchConfig()
+}
+
+// apply applies settings which are consumed by packages shared across the app
+func apply(conf *Config) {
+	level, _ := logger.ParseLevel(conf.Log.Level)
+	logger.SetLevel(level)
+	modules := make(map[string]logrus.Level, len(conf.Log.Modules))
+	for module, name := range conf.Log.Modules {
+		modules[module], _ = logger.ParseLevel(name)
+	}
+	logger.SetModuleLevels(modules)
+	logger.SetFormat(conf.Log.Format)
+	logger.SetSampling(conf.Log.Sampling.Burst, conf.Log.Sampling.Interval)
+	logger.SetReportCaller(conf.App.Debug)
+}
+
+// Redacted returns a copy of conf with secrets redacted, e.g. to be printed
+func (conf Config) Redacted() Config {
+	for _, s := range []*string{&conf.ClickHouse.Password, &conf.Session.Secret, &conf.Cluster.Secret, &conf.Admin.Token} {
+		if *s != "" {
+			*s = redacted
+		}
+	}
+	// headers usually carry credentials of the collector
+	headers := make(map[string]string, len(conf.Tracing.Headers))
+	for key := range conf.Tracing.Headers {
+		headers[key] = redacted
+	}
+	conf.Tracing.Headers = headers
+	return conf
+}
+
+// Rules returns the origins allowed in the environment of o
+func (o Origins) Rules() []string {
+	rules := append([]string{}, o.Allowed...)
+	switch o.Environment {
+	case EnvironmentStaging:
+		rules = append(rules, o.Staging...)
+	case EnvironmentDevelopment:
+		rules = append(rules, o.Development...)
+	}
+	rules = append(rules, o.Apps...)
+	for _, domain := range o.Domains {
+		rules = append(rules, "https://"+domain, "https://*."+domain)
+	}
+	return rules
+}
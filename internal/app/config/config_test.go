@@ -0,0 +1,81 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoad(t *testing.T) {
+	t.Run("should read file and environment over defaults", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "probe.yml")
+		err := os.WriteFile(file, []byte("limits:\n  messageRate: 5\napp:\n  allowAllOrigin: true\nsession:\n  secret: s3cret\n"), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("PENGUINPROBE_LIMITS_MESSAGEBURST", "42")
+		t.Setenv("PENGUINPROBE_CLUSTER_INTERVAL", "1m")
+
+		conf, err := Load(file)
+		if err != nil {
+			t.Fatal("unexpected error", err)
+		}
+		if conf.Limits.MessageRate != 5 || conf.Limits.MessageBurst != 42 || conf.Cluster.Interval != time.Minute {
+			t.Error("expect file and environment to be read, got", conf.Limits, conf.Cluster)
+		}
+		if conf.Limits.ThrottleHalfLife != 30*time.Second || conf.HTTP.Server != ":8100" {
+			t.Error("expect defaults for keys not set, got", conf.Limits.ThrottleHalfLife, conf.HTTP.Server)
+		}
+		if !conf.Origins.AllowAll {
+			t.Error("expect deprecated app.allowAllOrigin to be read as origins.allowAll")
+		}
+		if Current() != conf {
+			t.Error("expect loaded config to be current")
+		}
+		if conf.Redacted().Session.Secret != redacted || conf.Session.Secret != "s3cret" {
+			t.Error("expect secret redacted in the copy only")
+		}
+	})
+
+	t.Run("should fail on missing file", func(t *testing.T) {
+		if _, err := Load(filepath.Join(t.TempDir(), "missing.yml")); err == nil {
+			t.Error("expect error")
+		}
+	})
+
+	t.Run("should report every invalid setting", func(t *testing.T) {
+		t.Setenv("PENGUINPROBE_LIMITS_MESSAGERATE", "-1")
+		t.Setenv("PENGUINPROBE_CLUSTER_PEERS", "http://probe-1:8100,probe-2")
+		t.Setenv("PENGUINPROBE_LOG_FORMAT", "xml")
+		_, err := Load(filepath.Join("..", "..", "..", "config.example.yml"))
+		verr, ok := err.(ValidationError)
+		if !ok {
+			t.Fatal("expect ValidationError, got", err)
+		}
+		msg := verr.Error()
+		for _, key := range []string{"log.format", "limits.messageRate", "cluster.secret", "cluster.peers", "privacy.saltFile"} {
+			if !strings.Contains(msg, key) {
+				t.Error("expect", key, "reported in", msg)
+			}
+		}
+		if len(verr) != 5 {
+			t.Error("expect 5 invalid settings, got", len(verr), msg)
+		}
+	})
+}
+
+func TestOnReload(t *testing.T) {
+	var kept, removed int
+	unregisterKept := OnReload(func(*Config) { kept++ })
+	defer unregisterKept()
+	unregister := OnReload(func(*Config) { removed++ })
+
+	notify(&Config{})
+	unregister()
+	notify(&Config{})
+	if kept != 2 || removed != 1 {
+		t.Error("expect funcs unregistered not to be called anymore, got", kept, "and", removed, "calls")
+	}
+}
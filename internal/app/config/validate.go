@@ -0,0 +1,230 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/elliotchance/pie/pie"
+
+	"github.com/penguin-statistics/probe/internal/pkg/dnt"
+	"github.com/penguin-statistics/probe/internal/pkg/logger"
+	"github.com/penguin-statistics/probe/internal/pkg/origin"
+	"github.com/penguin-statistics/probe/internal/pkg/realip"
+	"github.com/penguin-statistics/probe/internal/pkg/site"
+	"github.com/penguin-statistics/probe/internal/pkg/tracing"
+)
+
+// siteID matches the IDs of sites, which are recorded and label metrics
+var siteID = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+// ValidationError lists every invalid setting of a config
+type ValidationError []string
+
+func (e ValidationError) Error() string {
+	return "invalid config:\n  " + strings.Join(e, "\n  ")
+}
+
+// Validate checks conf for invalid settings. The error returned, if any, is a ValidationError.
+func (conf *Config) Validate() error {
+	var errs ValidationError
+	fail := func(key, format string, args ...interface{}) {
+		errs = append(errs, key+": "+fmt.Sprintf(format, args...))
+	}
+
+	if _, _, err := net.SplitHostPort(conf.HTTP.Server); err != nil {
+		fail("http.server", "shall be an address like host:port, got %q", conf.HTTP.Server)
+	}
+	if _, err := realip.ParseTrusted(conf.Proxy.Trusted); err != nil {
+		fail("proxy.trusted", "shall be CIDRs or addresses: %v", err)
+	}
+	if !pie.Strings(realip.Headers).Contains(conf.Proxy.Header) {
+		fail("proxy.header", "shall be one of %s, got %q", strings.Join(realip.Headers, ", "), conf.Proxy.Header)
+	}
+	if conf.Proxy.ProxyProtocol && len(conf.Proxy.Trusted) == 0 {
+		fail("proxy.trusted", "at least one proxy is required when proxy.proxyProtocol is set")
+	}
+	if conf.Proxy.ProxyProtocol && conf.Proxy.ProxyProtocolTimeout <= 0 {
+		fail("proxy.proxyProtocolTimeout", "shall be positive")
+	}
+	if len(conf.ClickHouse.Addr) == 0 {
+		fail("clickhouse.addr", "at least one address is required")
+	}
+	for _, addr := range conf.ClickHouse.Addr {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			fail("clickhouse.addr", "shall be addresses like host:port, got %q", addr)
+		}
+	}
+	if conf.ClickHouse.Database == "" {
+		fail("clickhouse.database", "is required")
+	}
+	if _, err := logger.ParseLevel(conf.Log.Level); err != nil {
+		fail("log.level", "shall be one of trace, debug, info, warn and error, got %q", conf.Log.Level)
+	}
+	if !logger.ValidFormat(conf.Log.Format) {
+		fail("log.format", "shall be either text or json, got %q", conf.Log.Format)
+	}
+	modules := make([]string, 0, len(conf.Log.Modules))
+	for module := range conf.Log.Modules {
+		modules = append(modules, module)
+	}
+	sort.Strings(modules)
+	for _, module := range modules {
+		if _, err := logger.ParseLevel(conf.Log.Modules[module]); err != nil {
+			fail("log.modules."+module, "shall be one of trace, debug, info, warn and error, got %q", conf.Log.Modules[module])
+		}
+	}
+	if conf.Log.Sampling.Burst < 0 {
+		fail("log.sampling.burst", "shall not be negative")
+	}
+	if conf.Log.Sampling.Burst > 0 && conf.Log.Sampling.Interval <= 0 {
+		fail("log.sampling.interval", "shall be positive")
+	}
+	if conf.Metrics.Enabled && !strings.HasPrefix(conf.Metrics.Path, "/") {
+		fail("metrics.path", "shall start with /, got %q", conf.Metrics.Path)
+	}
+	if !pie.Strings(Environments).Contains(conf.Origins.Environment) {
+		fail("origins.environment", "shall be one of %s, got %q", strings.Join(Environments, ", "), conf.Origins.Environment)
+	}
+	rules := conf.Origins.Rules()
+	for _, rule := range rules {
+		if _, err := origin.ParseRule(rule); err != nil {
+			fail("origins", "%v", err)
+		}
+	}
+	if !conf.Origins.AllowAll && len(rules) == 0 {
+		fail("origins.allowed", "at least one origin is required unless origins.allowAll is set")
+	}
+	if conf.Session.ResumeWindow <= 0 {
+		fail("session.resumeWindow", "shall be positive")
+	}
+
+	l := conf.Limits
+	for _, limit := range []struct {
+		key   string
+		value float64
+	}{
+		{"limits.maxConnectionsPerIP", float64(l.MaxConnectionsPerIP)},
+		{"limits.maxConnectionsPerUID", float64(l.MaxConnectionsPerUID)},
+		{"limits.connectionRate", l.ConnectionRate},
+		{"limits.connectionBurst", float64(l.ConnectionBurst)},
+		{"limits.invalidMessageThreshold", l.InvalidMessageThreshold},
+		{"limits.messageRate", l.MessageRate},
+		{"limits.messageBurst", float64(l.MessageBurst)},
+		{"limits.throttleThreshold", l.ThrottleThreshold},
+	} {
+		if limit.value < 0 {
+			fail(limit.key, "shall not be negative")
+		}
+	}
+	if l.IPv6PrefixLen < 0 || l.IPv6PrefixLen > 128 {
+		fail("limits.ipv6PrefixLen", "shall be between 0 and 128, got %d", l.IPv6PrefixLen)
+	}
+	if l.InvalidMessageThreshold > 0 && l.InvalidMessageHalfLife <= 0 {
+		fail("limits.invalidMessageHalfLife", "shall be positive")
+	}
+	if l.ThrottleThreshold > 0 && l.ThrottleHalfLife <= 0 {
+		fail("limits.throttleHalfLife", "shall be positive")
+	}
+
+	if len(conf.Cluster.Peers) > 0 && conf.Cluster.Secret == "" {
+		fail("cluster.secret", "is required when cluster.peers are configured")
+	}
+	for _, peer := range conf.Cluster.Peers {
+		if u, err := url.Parse(peer); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			fail("cluster.peers", "shall be base urls like http://host:port, got %q", peer)
+		}
+	}
+	if conf.Cluster.Interval <= 0 {
+		fail("cluster.interval", "shall be positive")
+	}
+
+	if conf.Shutdown.Timeout <= 0 {
+		fail("shutdown.timeout", "shall be positive")
+	}
+	if conf.Shutdown.ReadinessDelay < 0 || conf.Shutdown.Spread < 0 {
+		fail("shutdown", "readinessDelay and spread shall not be negative")
+	}
+	if conf.Shutdown.ReadinessDelay+conf.Shutdown.Spread >= conf.Shutdown.Timeout {
+		fail("shutdown.timeout", "shall be longer than readinessDelay and spread combined")
+	}
+	if conf.Shutdown.WriteTimeout <= 0 {
+		fail("shutdown.writeTimeout", "shall be positive")
+	}
+
+	if !pie.Strings(tracing.Exporters).Contains(conf.Tracing.Exporter) {
+		fail("tracing.exporter", "shall be one of %s, got %q", strings.Join(tracing.Exporters, ", "), conf.Tracing.Exporter)
+	}
+	if conf.Tracing.SampleRatio < 0 || conf.Tracing.SampleRatio > 1 {
+		fail("tracing.sampleRatio", "shall be between 0 and 1, got %v", conf.Tracing.SampleRatio)
+	}
+
+	if conf.Privacy.SaltRotation <= 0 {
+		fail("privacy.saltRotation", "shall be positive")
+	}
+	if conf.Privacy.SaltsKept < 0 {
+		fail("privacy.saltsKept", "shall not be negative")
+	}
+	// instances pseudonymizing under salts of their own would neither de-duplicate visits across instances
+	// nor find the sessions recorded by the others on opt-outs
+	if len(conf.Cluster.Peers) > 0 && conf.Privacy.SaltFile == "" {
+		fail("privacy.saltFile", "is required when cluster.peers are configured, as a file shared by all instances")
+	}
+	if conf.Privacy.DeletionInterval <= 0 {
+		fail("privacy.deletionInterval", "shall be positive")
+	}
+	if !pie.Strings(dnt.Policies).Contains(conf.Privacy.Signals) {
+		fail("privacy.signals", "shall be one of %s, got %q", strings.Join(dnt.Policies, ", "), conf.Privacy.Signals)
+	}
+
+	if conf.Search.MaxQueryLength <= 0 {
+		fail("search.maxQueryLength", "shall be positive")
+	}
+
+	if conf.GeoIP.ReloadInterval <= 0 {
+		fail("geoip.reloadInterval", "shall be positive")
+	}
+	for _, country := range conf.GeoIP.MetricCountries {
+		if len(country) != 2 || strings.ToUpper(country) != country {
+			fail("geoip.metricCountries", "shall be ISO 3166-1 alpha-2 codes in upper case, got %q", country)
+		}
+	}
+
+	ids, keys := pie.Strings{site.Main}, pie.Strings{}
+	for i, s := range conf.Sites {
+		key := fmt.Sprintf("sites[%d]", i)
+		if !siteID.MatchString(s.ID) {
+			fail(key+".id", "shall be lower case letters, digits, - and _, got %q", s.ID)
+		} else if ids.Contains(s.ID) {
+			fail(key+".id", "shall be unique and other than %s, got %q", site.Main, s.ID)
+		}
+		ids = append(ids, s.ID)
+		if s.Key == "" {
+			fail(key+".key", "is required")
+		} else if keys.Contains(s.Key) {
+			fail(key+".key", "shall be unique")
+		}
+		keys = append(keys, s.Key)
+		for _, rule := range s.Origins {
+			if _, err := origin.ParseRule(rule); err != nil {
+				fail(key+".origins", "%v", err)
+			}
+		}
+		for _, name := range s.Messages {
+			if _, err := site.ParseMessageType(name); err != nil {
+				fail(key+".messages", "%v", err)
+			}
+		}
+		if s.MessageRate < 0 || s.MessageBurst < 0 {
+			fail(key, "messageRate and messageBurst shall not be negative")
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
@@ -0,0 +1,19 @@
+package controller
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// authorizeAdmin checks that the request of c carries token as a bearer token. Admin requests are never authorized
+// if token is empty.
+func authorizeAdmin(c echo.Context, token string) error {
+	bearer := strings.TrimPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "Bearer ")
+	if token == "" || subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) != 1 {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid admin token")
+	}
+	return nil
+}
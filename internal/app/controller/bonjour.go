@@ -1,40 +1,87 @@
 package controller
 
 import (
+	"context"
 	"errors"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/davecgh/go-spew/spew"
 	"github.com/dchest/uniuri"
 	"github.com/gorilla/websocket"
 	"github.com/labstack/echo/v4"
 	"github.com/oklog/ulid/v2"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/protobuf/proto"
 
+	"github.com/penguin-statistics/probe/internal/app/config"
 	"github.com/penguin-statistics/probe/internal/app/model"
 	"github.com/penguin-statistics/probe/internal/app/service"
+	"github.com/penguin-statistics/probe/internal/pkg/attribution"
+	"github.com/penguin-statistics/probe/internal/pkg/botdetect"
+	"github.com/penguin-statistics/probe/internal/pkg/cluster"
 	"github.com/penguin-statistics/probe/internal/pkg/commons"
+	"github.com/penguin-statistics/probe/internal/pkg/connlimit"
+	"github.com/penguin-statistics/probe/internal/pkg/dnt"
+	"github.com/penguin-statistics/probe/internal/pkg/geoip"
 	"github.com/penguin-statistics/probe/internal/pkg/logger"
 	"github.com/penguin-statistics/probe/internal/pkg/messages"
+	"github.com/penguin-statistics/probe/internal/pkg/origin"
+	"github.com/penguin-statistics/probe/internal/pkg/session"
+	"github.com/penguin-statistics/probe/internal/pkg/site"
+	"github.com/penguin-statistics/probe/internal/pkg/tracing"
+	"github.com/penguin-statistics/probe/internal/pkg/useragent"
 	"github.com/penguin-statistics/probe/internal/pkg/wspool"
 )
 
-var log = logger.New("controller")
+var (
+	log    = logger.New("controller")
+	tracer = tracing.Tracer("controller")
+)
 
 // Bonjour is a bonjour service controller
 type Bonjour struct {
-	sBonjour *service.Bonjour
-	sProm    *service.Prometheus
-	hub      *wspool.Hub
-	upgrader *websocket.Upgrader
-}
+	sBonjour   *service.Bonjour
+	sOptOut    *service.OptOut
+	sProm      *service.Prometheus
+	hub        *wspool.Hub
+	sessions   *session.Store
+	classifier *botdetect.Classifier
+	limiter    *connlimit.Limiter
+	cluster    *cluster.Cluster
+	routes     *cluster.Routes
+	geo        *geoip.Resolver
+	origins    *origin.Policy
+	sites      *site.Registry
+	upgrader   *websocket.Upgrader
 
-// NewBonjour creates a Bonjour controller with service
-func NewBonjour(sBonjour *service.Bonjour, sProm *service.Prometheus, hub *wspool.Hub) *Bonjour {
-	go hub.Run()
+	drainmu  sync.RWMutex
+	draining bool
+	conns    sync.WaitGroup
+	pending  int32
+}
 
+// NewBonjour creates a Bonjour controller with service. Clients connected are counted in routes by their current route,
+// and are recorded for the sites of sites, whose upgrades are allowed from the origins of each site. Pages on the
+// domains of origins are internal to attribution.
+func NewBonjour(sBonjour *service.Bonjour, sOptOut *service.OptOut, sProm *service.Prometheus, hub *wspool.Hub, sessions *session.Store, classifier *botdetect.Classifier, limiter *connlimit.Limiter, cl *cluster.Cluster, routes *cluster.Routes, geo *geoip.Resolver, origins *origin.Policy, sites *site.Registry) *Bonjour {
 	sProm.RegisterLiveUserFunc(func() float64 {
-		return float64(len(hub.Clients))
+		return float64(hub.Len())
+	})
+	sProm.RegisterClusterLiveUserFunc(func() float64 {
+		live, _ := cl.Live()
+		return float64(live)
 	})
 	sProm.RegisterUsersFunc(func() float64 {
 		count, err := sBonjour.Count()
@@ -45,13 +92,22 @@ func NewBonjour(sBonjour *service.Bonjour, sProm *service.Prometheus, hub *wspoo
 	})
 
 	return &Bonjour{
-		sBonjour: sBonjour,
-		sProm:    sProm,
-		hub:      hub,
+		sBonjour:   sBonjour,
+		sOptOut:    sOptOut,
+		sProm:      sProm,
+		hub:        hub,
+		sessions:   sessions,
+		classifier: classifier,
+		limiter:    limiter,
+		cluster:    cl,
+		routes:     routes,
+		geo:        geo,
+		origins:    origins,
+		sites:      sites,
 		upgrader: &websocket.Upgrader{
 			ReadBufferSize:  128,
 			WriteBufferSize: 128,
-			CheckOrigin:     commons.GenOriginChecker(),
+			CheckOrigin:     sites.CheckOrigin,
 			Error: func(w http.ResponseWriter, r *http.Request, status int, reason error) {
 			},
 			EnableCompression: false,
@@ -59,27 +115,97 @@ func NewBonjour(sBonjour *service.Bonjour, sProm *service.Prometheus, hub *wspoo
 	}
 }
 
-// LiveHandler handles probe reports
-func (bc *Bonjour) LiveHandler(c echo.Context) error {
-	req := new(model.Bonjour)
-	if err := c.Bind(req); err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, err)
+// LiveHandler handles probe reports. The whole connection is traced as a session span, which per-message
+// spans are linked to.
+func (bc *Bonjour) LiveHandler(c echo.Context) (err error) {
+	ctx := otel.GetTextMapPropagator().Extract(c.Request().Context(), propagation.HeaderCarrier(c.Request().Header))
+	ctx, span := tracer.Start(ctx, "session", trace.WithSpanKind(trace.SpanKindServer))
+	defer func() {
+		tracing.End(span, err)
+	}()
+
+	// the client address as resolved from trusted proxies, used for limits and geoip alike
+	ip := c.RealIP()
+	if ok, retryAfter := bc.limiter.Allow(ip); !ok {
+		bc.sProm.IncRejected("ip_rate")
+		c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		return echo.NewHTTPError(http.StatusTooManyRequests, "too many connection attempts")
 	}
-	if err := c.Validate(req); err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, err)
+
+	req, err := bc.bind(ctx, c)
+	if err != nil {
+		return err
 	}
-	if req.Platform == nil {
-		return echo.NewHTTPError(http.StatusBadRequest, errors.New("platform: field is required"))
+
+	// resolve the site the client is recorded for. clients presenting no site key belong to the main site
+	s, err := bc.sites.Site(req.SiteKey)
+	if err != nil {
+		bc.sProm.IncRejected("site_key")
+		return echo.NewHTTPError(http.StatusForbidden, err.Error())
+	}
+	req.Site = s.ID
+	span.SetAttributes(attribute.String("probe.site", s.ID))
+
+	// users who opted out are never recorded: there is nothing to do for them
+	if req.UID != "" && bc.sOptOut.OptedOut(req.UID) {
+		span.SetAttributes(attribute.Bool("probe.opted_out", true))
+		return c.NoContent(http.StatusNoContent)
 	}
 
 	req.ID = ulid.Make().String()
 
+	// resolve the country of the client. the address itself is never recorded
+	req.Country = bc.geo.Country(net.ParseIP(ip))
+	country := geoip.Label(req.Country, config.Current().GeoIP.MetricCountries)
+
+	// honor the privacy signals of browsers, or of apps through the bonjour query
+	rec := &recorder{sBonjour: bc.sBonjour, policy: dnt.PolicyIgnore, site: s.ID}
+	if req.DoNotTrack || dnt.Requested(c.Request().Header) {
+		rec.policy = config.Current().Privacy.Signals
+	}
+
 	platform := req.Platform.Marshal()
+	span.SetAttributes(
+		attribute.String("probe.bonjour.id", req.ID),
+		attribute.String("probe.platform", platform),
+		attribute.String("probe.version", req.Version.String()),
+		attribute.Int("probe.reconnects", req.Reconnects),
+		attribute.Bool("probe.legacy", req.Legacy != 0),
+		attribute.String("probe.privacy_policy", rec.policy),
+		attribute.String("probe.country", country),
+	)
+
+	// every line logged for the connection carries its session, so that it can be followed across reconnects
+	fields := logrus.Fields{
+		"session":  req.ID,
+		"site":     s.ID,
+		"platform": platform,
+		"version":  req.Version.String(),
+		"remote":   ip,
+	}
+	clog := log.WithFields(fields)
+
+	// classify the request by its headers. flagged requests are recorded but excluded from human-facing metrics
+	verdict := bc.classifier.Classify(c.Request(), *req.Platform == model.PlatformWeb)
+	req.Classification = verdict.Classification()
+	span.SetAttributes(attribute.String("probe.classification", req.Classification.String()))
+
+	// parse the User-Agent into coarse dimensions. the User-Agent itself is never recorded
+	agent := useragent.Parse(c.Request().UserAgent())
+	if req.Classification == botdetect.Bot {
+		agent.Device = useragent.DeviceBot
+	}
+	req.Browser, req.BrowserVersion, req.OS, req.Device = agent.Browser, agent.BrowserVersion, agent.OS, agent.Device
+	span.SetAttributes(
+		attribute.String("probe.browser", agent.Browser),
+		attribute.String("probe.os", agent.OS),
+		attribute.String("probe.device", agent.Device),
+	)
 
 	// get referer path from bonjour request
 	path, err := commons.CleanClientRoute(req.Referer)
 	if err != nil {
-		log.Debugln("invalid referer provided: failed to clean client route:", err)
+		clog.Debugln("invalid referer provided: failed to clean client route:", err)
 		path = "(unspecified)"
 	}
 
@@ -93,59 +219,167 @@ func (bc *Bonjour) LiveHandler(c echo.Context) error {
 	if req.Legacy != 0 {
 		// generate a uid for them
 		req.UID = uniuri.NewLen(32)
+		bc.attribute(c.Request(), req)
 
 		// record bonjour request - see how many sessions are there
-		_ = bc.sBonjour.RecordBonjour(req)
+		_ = rec.bonjour(ctx, req)
 
-		bc.sProm.IncUV(platform)
-		bc.sProm.IncPV(platform)
+		bc.countView(s.ID, platform, country, verdict, true)
+		bc.sProm.IncUserAgent(s.ID, agent.Browser, agent.OS, agent.Device)
 
 		return c.NoContent(http.StatusNoContent)
 	}
 
+	// stop accepting upgrades once draining, so that clients reconnect to the other instances
+	bc.drainmu.RLock()
+	if bc.draining {
+		bc.drainmu.RUnlock()
+		c.Response().Header().Set("Retry-After", "1")
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "server is shutting down")
+	}
+	bc.conns.Add(1)
+	atomic.AddInt32(&bc.pending, 1)
+	bc.drainmu.RUnlock()
+	defer func() {
+		atomic.AddInt32(&bc.pending, -1)
+		bc.conns.Done()
+	}()
+
+	// negotiate protocol before anything is recorded so that unsupported clients are rejected cleanly
+	protocol, err := wspool.NegotiateProtocol(websocket.Subprotocols(c.Request()), req.ProtocolVersion, req.Capabilities)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	// enforce concurrent connection limits before anything is recorded
+	release, err := bc.limiter.Acquire(ip, req.UID)
+	if err != nil {
+		switch err {
+		case connlimit.ErrTooManyIPConnections:
+			bc.sProm.IncRejected("ip_connections")
+		case connlimit.ErrTooManyUIDConnections:
+			bc.sProm.IncRejected("uid_connections")
+		}
+		retryAfter := math.Max(1, math.Ceil(bc.limiter.RetryAfter().Seconds()))
+		c.Response().Header().Set("Retry-After", strconv.Itoa(int(retryAfter)))
+		return echo.NewHTTPError(http.StatusTooManyRequests, err.Error())
+	}
+	defer release()
+
+	// restore the original session if the reconnecting client presents a valid resume token
+	var state *session.State
+	if req.Reconnects > 0 && req.ResumeToken != "" {
+		state, err = bc.sessions.Resume(req.ResumeToken, req.UID)
+		if err != nil {
+			clog.Debugln("failed to resume session:", err)
+		} else {
+			req.ID = state.ID
+			span.SetAttributes(attribute.String("probe.bonjour.id", req.ID))
+			fields["session"] = req.ID
+			clog = log.WithFields(fields)
+		}
+	}
+	resumed := state != nil
+	span.SetAttributes(attribute.Bool("probe.resumed", resumed))
+
 	// record reconnections
-	bc.sProm.RecordReconnection(platform, req.Reconnects)
+	bc.sProm.RecordReconnection(s.ID, platform, req.Reconnects)
 
 	// record initial visit records only if this is NOT a reconnecting request
 	if req.Reconnects == 0 {
-		// increment the uv since this is a probe request that would initiate on and only on reconnect==0
-		bc.sProm.IncUV(platform)
-
-		// record initial page view that comes with initial probe request
-		bc.sProm.IncPV(platform)
+		bc.attribute(c.Request(), req)
+		// increment the uv since this is a probe request that would initiate on and only on reconnect==0,
+		// and record initial page view that comes with initial probe request
+		bc.countView(s.ID, platform, country, verdict, true)
+		bc.sProm.IncUserAgent(s.ID, agent.Browser, agent.OS, agent.Device)
 
 		// record bonjour request - see how many sessions are there
-		err = bc.sBonjour.RecordBonjour(req)
+		err = rec.bonjour(ctx, req)
 		if err != nil {
 			return err
 		}
 
-		err = bc.sBonjour.RecordImpression(impression)
+		err = rec.impression(ctx, impression)
+		if err != nil {
+			return err
+		}
+	} else if !resumed {
+		// the previous session is gone: record the new one so that events reported
+		// within this connection reference an existing bonjour
+		err = rec.bonjour(ctx, req)
 		if err != nil {
 			return err
 		}
 	}
 
+	if !resumed {
+		state = bc.sessions.Create(req.ID, req.UID, path)
+	}
+	defer bc.sessions.Detach(state)
+
 	// upgrade to websocket
-	ws, err := bc.upgrader.Upgrade(c.Response(), c.Request(), nil)
+	var header http.Header
+	if protocol.Subprotocol != "" {
+		header = http.Header{"Sec-Websocket-Protocol": {protocol.Subprotocol}}
+	}
+	_, upgrade := tracer.Start(ctx, "upgrade")
+	ws, err := bc.upgrader.Upgrade(c.Response(), c.Request(), header)
+	tracing.End(upgrade, err)
 	if err != nil {
-		log.Debugln("failed to update http conn to ws conn", err)
+		clog.Debugln("failed to update http conn to ws conn", err)
+		if !resumed {
+			bc.flag(ctx, clog, rec, req.ID, verdict, verdict.With(botdetect.SignalNoUpgrade))
+		}
 		c.Response().Header().Set(echo.HeaderUpgrade, "websocket")
 		return echo.NewHTTPError(http.StatusUpgradeRequired, "failed to upgrade to websocket")
 	}
 
-	client := wspool.NewClient(bc.hub, ws)
+	behavior := botdetect.NewBehavior(resumed)
+	defer func() {
+		bc.flag(ctx, clog, rec, req.ID, verdict, verdict.With(behavior.Signals()...))
+	}()
 
-	must := func(err error) error {
+	client := wspool.NewClient(bc.hub, ws, protocol, platform)
+	client.Logger = client.Logger.WithFields(fields)
+	if s.MessageRate > 0 {
+		client.SetMessageLimit(s.MessageRate, s.MessageBurst)
+	}
+	client.SetLastSeq(state.LastSeq())
+	defer func() {
+		state.SetLastSeq(client.LastSeq())
+	}()
+
+	// resume tokens expire on their own, so they are refreshed as long as the client is connected
+	var refresh <-chan time.Time
+	if protocol.Supports(wspool.CapabilityResume) {
+		_ = client.SendMessage(&messages.ServerSession{
+			Type:        messages.MessageType_SERVER_SESSION,
+			ResumeToken: bc.sessions.Token(state),
+			Resumed:     resumed,
+			LastSeq:     state.LastSeq(),
+		})
+		ticker := time.NewTicker(bc.sessions.RefreshInterval())
+		defer ticker.Stop()
+		refresh = ticker.C
+	}
+
+	must := func(span trace.Span, reason string, err error) error {
 		if err != nil {
-			client.Send <- wspool.ErrInvalidWsMessage
-			log.Traceln(err)
+			span.SetStatus(codes.Error, reason)
+			client.Strike(reason)
+			clog.Traceln(err)
 			return err
 		}
 		return nil
 	}
 
-	bc.hub.Register <- client
+	route := state.LastRoute()
+	bc.routes.Move("", route)
+	defer func() {
+		bc.routes.Move(route, "")
+	}()
+
+	bc.hub.Register(client)
 	go client.Read()
 	go client.Write()
 	for {
@@ -154,35 +388,71 @@ func (bc *Bonjour) LiveHandler(c echo.Context) error {
 			if !more {
 				return nil
 			}
+		case <-refresh:
+			_ = client.SendMessage(&messages.ServerSession{
+				Type:        messages.MessageType_SERVER_SESSION,
+				ResumeToken: bc.sessions.Token(state),
+				Resumed:     resumed,
+				LastSeq:     client.LastSeq(),
+			})
 		case r, more := <-client.Received:
 			if !more {
 				return nil
 			}
-			switch r.Skeleton.Meta.Type {
+			// stop recording as soon as the user opts out within the session
+			if bc.sOptOut.OptedOut(req.UID) {
+				client.Close()
+				return nil
+			}
+			// messages are traced on their own, as sessions may last for hours, but linked to the session
+			mctx, mspan := tracer.Start(context.Background(), "message",
+				trace.WithNewRoot(),
+				trace.WithLinks(trace.LinkFromContext(ctx)),
+				trace.WithAttributes(
+					attribute.String("probe.bonjour.id", req.ID),
+					attribute.String("probe.message.type", r.Skeleton.GetMeta().GetType().String()),
+					attribute.Int64("probe.message.seq", int64(r.Skeleton.GetMeta().GetSeq())),
+				),
+			)
+			// messages of types the site is not allowed to report are never recorded
+			if t := r.Skeleton.GetMeta().GetType(); !s.Allows(t) {
+				if l, ok := logger.Sample(clog, "controller: disallowed message type"); ok {
+					l.Debugln("message type not allowed for site", t)
+				}
+				mspan.SetStatus(codes.Error, wspool.StrikeDisallowedType)
+				client.Strike(wspool.StrikeDisallowedType)
+				mspan.End()
+				continue
+			}
+			switch r.Skeleton.GetMeta().GetType() {
 			case messages.MessageType_NAVIGATED:
 				var body messages.Navigated
-				err := must(proto.Unmarshal(r.Body, &body))
+				err := must(mspan, wspool.StrikeDecode, proto.Unmarshal(r.Body, &body))
 				if err != nil {
 					break
 				}
 				path, err := commons.CleanClientRoute(body.Path)
-				if must(err) != nil {
+				if must(mspan, wspool.StrikeValidation, err) != nil {
 					break
 				}
-				bc.sProm.IncPV(platform)
+				behavior.Navigated(time.Now())
+				bc.countView(s.ID, platform, country, verdict.With(behavior.Signals()...), false)
+				state.SetLastRoute(path)
+				bc.routes.Move(route, path)
+				route = path
 				impression := &model.Impression{
 					ID:        ulid.Make().String(),
 					BonjourID: req.ID,
 					Path:      path,
 				}
-				err = bc.sBonjour.RecordImpression(impression)
+				err = rec.impression(mctx, impression)
 				if err != nil {
-					log.Warnln("failed to record impression:", err)
+					clog.Warnln("failed to record impression:", err)
 				}
 
 			case messages.MessageType_ENTERED_SEARCH_RESULT:
 				var body messages.EnteredSearchResult
-				err := must(proto.Unmarshal(r.Body, &body))
+				err := must(mspan, wspool.StrikeDecode, proto.Unmarshal(r.Body, &body))
 				if err != nil {
 					break
 				}
@@ -196,7 +466,7 @@ func (bc *Bonjour) LiveHandler(c echo.Context) error {
 					destination = "unknown"
 				}
 
-				err = bc.sBonjour.RecordEventSearchResultEntered(&model.EventSearchResultEntered{
+				err = rec.searchResultEntered(mctx, &model.EventSearchResultEntered{
 					ID:             ulid.Make().String(),
 					BonjourID:      req.ID,
 					Query:          body.Query,
@@ -204,21 +474,140 @@ func (bc *Bonjour) LiveHandler(c echo.Context) error {
 					ResultPosition: body.GetPosition(),
 				})
 				if err != nil {
-					log.Warnln("failed to record impression:", err)
+					clog.Warnln("failed to record search result entered:", err)
 				}
 
 			case messages.MessageType_EXECUTED_ADVANCED_QUERY:
 				var body messages.ExecutedAdvancedQuery
-				err := must(proto.Unmarshal(r.Body, &body))
+				err := must(mspan, wspool.StrikeDecode, proto.Unmarshal(r.Body, &body))
 				if err != nil {
 					break
 				}
-				log.Infoln("Client Report: performed advanced queries:", spew.Sdump(body.Queries))
+				clog.Infoln("Client Report: performed advanced queries:", spew.Sdump(body.Queries))
 
 			default:
-				log.Debugln("unknown message type", r.Skeleton.Meta.Type)
-				client.Send <- wspool.ErrInvalidWsMessage
+				if l, ok := logger.Sample(clog, "controller: unknown message type"); ok {
+					l.Debugln("unknown message type", r.Skeleton.GetMeta().GetType())
+				}
+				mspan.SetStatus(codes.Error, wspool.StrikeUnknownType)
+				client.Strike(wspool.StrikeUnknownType)
 			}
+			mspan.End()
 		}
 	}
 }
+
+// bind binds and validates the bonjour request of c
+func (bc *Bonjour) bind(ctx context.Context, c echo.Context) (req *model.Bonjour, err error) {
+	_, span := tracer.Start(ctx, "bind")
+	defer func() {
+		tracing.End(span, err)
+	}()
+
+	req = new(model.Bonjour)
+	if err := c.Bind(req); err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+	if err := c.Validate(req); err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+	if req.Platform == nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, errors.New("platform: field is required"))
+	}
+	return req, nil
+}
+
+// attribute attributes the landing of req to the campaign of the route landed on and to the referrer of the page.
+// Clients which don't report them fall back to the Referer header: an external one is the referrer of the page,
+// while an internal one is the page itself, which carries the UTM parameters for clients reporting bare routes.
+func (bc *Bonjour) attribute(r *http.Request, req *model.Bonjour) {
+	internal := bc.origins.Domains()
+
+	route, referrer := req.Referer, req.DocumentReferrer
+	if header := r.Referer(); header != "" {
+		if !attribution.IsInternal(header, internal) {
+			if referrer == "" {
+				referrer = header
+			}
+		} else if !strings.Contains(route, "utm_") {
+			route = header
+		}
+	}
+
+	a := attribution.Resolve(route, referrer, internal)
+	req.UTMSource, req.UTMMedium, req.UTMCampaign = a.Source, a.Medium, a.Campaign
+	req.ReferrerDomain, req.ReferrerClass = a.ReferrerDomain, a.ReferrerClass
+}
+
+// ClusterLiveHandler reports the clients connected to the whole cluster, in total and partitioned by route
+func (bc *Bonjour) ClusterLiveHandler(c echo.Context) error {
+	live, routes := bc.cluster.Live()
+	return c.JSON(http.StatusOK, &model.ClusterLive{
+		Node:   bc.cluster.Node(),
+		Live:   live,
+		Routes: routes,
+	})
+}
+
+// Drain stops accepting new connections. Connections already accepted are left to be evicted from the hub.
+func (bc *Bonjour) Drain() {
+	bc.drainmu.Lock()
+	bc.draining = true
+	bc.drainmu.Unlock()
+}
+
+// Draining reports whether Drain has been called
+func (bc *Bonjour) Draining() bool {
+	bc.drainmu.RLock()
+	defer bc.drainmu.RUnlock()
+	return bc.draining
+}
+
+// Wait waits for the handlers of accepted connections to finish recording, or for ctx to be done.
+// It shall be called after Drain.
+func (bc *Bonjour) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		bc.conns.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Pending returns the number of handlers of accepted connections which have not finished yet
+func (bc *Bonjour) Pending() int {
+	return int(atomic.LoadInt32(&bc.pending))
+}
+
+// countView increments page views, and unique views if uv is set, for human traffic.
+// Flagged traffic is counted separately so that it does not inflate human-facing metrics.
+func (bc *Bonjour) countView(site, platform, country string, verdict botdetect.Verdict, uv bool) {
+	if classification := verdict.Classification(); classification != botdetect.Human {
+		bc.sProm.IncFlagged(site, platform, classification.String())
+		return
+	}
+	if uv {
+		bc.sProm.IncUV(site, platform, country)
+	}
+	bc.sProm.IncPV(site, platform)
+}
+
+// flag records a late classification of the bonjour if verdict is worse than the recorded one
+func (bc *Bonjour) flag(ctx context.Context, clog *logrus.Entry, rec *recorder, bonjourID string, recorded, verdict botdetect.Verdict) {
+	if verdict.Classification() <= recorded.Classification() {
+		return
+	}
+	err := rec.flag(ctx, &model.BonjourFlag{
+		BonjourID:      bonjourID,
+		Classification: verdict.Classification(),
+		Reason:         verdict.Reason(),
+	})
+	if err != nil {
+		clog.Warnln("failed to record bonjour flag:", err)
+	}
+}
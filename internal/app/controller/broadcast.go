@@ -0,0 +1,52 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/penguin-statistics/probe/internal/app/model"
+	"github.com/penguin-statistics/probe/internal/pkg/cluster"
+	"github.com/penguin-statistics/probe/internal/pkg/messages"
+)
+
+// Broadcast is a controller pushing messages to the clients connected to the whole cluster
+type Broadcast struct {
+	cluster *cluster.Cluster
+	token   string
+}
+
+// NewBroadcast creates a Broadcast controller relaying messages through cl. Requests shall carry token as a bearer token.
+func NewBroadcast(cl *cluster.Cluster, token string) *Broadcast {
+	return &Broadcast{
+		cluster: cl,
+		token:   token,
+	}
+}
+
+// BroadcastHandler pushes the message requested to the clients of every instance which negotiated the broadcast
+// capability
+func (br *Broadcast) BroadcastHandler(c echo.Context) error {
+	if err := authorizeAdmin(c, br.token); err != nil {
+		return err
+	}
+
+	req := new(model.BroadcastRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+	if err := c.Validate(req); err != nil {
+		return err
+	}
+
+	payload, err := proto.Marshal(&messages.ServerBroadcast{
+		Type:    messages.MessageType_SERVER_BROADCAST,
+		Message: req.Message,
+	})
+	if err != nil {
+		return err
+	}
+	br.cluster.Broadcast(payload)
+	return c.NoContent(http.StatusAccepted)
+}
@@ -0,0 +1,64 @@
+package controller
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/penguin-statistics/probe/internal/app/model"
+	"github.com/penguin-statistics/probe/internal/app/repository"
+	"github.com/penguin-statistics/probe/internal/app/service"
+	"github.com/penguin-statistics/probe/internal/pkg/connlimit"
+)
+
+// OptOut is an opt-out service controller
+type OptOut struct {
+	sOptOut *service.OptOut
+	limiter *connlimit.Limiter
+}
+
+// NewOptOut creates an OptOut controller with service. Opt-outs are rate limited by limiter along with connections.
+func NewOptOut(sOptOut *service.OptOut, limiter *connlimit.Limiter) *OptOut {
+	return &OptOut{
+		sOptOut: sOptOut,
+		limiter: limiter,
+	}
+}
+
+// OptOutHandler opts the user out of being recorded and schedules the deletion of the sessions recorded for them.
+// It responds with the deletion job, whose status is reported by DeletionHandler.
+func (oc *OptOut) OptOutHandler(c echo.Context) error {
+	if ok, retryAfter := oc.limiter.Allow(c.RealIP()); !ok {
+		c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		return echo.NewHTTPError(http.StatusTooManyRequests, "too many requests")
+	}
+
+	req := new(model.OptOutRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+	if err := c.Validate(req); err != nil {
+		return err
+	}
+
+	d, err := oc.sOptOut.OptOut(c.Request().Context(), req.UID)
+	if err != nil {
+		return err
+	}
+	c.Response().Header().Set(echo.HeaderLocation, c.Path()+"/"+d.ID)
+	return c.JSON(http.StatusAccepted, d)
+}
+
+// DeletionHandler reports the status of a deletion job
+func (oc *OptOut) DeletionHandler(c echo.Context) error {
+	d, err := oc.sOptOut.Deletion(c.Request().Context(), c.Param("id"))
+	if err == repository.ErrNotFound {
+		return echo.NewHTTPError(http.StatusNotFound, "deletion not found")
+	}
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, d)
+}
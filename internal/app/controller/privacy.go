@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"context"
+
+	"github.com/penguin-statistics/probe/internal/app/model"
+	"github.com/penguin-statistics/probe/internal/app/service"
+	"github.com/penguin-statistics/probe/internal/pkg/dnt"
+)
+
+// recorder records a connection according to the policy the privacy signals of the connection are honored with.
+// Aggregate metrics are counted regardless of the policy. Rows are recorded as of the site of the connection.
+type recorder struct {
+	sBonjour *service.Bonjour
+	policy   string
+	site     string
+}
+
+// bonjour records b, without its UID if anonymous
+func (r *recorder) bonjour(ctx context.Context, b *model.Bonjour) error {
+	switch r.policy {
+	case dnt.PolicyAggregate:
+		return nil
+	case dnt.PolicyAnonymous:
+		anonymous := *b
+		anonymous.UID = ""
+		b = &anonymous
+	}
+	return r.sBonjour.RecordBonjour(ctx, b)
+}
+
+// flag records f, which classifies the bonjour only and is recorded as is if anonymous
+func (r *recorder) flag(ctx context.Context, f *model.BonjourFlag) error {
+	if r.policy == dnt.PolicyAggregate {
+		return nil
+	}
+	f.Site = r.site
+	return r.sBonjour.RecordBonjourFlag(ctx, f)
+}
+
+// impression records i, unlinked from its session if anonymous
+func (r *recorder) impression(ctx context.Context, i *model.Impression) error {
+	switch r.policy {
+	case dnt.PolicyAggregate:
+		return nil
+	case dnt.PolicyAnonymous:
+		anonymous := *i
+		anonymous.BonjourID = ""
+		i = &anonymous
+	}
+	i.Site = r.site
+	return r.sBonjour.RecordImpression(ctx, i)
+}
+
+// searchResultEntered records e, unlinked from its session if anonymous
+func (r *recorder) searchResultEntered(ctx context.Context, e *model.EventSearchResultEntered) error {
+	switch r.policy {
+	case dnt.PolicyAggregate:
+		return nil
+	case dnt.PolicyAnonymous:
+		anonymous := *e
+		anonymous.BonjourID = ""
+		e = &anonymous
+	}
+	e.Site = r.site
+	return r.sBonjour.RecordEventSearchResultEntered(ctx, e)
+}
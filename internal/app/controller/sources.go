@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/penguin-statistics/probe/internal/app/model"
+	"github.com/penguin-statistics/probe/internal/app/service"
+	"github.com/penguin-statistics/probe/internal/pkg/site"
+)
+
+const (
+	// defaultSourcesPeriod is the period top sources are reported for when since is not specified
+	defaultSourcesPeriod = 7 * 24 * time.Hour
+	// defaultSourcesLimit is the number of top sources reported when limit is not specified
+	defaultSourcesLimit = 20
+)
+
+// Sources is a controller reporting the sources landing sessions have been attributed to
+type Sources struct {
+	sBonjour *service.Bonjour
+	token    string
+}
+
+// NewSources creates a Sources controller with service. Requests shall carry token as a bearer token.
+func NewSources(sBonjour *service.Bonjour, token string) *Sources {
+	return &Sources{sBonjour: sBonjour, token: token}
+}
+
+// TopSourcesHandler reports the top sources of landing sessions, of the main site and of the last 7 days by default
+func (sc *Sources) TopSourcesHandler(c echo.Context) error {
+	if err := authorizeAdmin(c, sc.token); err != nil {
+		return err
+	}
+
+	req := new(model.SourcesRequest)
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+	if err := c.Validate(req); err != nil {
+		return err
+	}
+	if req.Until.IsZero() {
+		req.Until = time.Now()
+	}
+	if req.Since.IsZero() {
+		req.Since = req.Until.Add(-defaultSourcesPeriod)
+	}
+	if req.Site == "" {
+		req.Site = site.Main
+	}
+	if req.Limit == 0 {
+		req.Limit = defaultSourcesLimit
+	}
+	if !req.Since.Before(req.Until) {
+		return echo.NewHTTPError(http.StatusBadRequest, "since shall be before until")
+	}
+
+	sources, err := sc.sBonjour.TopSources(c.Request().Context(), req.Site, req.Since.UTC(), req.Until.UTC(), req.Limit)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, sources)
+}
@@ -0,0 +1,372 @@
+// Package loadgen generates load against a probe server by simulating visits described by a Scenario
+package loadgen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/dchest/uniuri"
+	"github.com/gorilla/websocket"
+	"golang.org/x/time/rate"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/penguin-statistics/probe/internal/pkg/messages"
+)
+
+// handshakeTimeout is the time allowed for a connection to be upgraded
+const handshakeTimeout = 10 * time.Second
+
+var (
+	paths    = []string{"/", "/search", "/result/stage/main/main_01-07", "/result/item/30012", "/planner", "/report", "/about"}
+	queries  = []string{"1-7", "固源岩", "manganese", "4-4", "装置"}
+	stageIDs = []string{"main_01-07", "main_04-04", "main_03-04"}
+	itemIDs  = []string{"30012", "30013", "30062"}
+)
+
+// Run generates load described by s until s.Duration has elapsed or ctx is done, and reports the outcome
+func Run(ctx context.Context, s Scenario) (*Report, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.Duration)
+	defer cancel()
+
+	g := &generator{
+		scenario:  s,
+		collector: newCollector(),
+		limiter:   rate.NewLimiter(rate.Limit(s.RPS), 1),
+	}
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < s.Connections; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// spread connections over the ramp linearly
+			delay := time.Duration(int64(s.Ramp) * int64(i) / int64(s.Connections))
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return
+			}
+			g.client(ctx, rand.New(rand.NewSource(time.Now().UnixNano()+int64(i))))
+		}(i)
+	}
+	wg.Wait()
+	return g.collector.report(s, time.Since(start)), nil
+}
+
+type generator struct {
+	scenario  Scenario
+	collector *collector
+	limiter   *rate.Limiter
+}
+
+// visit is a visit simulated across reconnects
+type visit struct {
+	uid        string
+	reconnects int
+	token      string
+}
+
+// client keeps simulating sessions until ctx is done
+func (g *generator) client(ctx context.Context, r *rand.Rand) {
+	v := &visit{uid: uniuri.NewLen(32)}
+	for ctx.Err() == nil {
+		length := g.scenario.Session.Min
+		if spread := g.scenario.Session.Max - g.scenario.Session.Min; spread > 0 {
+			length += time.Duration(r.Int63n(int64(spread)))
+		}
+		if !g.session(ctx, r, v, length) {
+			// back off from failed attempts rather than retrying in a tight loop
+			select {
+			case <-time.After(g.scenario.Reconnect.Delay):
+			case <-ctx.Done():
+			}
+			continue
+		}
+
+		if r.Float64() < g.scenario.Reconnect.Probability {
+			v.reconnects++
+			select {
+			case <-time.After(g.scenario.Reconnect.Delay):
+			case <-ctx.Done():
+			}
+		} else {
+			v = &visit{uid: uniuri.NewLen(32)}
+		}
+	}
+}
+
+// pending tracks messages waiting for their ACKs
+type pending struct {
+	mu    sync.Mutex
+	bySeq map[uint32]time.Time
+	queue []time.Time
+}
+
+// take removes the message acknowledged by an ACK of seq and returns when it has been sent
+func (p *pending) take(seq uint32) (time.Time, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if seq != 0 {
+		t, ok := p.bySeq[seq]
+		delete(p.bySeq, seq)
+		return t, ok
+	}
+	// ACKs of clients which do not speak seqack arrive in order
+	if len(p.queue) == 0 {
+		return time.Time{}, false
+	}
+	t := p.queue[0]
+	p.queue = p.queue[1:]
+	return t, true
+}
+
+func (p *pending) add(seq uint32, t time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if seq != 0 {
+		p.bySeq[seq] = t
+	} else {
+		p.queue = append(p.queue, t)
+	}
+}
+
+func (p *pending) len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.bySeq) + len(p.queue)
+}
+
+// session connects as v and sends messages for length. It returns false if the connection failed.
+func (g *generator) session(ctx context.Context, r *rand.Rand, v *visit, length time.Duration) bool {
+	s := g.scenario
+	q := url.Values{}
+	q.Set("v", "v3.4.1")
+	q.Set("p", "web")
+	q.Set("u", v.uid)
+	q.Set("r", paths[r.Intn(len(paths))])
+	q.Set("i", strconv.Itoa(v.reconnects))
+	if v.token != "" {
+		q.Set("t", v.token)
+	}
+	q.Set("c", s.Protocol.Capabilities)
+	subprotocol := "pb"
+	if s.Protocol.Version > 1 {
+		subprotocol = fmt.Sprintf("probe.v%d+pb", s.Protocol.Version)
+	}
+	d := websocket.Dialer{
+		Subprotocols:     []string{subprotocol},
+		HandshakeTimeout: handshakeTimeout,
+	}
+	ws, resp, err := d.DialContext(ctx, s.Endpoint+"?"+q.Encode(), nil)
+	if err != nil {
+		if !finished(ctx) {
+			g.collector.connected(classifyDial(resp, err), v.reconnects > 0, false)
+		}
+		return false
+	}
+	defer ws.Close()
+	v2 := ws.Subprotocol() != "pb" && ws.Subprotocol() != ""
+	seqack := v2 && hasCapability(s.Protocol.Capabilities, "seqack")
+
+	p := &pending{bySeq: make(map[uint32]time.Time)}
+	done := make(chan struct{})
+	sessions := make(chan *messages.ServerSession, 1)
+	var closing bool
+	var closingmu sync.Mutex
+	go func() {
+		defer close(done)
+		for {
+			_, b, err := ws.ReadMessage()
+			if err != nil {
+				closingmu.Lock()
+				if !closing {
+					g.collector.error(classifyRead(err))
+				}
+				closingmu.Unlock()
+				return
+			}
+			var ack messages.ServerACK
+			if err := proto.Unmarshal(b, &ack); err != nil {
+				g.collector.error("read: undecodable message")
+				continue
+			}
+			if ack.GetType() == messages.MessageType_SERVER_SESSION {
+				var session messages.ServerSession
+				if proto.Unmarshal(b, &session) == nil {
+					select {
+					case sessions <- &session:
+					default:
+					}
+				}
+				continue
+			}
+			rateLimited := ack.GetMessage() == "rate limited"
+			if ack.GetMessage() != "" && !rateLimited {
+				g.collector.error("server: " + ack.GetMessage())
+			}
+			if sent, ok := p.take(ack.GetSeq()); ok {
+				g.collector.acked(time.Since(sent), rateLimited)
+			}
+		}
+	}()
+
+	// the session announcement, if any, is the first message sent by the server
+	resumed := false
+	var seq uint32
+	if v2 && hasCapability(s.Protocol.Capabilities, "resume") {
+		select {
+		case session := <-sessions:
+			v.token = session.GetResumeToken()
+			resumed = session.GetResumed()
+			// continue the sequence of the resumed session, as the server drops messages of a sequence seen
+			seq = session.GetLastSeq()
+		case <-time.After(handshakeTimeout):
+		case <-done:
+		}
+	}
+	g.collector.connected("", v.reconnects > 0, resumed)
+
+	sctx, scancel := context.WithTimeout(ctx, length)
+	defer scancel()
+send:
+	for {
+		if err := g.limiter.Wait(sctx); err != nil {
+			break
+		}
+		select {
+		case <-done:
+			break send
+		default:
+		}
+		if seqack {
+			seq++
+		}
+		m, err := proto.Marshal(message(r, s.Mix, seq))
+		if err != nil {
+			panic(err)
+		}
+		p.add(seq, time.Now())
+		ws.SetWriteDeadline(time.Now().Add(handshakeTimeout))
+		if err := ws.WriteMessage(websocket.BinaryMessage, m); err != nil {
+			g.collector.error("write: " + classifyNet(err))
+			break
+		}
+		g.collector.sent()
+	}
+
+	// wait for outstanding ACKs before closing
+	grace := time.NewTimer(s.ACKTimeout)
+	defer grace.Stop()
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for p.len() > 0 {
+		select {
+		case <-ticker.C:
+			continue
+		case <-grace.C:
+		case <-done:
+		}
+		break
+	}
+	g.collector.unacked(p.len())
+
+	closingmu.Lock()
+	closing = true
+	closingmu.Unlock()
+	ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+	}
+	return true
+}
+
+// finished reports whether ctx is done, including the moment its deadline passes before ctx.Err() is set, so
+// attempts interrupted by the end of the run are not reported as failures
+func finished(ctx context.Context) bool {
+	if deadline, ok := ctx.Deadline(); ok && !time.Now().Before(deadline) {
+		return true
+	}
+	return ctx.Err() != nil
+}
+
+func hasCapability(capabilities, c string) bool {
+	for _, declared := range strings.Split(capabilities, ",") {
+		if strings.EqualFold(strings.TrimSpace(declared), c) {
+			return true
+		}
+	}
+	return false
+}
+
+// message creates a random message of the type picked by mix
+func message(r *rand.Rand, mix Mix, seq uint32) proto.Message {
+	meta := &messages.Meta{Language: messages.Language(r.Intn(4)), Seq: seq}
+	pick := r.Float64() * (mix.Navigation + mix.Search + mix.AdvancedQuery)
+	switch {
+	case pick < mix.Navigation:
+		meta.Type = messages.MessageType_NAVIGATED
+		return &messages.Navigated{Meta: meta, Path: paths[r.Intn(len(paths))]}
+	case pick < mix.Navigation+mix.Search:
+		meta.Type = messages.MessageType_ENTERED_SEARCH_RESULT
+		m := &messages.EnteredSearchResult{Meta: meta, Query: queries[r.Intn(len(queries))], Position: uint32(r.Intn(10))}
+		if r.Intn(2) == 0 {
+			m.Id = &messages.EnteredSearchResult_StageId{StageId: stageIDs[r.Intn(len(stageIDs))]}
+		} else {
+			m.Id = &messages.EnteredSearchResult_ItemId{ItemId: itemIDs[r.Intn(len(itemIDs))]}
+		}
+		return m
+	default:
+		meta.Type = messages.MessageType_EXECUTED_ADVANCED_QUERY
+		return &messages.ExecutedAdvancedQuery{Meta: meta, Queries: []*messages.ExecutedAdvancedQuery_AdvancedQuery{{
+			StageId: stageIDs[r.Intn(len(stageIDs))],
+			ItemIds: []string{itemIDs[r.Intn(len(itemIDs))]},
+			Server:  messages.Server(r.Intn(4)),
+		}}}
+	}
+}
+
+// classifyDial describes a failed connection attempt for the error breakdown
+func classifyDial(resp *http.Response, err error) string {
+	if resp != nil {
+		return fmt.Sprintf("dial: http %d", resp.StatusCode)
+	}
+	return "dial: " + classifyNet(err)
+}
+
+// classifyRead describes a connection closed unexpectedly for the error breakdown
+func classifyRead(err error) string {
+	var closeErr *websocket.CloseError
+	if errors.As(err, &closeErr) {
+		return fmt.Sprintf("closed: %d", closeErr.Code)
+	}
+	return "read: " + classifyNet(err)
+}
+
+func classifyNet(err error) string {
+	var netErr net.Error
+	switch {
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "connection refused"
+	case errors.Is(err, syscall.ECONNRESET):
+		return "connection reset"
+	case errors.Is(err, websocket.ErrBadHandshake):
+		return "bad handshake"
+	}
+	return "error"
+}
@@ -0,0 +1,94 @@
+package loadgen
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/penguin-statistics/probe/internal/pkg/messages"
+)
+
+// ackServer acknowledges every message received, and rejects visits of reconnecting clients
+func ackServer(t *testing.T) *httptest.Server {
+	upgrader := websocket.Upgrader{Subprotocols: []string{"probe.v2+pb", "pb"}}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("i") != "0" {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		for {
+			_, b, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			var s messages.Skeleton
+			if err := proto.Unmarshal(b, &s); err != nil {
+				t.Error("undecodable message sent", err)
+				return
+			}
+			ack, _ := proto.Marshal(&messages.ServerACK{Type: s.GetMeta().GetType(), Seq: s.GetMeta().GetSeq()})
+			if err := ws.WriteMessage(websocket.BinaryMessage, ack); err != nil {
+				return
+			}
+		}
+	}))
+}
+
+func TestRun(t *testing.T) {
+	server := ackServer(t)
+	defer server.Close()
+
+	s := DefaultScenario()
+	s.Endpoint = "ws" + strings.TrimPrefix(server.URL, "http")
+	s.Duration = 500 * time.Millisecond
+	s.Connections = 5
+	s.Ramp = 100 * time.Millisecond
+	s.Session = Range{Min: 100 * time.Millisecond, Max: 200 * time.Millisecond}
+	s.RPS = 200
+	s.Reconnect = Reconnect{Probability: 1, Delay: 10 * time.Millisecond}
+	s.Protocol.Capabilities = "seqack"
+
+	report, err := Run(context.Background(), s)
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	c, m := report.Connections, report.Messages
+	if c.Succeeded != 5 || c.Failed == 0 || c.Attempted != c.Succeeded+c.Failed {
+		t.Error("expect 5 connections succeeded and reconnects rejected, got", c)
+	}
+	if report.Errors["dial: http 429"] != c.Failed {
+		t.Error("expect failed connections broken down by status, got", report.Errors)
+	}
+	if m.Sent == 0 || m.Acked != m.Sent || m.Unacked != 0 {
+		t.Error("expect every message sent acknowledged, got", m)
+	}
+	if report.ACKLatency.P50 <= 0 || report.ACKLatency.P99 < report.ACKLatency.P50 || report.ACKLatency.Max < report.ACKLatency.P99 {
+		t.Error("expect ordered latency percentiles, got", report.ACKLatency)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	var samples []time.Duration
+	for i := 1; i <= 100; i++ {
+		samples = append(samples, time.Duration(i))
+	}
+	for p, expected := range map[float64]time.Duration{0.5: 50, 0.9: 90, 0.99: 99, 1: 100} {
+		if actual := percentile(samples, p); actual != expected {
+			t.Error("expect percentile", p, "to be", expected, "got", actual)
+		}
+	}
+	if percentile(nil, 0.5) != 0 {
+		t.Error("expect zero percentile of no samples")
+	}
+}
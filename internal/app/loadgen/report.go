@@ -0,0 +1,204 @@
+package loadgen
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// maxSamples is the amount of ACK latencies sampled to calculate percentiles from
+const maxSamples = 100000
+
+// Report is the outcome of a load run
+type Report struct {
+	Scenario    Scenario          `json:"scenario"`
+	Elapsed     float64           `json:"elapsedSeconds"`
+	Connections ConnectionStats   `json:"connections"`
+	Messages    MessageStats      `json:"messages"`
+	ACKLatency  Percentiles       `json:"ackLatencyMs"`
+	Errors      map[string]uint64 `json:"errors"`
+}
+
+// ConnectionStats are the connection attempts made
+type ConnectionStats struct {
+	Attempted   uint64  `json:"attempted"`
+	Succeeded   uint64  `json:"succeeded"`
+	Failed      uint64  `json:"failed"`
+	SuccessRate float64 `json:"successRate"`
+	Reconnects  uint64  `json:"reconnects"`
+	Resumed     uint64  `json:"resumed"`
+}
+
+// MessageStats are the messages sent and acknowledged
+type MessageStats struct {
+	Sent        uint64  `json:"sent"`
+	Acked       uint64  `json:"acked"`
+	RateLimited uint64  `json:"rateLimited"`
+	Unacked     uint64  `json:"unacked"`
+	RPS         float64 `json:"rps"`
+}
+
+// Percentiles of a latency distribution in milliseconds
+type Percentiles struct {
+	P50 float64 `json:"p50"`
+	P90 float64 `json:"p90"`
+	P95 float64 `json:"p95"`
+	P99 float64 `json:"p99"`
+	Max float64 `json:"max"`
+}
+
+// WriteSummary writes a human-readable summary of r to w
+func (r *Report) WriteSummary(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	c, m, l := r.Connections, r.Messages, r.ACKLatency
+	fmt.Fprintf(tw, "elapsed\t%.1fs\n", r.Elapsed)
+	fmt.Fprintf(tw, "connections\t%d attempted, %d succeeded, %d failed (%.2f%% success)\n", c.Attempted, c.Succeeded, c.Failed, c.SuccessRate*100)
+	fmt.Fprintf(tw, "reconnects\t%d, %d resumed\n", c.Reconnects, c.Resumed)
+	fmt.Fprintf(tw, "messages\t%d sent, %d acked, %d rate limited, %d unacked (%.1f/s)\n", m.Sent, m.Acked, m.RateLimited, m.Unacked, m.RPS)
+	fmt.Fprintf(tw, "ack latency\tp50 %.2fms, p90 %.2fms, p95 %.2fms, p99 %.2fms, max %.2fms\n", l.P50, l.P90, l.P95, l.P99, l.Max)
+	if len(r.Errors) > 0 {
+		fmt.Fprintln(tw, "\nerror\tcount")
+		reasons := make([]string, 0, len(r.Errors))
+		for reason := range r.Errors {
+			reasons = append(reasons, reason)
+		}
+		sort.Slice(reasons, func(i, j int) bool {
+			return r.Errors[reasons[i]] > r.Errors[reasons[j]]
+		})
+		for _, reason := range reasons {
+			fmt.Fprintf(tw, "%s\t%d\n", reason, r.Errors[reason])
+		}
+	}
+	return tw.Flush()
+}
+
+// collector collects the outcome of a run from all connections
+type collector struct {
+	mu          sync.Mutex
+	connections ConnectionStats
+	messages    MessageStats
+	errors      map[string]uint64
+	samples     []time.Duration
+	observed    int64
+	max         time.Duration
+	rand        *rand.Rand
+}
+
+func newCollector() *collector {
+	return &collector{
+		errors: make(map[string]uint64),
+		rand:   rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+func (c *collector) connected(err string, reconnect, resumed bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.connections.Attempted++
+	if err != "" {
+		c.connections.Failed++
+		c.errors[err]++
+		return
+	}
+	c.connections.Succeeded++
+	if reconnect {
+		c.connections.Reconnects++
+	}
+	if resumed {
+		c.connections.Resumed++
+	}
+}
+
+func (c *collector) error(err string) {
+	c.mu.Lock()
+	c.errors[err]++
+	c.mu.Unlock()
+}
+
+func (c *collector) sent() {
+	c.mu.Lock()
+	c.messages.Sent++
+	c.mu.Unlock()
+}
+
+func (c *collector) unacked(n int) {
+	c.mu.Lock()
+	c.messages.Unacked += uint64(n)
+	c.mu.Unlock()
+}
+
+// acked records an ACK received latency after the message had been sent
+func (c *collector) acked(latency time.Duration, rateLimited bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.messages.Acked++
+	if rateLimited {
+		c.messages.RateLimited++
+	}
+	if latency > c.max {
+		c.max = latency
+	}
+	// reservoir sampling keeps the percentiles unbiased with a bounded memory
+	c.observed++
+	if len(c.samples) < maxSamples {
+		c.samples = append(c.samples, latency)
+	} else if i := c.rand.Int63n(c.observed); i < maxSamples {
+		c.samples[i] = latency
+	}
+}
+
+func (c *collector) report(s Scenario, elapsed time.Duration) *Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	r := &Report{
+		Scenario:    s,
+		Elapsed:     elapsed.Seconds(),
+		Connections: c.connections,
+		Messages:    c.messages,
+		Errors:      make(map[string]uint64, len(c.errors)),
+	}
+	for reason, n := range c.errors {
+		r.Errors[reason] = n
+	}
+	if r.Connections.Attempted > 0 {
+		r.Connections.SuccessRate = float64(r.Connections.Succeeded) / float64(r.Connections.Attempted)
+	}
+	if elapsed > 0 {
+		r.Messages.RPS = float64(r.Messages.Sent) / elapsed.Seconds()
+	}
+
+	samples := append([]time.Duration(nil), c.samples...)
+	sort.Slice(samples, func(i, j int) bool {
+		return samples[i] < samples[j]
+	})
+	r.ACKLatency = Percentiles{
+		P50: milliseconds(percentile(samples, 0.5)),
+		P90: milliseconds(percentile(samples, 0.9)),
+		P95: milliseconds(percentile(samples, 0.95)),
+		P99: milliseconds(percentile(samples, 0.99)),
+		Max: milliseconds(c.max),
+	}
+	return r
+}
+
+// percentile returns the p-th percentile of sorted samples with the nearest-rank method
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
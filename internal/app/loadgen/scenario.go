@@ -0,0 +1,116 @@
+package loadgen
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Scenario describes the load to generate
+type Scenario struct {
+	// Endpoint is the websocket url of the probe server
+	Endpoint string `yaml:"endpoint" json:"endpoint"`
+	// Duration is the length of the run
+	Duration time.Duration `yaml:"duration" json:"duration"`
+	// Connections is the amount of concurrent connections to keep once ramped up
+	Connections int `yaml:"connections" json:"connections"`
+	// Ramp is the time to open Connections over, linearly
+	Ramp time.Duration `yaml:"ramp" json:"ramp"`
+	// Session is the length of each session, uniformly distributed between Min and Max
+	Session Range `yaml:"session" json:"session"`
+	// RPS is the messages sent per second across all connections
+	RPS float64 `yaml:"rps" json:"rps"`
+	// Mix is the relative weights of the messages sent
+	Mix Mix `yaml:"mix" json:"mix"`
+	// Reconnect is the behavior once a session ends
+	Reconnect Reconnect `yaml:"reconnect" json:"reconnect"`
+	// Protocol is the protocol revision and capabilities to negotiate
+	Protocol Protocol `yaml:"protocol" json:"protocol"`
+	// ACKTimeout is the time to wait for ACKs of messages sent once a session ends
+	ACKTimeout time.Duration `yaml:"ackTimeout" json:"ackTimeout"`
+}
+
+// Range is a range of durations
+type Range struct {
+	Min time.Duration `yaml:"min" json:"min"`
+	Max time.Duration `yaml:"max" json:"max"`
+}
+
+// Mix is the relative weights of message types
+type Mix struct {
+	Navigation    float64 `yaml:"navigation" json:"navigation"`
+	Search        float64 `yaml:"search" json:"search"`
+	AdvancedQuery float64 `yaml:"advancedQuery" json:"advancedQuery"`
+}
+
+// Reconnect describes how clients behave once their session ends
+type Reconnect struct {
+	// Probability is the chance of reconnecting as the same visit instead of starting a new one
+	Probability float64 `yaml:"probability" json:"probability"`
+	// Delay is the time to wait before reconnecting
+	Delay time.Duration `yaml:"delay" json:"delay"`
+}
+
+// Protocol is the protocol revision and capabilities to negotiate
+type Protocol struct {
+	Version      int    `yaml:"version" json:"version"`
+	Capabilities string `yaml:"capabilities" json:"capabilities"`
+}
+
+// DefaultScenario returns the scenario used for settings not specified
+func DefaultScenario() Scenario {
+	return Scenario{
+		Endpoint:    "ws://localhost:8100/",
+		Duration:    time.Minute,
+		Connections: 1000,
+		Ramp:        10 * time.Second,
+		Session:     Range{Min: 10 * time.Second, Max: time.Minute},
+		RPS:         100,
+		Mix:         Mix{Navigation: 0.7, Search: 0.2, AdvancedQuery: 0.1},
+		Reconnect:   Reconnect{Probability: 0.3, Delay: time.Second},
+		Protocol:    Protocol{Version: 2, Capabilities: "seqack,resume"},
+		ACKTimeout:  5 * time.Second,
+	}
+}
+
+// LoadScenario reads a scenario from a YAML file over DefaultScenario
+func LoadScenario(file string) (Scenario, error) {
+	s := DefaultScenario()
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return s, err
+	}
+	if err := yaml.Unmarshal(b, &s); err != nil {
+		return s, err
+	}
+	return s, nil
+}
+
+// Validate checks the scenario for settings which can't be run
+func (s Scenario) Validate() error {
+	switch {
+	case s.Endpoint == "":
+		return errors.New("endpoint is required")
+	case s.Duration <= 0:
+		return errors.New("duration shall be positive")
+	case s.Connections <= 0:
+		return errors.New("connections shall be positive")
+	case s.Ramp < 0:
+		return errors.New("ramp shall not be negative")
+	case s.Session.Min <= 0 || s.Session.Max < s.Session.Min:
+		return errors.New("session shall be a positive range")
+	case s.RPS <= 0:
+		return errors.New("rps shall be positive")
+	case s.Mix.Navigation < 0 || s.Mix.Search < 0 || s.Mix.AdvancedQuery < 0:
+		return errors.New("mix weights shall not be negative")
+	case s.Mix.Navigation+s.Mix.Search+s.Mix.AdvancedQuery <= 0:
+		return errors.New("at least one mix weight shall be positive")
+	case s.Reconnect.Probability < 0 || s.Reconnect.Probability > 1:
+		return errors.New("reconnect probability shall be between 0 and 1")
+	case s.Protocol.Version != 1 && s.Protocol.Version != 2:
+		return errors.New("protocol version shall be 1 or 2")
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package model
 
 import (
 	"github.com/penguin-statistics/probe/densemver"
+	"github.com/penguin-statistics/probe/internal/pkg/botdetect"
 )
 
 // Bonjour is a bonjour request in which the client initiates request with basic params
@@ -13,6 +14,38 @@ type Bonjour struct {
 	UID      string               `query:"u" valid:"stringlength(32|32),alphanum"`
 	Legacy   uint8                `query:"l"`
 
-	Referer    string `query:"r"`
-	Reconnects int    `query:"i"`
+	Referer string `query:"r"`
+	// DocumentReferrer is the referrer of the page landed on, i.e. document.referrer for the web
+	DocumentReferrer string `query:"dr"`
+	Reconnects       int    `query:"i"`
+	ResumeToken      string `query:"t"`
+
+	// ProtocolVersion and Capabilities are for clients which are not able to negotiate them with subprotocols
+	ProtocolVersion int    `query:"pv"`
+	Capabilities    string `query:"c"`
+
+	// SiteKey is the key of the site the client belongs to, if other than the main site
+	SiteKey string `query:"s"`
+
+	// DoNotTrack is the privacy signal of apps, which are not able to send DNT or Sec-GPC headers
+	DoNotTrack bool `query:"dnt"`
+
+	// Site is the ID of the site of SiteKey
+	Site string
+	// Classification is determined from the request headers at bonjour time
+	Classification botdetect.Classification
+	// Country is the ISO code of the country the client address is located in, if resolved. The address itself is never kept.
+	Country string
+	// Browser, BrowserVersion, OS and Device are parsed from the User-Agent, which itself is never kept
+	Browser        string
+	BrowserVersion uint16
+	OS             string
+	Device         string
+	// UTMSource, UTMMedium, UTMCampaign, ReferrerDomain and ReferrerClass attribute landing sessions, i.e. of no
+	// reconnects, to campaigns and to referrers. They are left empty for the other sessions.
+	UTMSource      string
+	UTMMedium      string
+	UTMCampaign    string
+	ReferrerDomain string
+	ReferrerClass  string
 }
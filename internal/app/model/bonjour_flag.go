@@ -0,0 +1,12 @@
+package model
+
+import "github.com/penguin-statistics/probe/internal/pkg/botdetect"
+
+// BonjourFlag is a classification of a bonjour made after the bonjour has been recorded,
+// e.g. from behavioral signals collected throughout the session
+type BonjourFlag struct {
+	BonjourID      string
+	Site           string
+	Classification botdetect.Classification
+	Reason         string
+}
@@ -0,0 +1,6 @@
+package model
+
+// BroadcastRequest is a request of an admin to push a message to the clients connected to the whole cluster
+type BroadcastRequest struct {
+	Message string `form:"message" json:"message" valid:"required,runelength(1|512)"`
+}
@@ -0,0 +1,8 @@
+package model
+
+// ClusterLive is the amount of clients connected to the whole cluster, as reported by node
+type ClusterLive struct {
+	Node   string         `json:"node"`
+	Live   int            `json:"live"`
+	Routes map[string]int `json:"routes"`
+}
@@ -0,0 +1,35 @@
+package model
+
+import "time"
+
+// DeletionStatus is the progress of a Deletion
+type DeletionStatus string
+
+const (
+	// DeletionPending is a deletion which has not been started yet
+	DeletionPending DeletionStatus = "pending"
+	// DeletionRunning is a deletion which has been started but not completed, e.g. interrupted by a restart
+	DeletionRunning DeletionStatus = "running"
+	// DeletionDone is a deletion completed in all tables
+	DeletionDone DeletionStatus = "done"
+	// DeletionFailed is a deletion which failed on its last attempt. It is retried later.
+	DeletionFailed DeletionStatus = "failed"
+)
+
+// Deletion is a job deleting the sessions recorded for a user who opted out, along with their events
+type Deletion struct {
+	ID string `json:"id"`
+	// UIDs are the pseudonyms the sessions of the user have been recorded with
+	UIDs   []string       `json:"-"`
+	Status DeletionStatus `json:"status"`
+	// Tables are the tables the sessions have been deleted from so far
+	Tables    []string  `json:"tables"`
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// OptOutRequest is a request of a user to opt out of being recorded
+type OptOutRequest struct {
+	UID string `form:"u" json:"u" valid:"required,stringlength(32|32),alphanum"`
+}
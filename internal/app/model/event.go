@@ -1,9 +1,13 @@
 package model
 
 type EventSearchResultEntered struct {
-	ID             string
-	BonjourID      string
-	Query          string
+	ID        string
+	BonjourID string
+	Site      string
+	// Query is the query normalized and redacted of PII
+	Query string
+	// QueryRaw is the query as reported, truncated, if allowed and nothing has been redacted from it
+	QueryRaw       string
 	ResultPosition uint32
 	Destination    string
 }
@@ -4,5 +4,6 @@ package model
 type Impression struct {
 	ID        string
 	BonjourID string
+	Site      string
 	Path      string
 }
@@ -0,0 +1,20 @@
+package model
+
+import "time"
+
+// Source is a source landing sessions have been attributed to
+type Source struct {
+	// Class is the class of the referrers, as of attribution
+	Class string `json:"class"`
+	// Source is the utm_source of the landings if any, or else the domain of their referrer
+	Source   string `json:"source"`
+	Sessions uint64 `json:"sessions"`
+}
+
+// SourcesRequest is a request of the top sources of landing sessions of Site created within [Since, Until)
+type SourcesRequest struct {
+	Site  string    `query:"site"`
+	Since time.Time `query:"since"`
+	Until time.Time `query:"until"`
+	Limit int       `query:"limit" valid:"range(0|100)"`
+}
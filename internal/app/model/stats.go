@@ -0,0 +1,29 @@
+package model
+
+import "time"
+
+// Stats is a summary of the traffic recorded since a point of time
+type Stats struct {
+	Since time.Time
+	// Users is the amount of human bonjours recorded in total
+	Users uint64
+	// Bonjours is the amount of bonjours recorded since, partitioned by platform and classification
+	Bonjours []BonjourCount
+	// Impressions is the amount of impressions recorded since
+	Impressions uint64
+	// TopPaths are the paths with the most impressions recorded since
+	TopPaths []PathCount
+}
+
+// BonjourCount is the amount of bonjours of a platform and classification
+type BonjourCount struct {
+	Platform       string
+	Classification string
+	Count          uint64
+}
+
+// PathCount is the amount of impressions of a path
+type PathCount struct {
+	Path  string
+	Count uint64
+}
@@ -2,47 +2,239 @@ package repository
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"time"
 
 	"github.com/ClickHouse/clickhouse-go/v2"
 	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
-	"github.com/spf13/viper"
+
+	"github.com/penguin-statistics/probe/internal/app/config"
+	"github.com/penguin-statistics/probe/internal/app/model"
+	"github.com/penguin-statistics/probe/internal/pkg/site"
+	"github.com/penguin-statistics/probe/internal/pkg/version"
 )
 
-// Probe describes a repository which holds probe requests
+// Store stores probe requests
+type Store interface {
+	// InsertBonjour adds a bonjour request
+	InsertBonjour(ctx context.Context, b *model.Bonjour) error
+	// InsertBonjourFlag adds a late classification of a bonjour
+	InsertBonjourFlag(ctx context.Context, f *model.BonjourFlag) error
+	// InsertImpression adds a view of a resource
+	InsertImpression(ctx context.Context, i *model.Impression) error
+	// InsertEventSearchResultEntered adds a search result entered event
+	InsertEventSearchResultEntered(ctx context.Context, e *model.EventSearchResultEntered) error
+	// InsertOptOut adds the hash of the UID of a user who opted out
+	InsertOptOut(ctx context.Context, uidHash string) error
+	// OptOuts returns the hashes of the UIDs of all users who opted out
+	OptOuts(ctx context.Context) ([]string, error)
+	// SaveDeletion adds or updates a deletion job
+	SaveDeletion(ctx context.Context, d *model.Deletion) error
+	// Deletion returns the deletion job by id, or ErrNotFound
+	Deletion(ctx context.Context, id string) (*model.Deletion, error)
+	// PendingDeletions returns the deletion jobs which have not been completed
+	PendingDeletions(ctx context.Context) ([]*model.Deletion, error)
+	// EventTables returns the tables which hold records referencing a bonjour, i.e. having a bonjour_id column
+	EventTables(ctx context.Context) ([]string, error)
+	// DeleteEvents deletes the records in table referencing the bonjours of uids
+	DeleteEvents(ctx context.Context, table string, uids []string) error
+	// DeleteBonjours deletes the bonjours of uids
+	DeleteBonjours(ctx context.Context, uids []string) error
+	// CountUsers counts the bonjour requests of the main site which have not been flagged as bot or suspect
+	CountUsers(ctx context.Context) (uint64, error)
+	// TopSources returns the sources the most landing sessions of site created within [since, until) have been
+	// attributed to, up to limit. Sessions flagged as bot or suspect are not counted.
+	TopSources(ctx context.Context, site string, since, until time.Time, limit int) ([]model.Source, error)
+	// Ping checks whether the store is reachable
+	Ping(ctx context.Context) error
+	// Close closes the store
+	Close() error
+}
+
+// ErrNotFound is returned when the record requested does not exist
+var ErrNotFound = errors.New("not found")
+
+// Probe describes a repository which holds probe requests in ClickHouse
 type Probe struct {
 	DB driver.Conn
 }
 
-// NewProbe returns a repository with probe requests
-func NewProbe() *Probe {
+// NewProbe returns a repository with probe requests stored in the ClickHouse configured by conf
+func NewProbe(conf *config.Config) (*Probe, error) {
+	db, err := open(conf, conf.ClickHouse.Database)
+	if err != nil {
+		return nil, err
+	}
+	return &Probe{
+		DB: db,
+	}, nil
+}
+
+// open connects to database of the ClickHouse configured by conf
+func open(conf *config.Config, database string) (driver.Conn, error) {
 	db, err := clickhouse.Open(&clickhouse.Options{
-		Addr: viper.GetStringSlice("clickhouse.addr"),
+		Addr: conf.ClickHouse.Addr,
 		Auth: clickhouse.Auth{
-			Database: viper.GetString("clickhouse.database"),
-			Username: viper.GetString("clickhouse.user"),
-			Password: viper.GetString("clickhouse.password"),
+			Database: database,
+			Username: conf.ClickHouse.User,
+			Password: conf.ClickHouse.Password,
 		},
-		Debug:       viper.GetBool("app.debug"),
+		Debug:       conf.App.Debug,
 		DialTimeout: time.Second * 20,
 		ClientInfo: clickhouse.ClientInfo{
 			Products: []struct {
 				Name    string
 				Version string
 			}{
-				{Name: "penguin-statistics/probe", Version: "0.1.0"},
+				{Name: "penguin-statistics/probe", Version: version.Version},
 			},
 		},
 	})
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	err = db.Ping(context.Background())
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	return &Probe{
-		DB: db,
+	return db, nil
+}
+
+// InsertBonjour implements Store
+func (r *Probe) InsertBonjour(ctx context.Context, b *model.Bonjour) error {
+	return r.DB.Exec(ctx, "insert into bonjours (id, created_at, version, platform, uid, legacy, classification, country, browser, browser_version, os, device, utm_source, utm_medium, utm_campaign, referrer_domain, referrer_class, site) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", b.ID, time.Now().Format("2006-01-02 15:04:05"), b.Version, b.Platform, b.UID, b.Legacy, b.Classification, b.Country, b.Browser, b.BrowserVersion, b.OS, b.Device, b.UTMSource, b.UTMMedium, b.UTMCampaign, b.ReferrerDomain, b.ReferrerClass, b.Site)
+}
+
+// InsertBonjourFlag implements Store
+func (r *Probe) InsertBonjourFlag(ctx context.Context, f *model.BonjourFlag) error {
+	return r.DB.Exec(ctx, "insert into bonjour_flags (bonjour_id, site, classification, reason) values (?, ?, ?, ?)", f.BonjourID, f.Site, f.Classification, f.Reason)
+}
+
+// InsertImpression implements Store
+func (r *Probe) InsertImpression(ctx context.Context, i *model.Impression) error {
+	return r.DB.Exec(ctx, "insert into impressions (id, bonjour_id, site, path) values (?, ?, ?, ?)", i.ID, i.BonjourID, i.Site, i.Path)
+}
+
+// InsertEventSearchResultEntered implements Store
+func (r *Probe) InsertEventSearchResultEntered(ctx context.Context, e *model.EventSearchResultEntered) error {
+	return r.DB.Exec(ctx, "insert into event_search_result_entered (id, bonjour_id, site, query, query_raw, result_position, destination) values (?, ?, ?, ?, ?, ?, ?)", e.ID, e.BonjourID, e.Site, e.Query, e.QueryRaw, e.ResultPosition, e.Destination)
+}
+
+// InsertOptOut implements Store
+func (r *Probe) InsertOptOut(ctx context.Context, uidHash string) error {
+	return r.DB.Exec(ctx, "insert into opt_outs (uid_hash) values (?)", uidHash)
+}
+
+// OptOuts implements Store
+func (r *Probe) OptOuts(ctx context.Context) ([]string, error) {
+	var hashes []string
+	if err := r.DB.Select(ctx, &hashes, "select distinct uid_hash from opt_outs"); err != nil {
+		return nil, err
 	}
+	return hashes, nil
+}
+
+// SaveDeletion implements Store
+func (r *Probe) SaveDeletion(ctx context.Context, d *model.Deletion) error {
+	return r.DB.Exec(ctx, "insert into deletions (id, uids, status, tables, error, created_at, updated_at) values (?, ?, ?, ?, ?, ?, ?)", d.ID, d.UIDs, string(d.Status), d.Tables, d.Error, d.CreatedAt, d.UpdatedAt)
+}
+
+// deletionColumns are the columns scanned by scanDeletion
+const deletionColumns = "id, uids, status, tables, error, created_at, updated_at"
+
+func scanDeletion(row interface {
+	Scan(dest ...interface{}) error
+}) (*model.Deletion, error) {
+	var d model.Deletion
+	var status string
+	if err := row.Scan(&d.ID, &d.UIDs, &status, &d.Tables, &d.Error, &d.CreatedAt, &d.UpdatedAt); err != nil {
+		return nil, err
+	}
+	d.Status = model.DeletionStatus(status)
+	return &d, nil
+}
+
+// Deletion implements Store
+func (r *Probe) Deletion(ctx context.Context, id string) (*model.Deletion, error) {
+	d, err := scanDeletion(r.DB.QueryRow(ctx, "select "+deletionColumns+" from deletions final where id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return d, err
+}
+
+// PendingDeletions implements Store
+func (r *Probe) PendingDeletions(ctx context.Context) ([]*model.Deletion, error) {
+	rows, err := r.DB.Query(ctx, "select "+deletionColumns+" from deletions final where status != ? order by id", string(model.DeletionDone))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ds []*model.Deletion
+	for rows.Next() {
+		d, err := scanDeletion(rows)
+		if err != nil {
+			return nil, err
+		}
+		ds = append(ds, d)
+	}
+	return ds, rows.Err()
+}
+
+// EventTables implements Store
+func (r *Probe) EventTables(ctx context.Context) ([]string, error) {
+	var tables []string
+	if err := r.DB.Select(ctx, &tables, "select table from system.columns where database = currentDatabase() and name = 'bonjour_id' order by table"); err != nil {
+		return nil, err
+	}
+	return tables, nil
+}
+
+// DeleteEvents implements Store with a lightweight delete
+func (r *Probe) DeleteEvents(ctx context.Context, table string, uids []string) error {
+	return r.DB.Exec(ctx, "delete from "+quoteIdentifier(table)+" where bonjour_id in (select id from bonjours where has(?, uid))", uids)
+}
+
+// DeleteBonjours implements Store with a lightweight delete
+func (r *Probe) DeleteBonjours(ctx context.Context, uids []string) error {
+	return r.DB.Exec(ctx, "delete from bonjours where has(?, uid)", uids)
+}
+
+// CountUsers implements Store
+func (r *Probe) CountUsers(ctx context.Context) (uint64, error) {
+	var count uint64
+	if err := r.DB.QueryRow(ctx, "select count(*) from bonjours where site = ? and classification = 0 and id not in (select bonjour_id from bonjour_flags)", site.Main).Scan(&count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// TopSources implements Store
+func (r *Probe) TopSources(ctx context.Context, site string, since, until time.Time, limit int) ([]model.Source, error) {
+	rows, err := r.DB.Query(ctx, "select referrer_class, if(utm_source != '', utm_source, referrer_domain) as source, count(*) as sessions from bonjours where site = ? and referrer_class != '' and created_at >= ? and created_at < ? and classification = 0 and id not in (select bonjour_id from bonjour_flags) group by referrer_class, source order by sessions desc, referrer_class, source limit ?", site, since, until, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	sources := []model.Source{}
+	for rows.Next() {
+		var s model.Source
+		if err := rows.Scan(&s.Class, &s.Source, &s.Sessions); err != nil {
+			return nil, err
+		}
+		sources = append(sources, s)
+	}
+	return sources, rows.Err()
+}
+
+// Ping implements Store
+func (r *Probe) Ping(ctx context.Context) error {
+	return r.DB.Exec(ctx, "SELECT 1")
+}
+
+// Close implements Store
+func (r *Probe) Close() error {
+	return r.DB.Close()
 }
@@ -0,0 +1,320 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+
+	"github.com/penguin-statistics/probe/internal/app/model"
+	"github.com/penguin-statistics/probe/internal/pkg/botdetect"
+	"github.com/penguin-statistics/probe/internal/pkg/site"
+)
+
+// ErrClosed is returned by a Memory store which has been closed
+var ErrClosed = errors.New("store closed")
+
+// Memory is a Store which holds probe requests in memory, e.g. for tests and local development
+type Memory struct {
+	mu          sync.Mutex
+	closed      bool
+	bonjours    []model.Bonjour
+	flags       []model.BonjourFlag
+	impressions []model.Impression
+	events      []model.EventSearchResultEntered
+	optOuts     map[string]struct{}
+	deletions   map[string]model.Deletion
+}
+
+// NewMemory creates an empty Memory store
+func NewMemory() *Memory {
+	return &Memory{
+		optOuts:   make(map[string]struct{}),
+		deletions: make(map[string]model.Deletion),
+	}
+}
+
+// insert runs f under the lock unless the store has been closed
+func (m *Memory) insert(f func()) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+	f()
+	return nil
+}
+
+// InsertBonjour implements Store
+func (m *Memory) InsertBonjour(_ context.Context, b *model.Bonjour) error {
+	return m.insert(func() { m.bonjours = append(m.bonjours, *b) })
+}
+
+// InsertBonjourFlag implements Store
+func (m *Memory) InsertBonjourFlag(_ context.Context, f *model.BonjourFlag) error {
+	return m.insert(func() { m.flags = append(m.flags, *f) })
+}
+
+// InsertImpression implements Store
+func (m *Memory) InsertImpression(_ context.Context, i *model.Impression) error {
+	return m.insert(func() { m.impressions = append(m.impressions, *i) })
+}
+
+// InsertEventSearchResultEntered implements Store
+func (m *Memory) InsertEventSearchResultEntered(_ context.Context, e *model.EventSearchResultEntered) error {
+	return m.insert(func() { m.events = append(m.events, *e) })
+}
+
+// InsertOptOut implements Store
+func (m *Memory) InsertOptOut(_ context.Context, uidHash string) error {
+	return m.insert(func() { m.optOuts[uidHash] = struct{}{} })
+}
+
+// OptOuts implements Store
+func (m *Memory) OptOuts(context.Context) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	hashes := make([]string, 0, len(m.optOuts))
+	for hash := range m.optOuts {
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+	return hashes, nil
+}
+
+// copyDeletion copies d so that the slices of a deletion stored are never shared
+func copyDeletion(d model.Deletion) *model.Deletion {
+	d.UIDs = append([]string(nil), d.UIDs...)
+	d.Tables = append([]string(nil), d.Tables...)
+	return &d
+}
+
+// SaveDeletion implements Store
+func (m *Memory) SaveDeletion(_ context.Context, d *model.Deletion) error {
+	return m.insert(func() { m.deletions[d.ID] = *copyDeletion(*d) })
+}
+
+// Deletion implements Store
+func (m *Memory) Deletion(_ context.Context, id string) (*model.Deletion, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d, ok := m.deletions[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return copyDeletion(d), nil
+}
+
+// PendingDeletions implements Store
+func (m *Memory) PendingDeletions(context.Context) ([]*model.Deletion, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var ds []*model.Deletion
+	for _, d := range m.deletions {
+		if d.Status != model.DeletionDone {
+			ds = append(ds, copyDeletion(d))
+		}
+	}
+	sort.Slice(ds, func(i, j int) bool {
+		return ds[i].ID < ds[j].ID
+	})
+	return ds, nil
+}
+
+// memoryEventTables are the tables of a Memory store referencing bonjours
+var memoryEventTables = []string{"bonjour_flags", "event_search_result_entered", "impressions"}
+
+// EventTables implements Store
+func (m *Memory) EventTables(context.Context) ([]string, error) {
+	return append([]string(nil), memoryEventTables...), nil
+}
+
+// bonjourIDs returns the ids of the bonjours of uids
+func (m *Memory) bonjourIDs(uids []string) map[string]struct{} {
+	match := make(map[string]struct{}, len(uids))
+	for _, uid := range uids {
+		match[uid] = struct{}{}
+	}
+	ids := make(map[string]struct{})
+	for _, b := range m.bonjours {
+		if _, ok := match[b.UID]; ok {
+			ids[b.ID] = struct{}{}
+		}
+	}
+	return ids
+}
+
+// DeleteEvents implements Store
+func (m *Memory) DeleteEvents(_ context.Context, table string, uids []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+	ids := m.bonjourIDs(uids)
+	deleted := func(bonjourID string) bool {
+		_, ok := ids[bonjourID]
+		return ok
+	}
+	switch table {
+	case "bonjour_flags":
+		kept := m.flags[:0]
+		for _, f := range m.flags {
+			if !deleted(f.BonjourID) {
+				kept = append(kept, f)
+			}
+		}
+		m.flags = kept
+	case "event_search_result_entered":
+		kept := m.events[:0]
+		for _, e := range m.events {
+			if !deleted(e.BonjourID) {
+				kept = append(kept, e)
+			}
+		}
+		m.events = kept
+	case "impressions":
+		kept := m.impressions[:0]
+		for _, i := range m.impressions {
+			if !deleted(i.BonjourID) {
+				kept = append(kept, i)
+			}
+		}
+		m.impressions = kept
+	default:
+		return fmt.Errorf("unknown table %q", table)
+	}
+	return nil
+}
+
+// DeleteBonjours implements Store
+func (m *Memory) DeleteBonjours(_ context.Context, uids []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+	ids := m.bonjourIDs(uids)
+	kept := m.bonjours[:0]
+	for _, b := range m.bonjours {
+		if _, ok := ids[b.ID]; !ok {
+			kept = append(kept, b)
+		}
+	}
+	m.bonjours = kept
+	return nil
+}
+
+// CountUsers implements Store
+func (m *Memory) CountUsers(context.Context) (uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	flagged := make(map[string]struct{}, len(m.flags))
+	for _, f := range m.flags {
+		flagged[f.BonjourID] = struct{}{}
+	}
+	var count uint64
+	for _, b := range m.bonjours {
+		if _, ok := flagged[b.ID]; !ok && b.Site == site.Main && b.Classification == botdetect.Human {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// TopSources implements Store. Bonjours are timed by their IDs, which are ULIDs.
+func (m *Memory) TopSources(_ context.Context, site string, since, until time.Time, limit int) ([]model.Source, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	flagged := make(map[string]struct{}, len(m.flags))
+	for _, f := range m.flags {
+		flagged[f.BonjourID] = struct{}{}
+	}
+	counts := make(map[model.Source]uint64)
+	for _, b := range m.bonjours {
+		if _, ok := flagged[b.ID]; ok || b.Site != site || b.Classification != botdetect.Human || b.ReferrerClass == "" {
+			continue
+		}
+		id, err := ulid.Parse(b.ID)
+		if err != nil {
+			continue
+		}
+		if created := ulid.Time(id.Time()); created.Before(since) || !created.Before(until) {
+			continue
+		}
+		source := model.Source{Class: b.ReferrerClass, Source: b.ReferrerDomain}
+		if b.UTMSource != "" {
+			source.Source = b.UTMSource
+		}
+		counts[source]++
+	}
+	sources := make([]model.Source, 0, len(counts))
+	for source, sessions := range counts {
+		source.Sessions = sessions
+		sources = append(sources, source)
+	}
+	sort.Slice(sources, func(i, j int) bool {
+		a, b := sources[i], sources[j]
+		if a.Sessions != b.Sessions {
+			return a.Sessions > b.Sessions
+		}
+		if a.Class != b.Class {
+			return a.Class < b.Class
+		}
+		return a.Source < b.Source
+	})
+	if len(sources) > limit {
+		sources = sources[:limit]
+	}
+	return sources, nil
+}
+
+// Ping implements Store
+func (m *Memory) Ping(context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+	return nil
+}
+
+// Close implements Store
+func (m *Memory) Close() error {
+	m.mu.Lock()
+	m.closed = true
+	m.mu.Unlock()
+	return nil
+}
+
+// Bonjours returns the bonjour requests stored
+func (m *Memory) Bonjours() []model.Bonjour {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]model.Bonjour(nil), m.bonjours...)
+}
+
+// BonjourFlags returns the late classifications stored
+func (m *Memory) BonjourFlags() []model.BonjourFlag {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]model.BonjourFlag(nil), m.flags...)
+}
+
+// Impressions returns the impressions stored
+func (m *Memory) Impressions() []model.Impression {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]model.Impression(nil), m.impressions...)
+}
+
+// EventsSearchResultEntered returns the search result entered events stored
+func (m *Memory) EventsSearchResultEntered() []model.EventSearchResultEntered {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]model.EventSearchResultEntered(nil), m.events...)
+}
@@ -0,0 +1,178 @@
+package repository
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/penguin-statistics/probe/internal/app/config"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// Migration is a schema migration embedded from migrations/<version>_<name>.sql
+type Migration struct {
+	Version    uint32
+	Name       string
+	Statements []string
+}
+
+// Migrations returns the migrations embedded, ordered by version
+func Migrations() ([]Migration, error) {
+	entries, err := migrations.ReadDir("migrations")
+	if err != nil {
+		return nil, err
+	}
+	ms := make([]Migration, 0, len(entries))
+	for _, entry := range entries {
+		content, err := migrations.ReadFile(path.Join("migrations", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		m, err := parseMigration(entry.Name(), string(content))
+		if err != nil {
+			return nil, err
+		}
+		ms = append(ms, m)
+	}
+	sort.Slice(ms, func(i, j int) bool {
+		return ms[i].Version < ms[j].Version
+	})
+	for i := 1; i < len(ms); i++ {
+		if ms[i].Version == ms[i-1].Version {
+			return nil, fmt.Errorf("duplicated migration version %d", ms[i].Version)
+		}
+	}
+	return ms, nil
+}
+
+func parseMigration(filename, content string) (Migration, error) {
+	version, name, ok := strings.Cut(strings.TrimSuffix(filename, ".sql"), "_")
+	v, err := strconv.ParseUint(version, 10, 32)
+	if !ok || err != nil || v == 0 {
+		return Migration{}, fmt.Errorf("invalid migration file name %q: shall be like 0001_name.sql", filename)
+	}
+	return Migration{
+		Version:    uint32(v),
+		Name:       name,
+		Statements: splitStatements(content),
+	}, nil
+}
+
+// splitStatements splits sql into statements terminated by a semicolon at the end of a line,
+// as ClickHouse executes a single statement at a time
+func splitStatements(sql string) []string {
+	var statements []string
+	var current strings.Builder
+	for _, line := range strings.Split(sql, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			statements = append(statements, strings.TrimSuffix(strings.TrimSpace(current.String()), ";"))
+			current.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(current.String()); rest != "" {
+		statements = append(statements, rest)
+	}
+	return statements
+}
+
+// Migrate creates the configured database if it does not exist yet, and applies the migrations which have not
+// been applied to it in order. It returns the migrations applied, or the ones to be applied if dryRun is set,
+// in which case nothing is created.
+func Migrate(ctx context.Context, conf *config.Config, dryRun bool) ([]Migration, error) {
+	ms, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	if dryRun {
+		current, err := appliedVersion(ctx, conf)
+		if err != nil {
+			return nil, err
+		}
+		return pendingSince(ms, current), nil
+	}
+
+	db, err := open(conf, "default")
+	if err != nil {
+		return nil, err
+	}
+	err = db.Exec(ctx, "CREATE DATABASE IF NOT EXISTS "+quoteIdentifier(conf.ClickHouse.Database))
+	db.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	db, err = open(conf, conf.ClickHouse.Database)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	err = db.Exec(ctx, "CREATE TABLE IF NOT EXISTS schema_migrations (`version` UInt32, `name` String, `applied_at` DateTime('Etc/UTC') DEFAULT now('Etc/UTC')) ENGINE = MergeTree ORDER BY version")
+	if err != nil {
+		return nil, err
+	}
+	var current uint32
+	if err := db.QueryRow(ctx, "SELECT max(version) FROM schema_migrations").Scan(&current); err != nil {
+		return nil, err
+	}
+
+	pending := pendingSince(ms, current)
+	for i, m := range pending {
+		for _, statement := range m.Statements {
+			if err := db.Exec(ctx, statement); err != nil {
+				return pending[:i], fmt.Errorf("migration %04d_%s failed: %w", m.Version, m.Name, err)
+			}
+		}
+		if err := db.Exec(ctx, "INSERT INTO schema_migrations (version, name) VALUES (?, ?)", m.Version, m.Name); err != nil {
+			return pending[:i], err
+		}
+	}
+	return pending, nil
+}
+
+// appliedVersion returns the version of the last migration applied to the configured database without issuing any
+// DDL. A database or a schema_migrations table which does not exist yet is at version 0.
+func appliedVersion(ctx context.Context, conf *config.Config) (uint32, error) {
+	db, err := open(conf, "default")
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	var tables uint64
+	err = db.QueryRow(ctx, "SELECT count() FROM system.tables WHERE database = ? AND name = 'schema_migrations'", conf.ClickHouse.Database).Scan(&tables)
+	if err != nil || tables == 0 {
+		return 0, err
+	}
+	var current uint32
+	err = db.QueryRow(ctx, "SELECT max(version) FROM "+quoteIdentifier(conf.ClickHouse.Database)+".schema_migrations").Scan(&current)
+	return current, err
+}
+
+// pendingSince returns the migrations of ms after version current
+func pendingSince(ms []Migration, current uint32) []Migration {
+	var pending []Migration
+	for _, m := range ms {
+		if m.Version > current {
+			pending = append(pending, m)
+		}
+	}
+	return pending
+}
+
+func quoteIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "\\`") + "`"
+}
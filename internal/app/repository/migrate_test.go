@@ -0,0 +1,54 @@
+package repository
+
+import "testing"
+
+func TestMigrations(t *testing.T) {
+	ms, err := Migrations()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	for i, m := range ms {
+		if m.Version != uint32(i+1) {
+			t.Error("expect migration versions to be sequential, got", m.Version, "at", i)
+		}
+		if len(m.Statements) == 0 {
+			t.Error("expect statements in migration", m.Name)
+		}
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	statements := splitStatements("-- comment\nCREATE TABLE a\n(\n    `id` String\n);\n\nALTER TABLE a ADD COLUMN b String;\nSELECT 1")
+	expected := []string{"CREATE TABLE a\n(\n    `id` String\n)", "ALTER TABLE a ADD COLUMN b String", "SELECT 1"}
+	if len(statements) != len(expected) {
+		t.Fatal("expect", len(expected), "statements, got", statements)
+	}
+	for i := range expected {
+		if statements[i] != expected[i] {
+			t.Errorf("expect statement %q, got %q", expected[i], statements[i])
+		}
+	}
+}
+
+func TestParseMigration(t *testing.T) {
+	if _, err := parseMigration("init.sql", ""); err == nil {
+		t.Error("expect error on missing version")
+	}
+	m, err := parseMigration("0012_add_column.sql", "SELECT 1;")
+	if err != nil || m.Version != 12 || m.Name != "add_column" {
+		t.Error("unexpected migration", m, err)
+	}
+}
+
+func TestPendingSince(t *testing.T) {
+	ms, err := Migrations()
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if pending := pendingSince(ms, 0); len(pending) != len(ms) {
+		t.Error("expect every migration pending on a fresh database, got", len(pending))
+	}
+	if pending := pendingSince(ms, 3); len(pending) != len(ms)-3 || pending[0].Version != 4 {
+		t.Error("expect migrations after version 3 pending, got", pending)
+	}
+}
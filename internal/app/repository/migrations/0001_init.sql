@@ -1,6 +1,4 @@
-CREATE DATABASE IF NOT EXISTS probe;
-
-CREATE TABLE probe.bonjours
+CREATE TABLE IF NOT EXISTS bonjours
 (
     `id` FixedString(26),
     `created_at` DateTime64(6, 'Etc/UTC') DEFAULT now('Etc/UTC'),
@@ -13,7 +11,7 @@ ENGINE = MergeTree
 PRIMARY KEY id
 ORDER BY id;
 
-CREATE TABLE probe.impressions
+CREATE TABLE IF NOT EXISTS impressions
 (
     `id` FixedString(26),
     `bonjour_id` FixedString(26),
@@ -24,8 +22,7 @@ ENGINE = MergeTree
 PRIMARY KEY id
 ORDER BY id;
 
-
-CREATE TABLE probe.event_search_result_entered
+CREATE TABLE IF NOT EXISTS event_search_result_entered
 (
     `id` FixedString(26),
     `bonjour_id` FixedString(26),
@@ -36,4 +33,4 @@ CREATE TABLE probe.event_search_result_entered
 )
 ENGINE = MergeTree
 PRIMARY KEY id
-ORDER BY id;
\ No newline at end of file
+ORDER BY id;
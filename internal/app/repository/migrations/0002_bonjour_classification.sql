@@ -0,0 +1,12 @@
+ALTER TABLE bonjours ADD COLUMN IF NOT EXISTS `classification` LowCardinality(UInt8) DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS bonjour_flags
+(
+    `bonjour_id` FixedString(26),
+    `created_at` DateTime('Etc/UTC') DEFAULT now('Etc/UTC'),
+    `classification` LowCardinality(UInt8),
+    `reason` String
+)
+ENGINE = MergeTree
+PRIMARY KEY bonjour_id
+ORDER BY bonjour_id;
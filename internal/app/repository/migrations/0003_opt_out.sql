@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS opt_outs
+(
+    `uid_hash` FixedString(64),
+    `created_at` DateTime('Etc/UTC') DEFAULT now('Etc/UTC')
+)
+ENGINE = ReplacingMergeTree
+PRIMARY KEY uid_hash
+ORDER BY uid_hash;
+
+-- deletion jobs are updated by inserting a new version of the row: query with FINAL
+CREATE TABLE IF NOT EXISTS deletions
+(
+    `id` FixedString(26),
+    `uids` Array(FixedString(32)),
+    `status` LowCardinality(String),
+    `tables` Array(String),
+    `error` String,
+    `created_at` DateTime('Etc/UTC'),
+    `updated_at` DateTime64(3, 'Etc/UTC')
+)
+ENGINE = ReplacingMergeTree(updated_at)
+PRIMARY KEY id
+ORDER BY id;
@@ -0,0 +1,2 @@
+-- query holds the normalized query from now on, and query_raw the query as reported if allowed
+ALTER TABLE event_search_result_entered ADD COLUMN IF NOT EXISTS `query_raw` String DEFAULT '';
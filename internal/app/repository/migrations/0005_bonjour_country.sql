@@ -0,0 +1 @@
+ALTER TABLE bonjours ADD COLUMN IF NOT EXISTS `country` LowCardinality(String) DEFAULT '';
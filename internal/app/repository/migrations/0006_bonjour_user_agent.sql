@@ -0,0 +1,5 @@
+-- coarse dimensions parsed from the User-Agent. the User-Agent itself is not stored
+ALTER TABLE bonjours ADD COLUMN IF NOT EXISTS `browser` LowCardinality(String) DEFAULT '';
+ALTER TABLE bonjours ADD COLUMN IF NOT EXISTS `browser_version` UInt16 DEFAULT 0;
+ALTER TABLE bonjours ADD COLUMN IF NOT EXISTS `os` LowCardinality(String) DEFAULT '';
+ALTER TABLE bonjours ADD COLUMN IF NOT EXISTS `device` LowCardinality(String) DEFAULT '';
@@ -0,0 +1,6 @@
+-- attribution of landing sessions. left empty for sessions of reconnects
+ALTER TABLE bonjours ADD COLUMN IF NOT EXISTS `utm_source` String DEFAULT '';
+ALTER TABLE bonjours ADD COLUMN IF NOT EXISTS `utm_medium` LowCardinality(String) DEFAULT '';
+ALTER TABLE bonjours ADD COLUMN IF NOT EXISTS `utm_campaign` String DEFAULT '';
+ALTER TABLE bonjours ADD COLUMN IF NOT EXISTS `referrer_domain` String DEFAULT '';
+ALTER TABLE bonjours ADD COLUMN IF NOT EXISTS `referrer_class` LowCardinality(String) DEFAULT '';
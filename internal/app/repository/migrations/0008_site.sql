@@ -0,0 +1,5 @@
+-- site every row is recorded for. rows recorded before sites were introduced are of the main site
+ALTER TABLE bonjours ADD COLUMN IF NOT EXISTS `site` LowCardinality(String) DEFAULT 'main';
+ALTER TABLE bonjour_flags ADD COLUMN IF NOT EXISTS `site` LowCardinality(String) DEFAULT 'main';
+ALTER TABLE impressions ADD COLUMN IF NOT EXISTS `site` LowCardinality(String) DEFAULT 'main';
+ALTER TABLE event_search_result_entered ADD COLUMN IF NOT EXISTS `site` LowCardinality(String) DEFAULT 'main';
@@ -3,112 +3,422 @@ package server
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/davecgh/go-spew/spew"
+	"github.com/gorilla/websocket"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
-	"github.com/spf13/viper"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/proto"
 
+	"github.com/penguin-statistics/probe/internal/app/config"
 	"github.com/penguin-statistics/probe/internal/app/controller"
 	"github.com/penguin-statistics/probe/internal/app/repository"
 	"github.com/penguin-statistics/probe/internal/app/service"
-	"github.com/penguin-statistics/probe/internal/pkg/commons"
+	"github.com/penguin-statistics/probe/internal/pkg/botdetect"
+	"github.com/penguin-statistics/probe/internal/pkg/cluster"
+	"github.com/penguin-statistics/probe/internal/pkg/connlimit"
+	"github.com/penguin-statistics/probe/internal/pkg/geoip"
 	"github.com/penguin-statistics/probe/internal/pkg/logger"
+	"github.com/penguin-statistics/probe/internal/pkg/messages"
+	"github.com/penguin-statistics/probe/internal/pkg/origin"
+	"github.com/penguin-statistics/probe/internal/pkg/proxyproto"
+	"github.com/penguin-statistics/probe/internal/pkg/pseudonym"
+	"github.com/penguin-statistics/probe/internal/pkg/realip"
+	"github.com/penguin-statistics/probe/internal/pkg/searchquery"
+	"github.com/penguin-statistics/probe/internal/pkg/session"
+	"github.com/penguin-statistics/probe/internal/pkg/site"
+	"github.com/penguin-statistics/probe/internal/pkg/tracing"
 	"github.com/penguin-statistics/probe/internal/pkg/wspool"
 )
 
-var log = logger.New("cmd")
+var (
+	log     = logger.New("cmd")
+	httpLog = logger.New("http")
+)
+
+// Server is the probe http server along with the components it serves
+type Server struct {
+	Echo *echo.Echo
+
+	conf    *config.Config
+	trusted realip.Trusted
+	store   repository.Store
+	hub     *wspool.Hub
+	bonjour *controller.Bonjour
+
+	// stop stops the background loops of the components and unregisters their reload hooks
+	stop func()
+}
+
+// Bootstrap starts the http server up with conf and serves until an interrupt or termination signal is received
+func Bootstrap(conf *config.Config) error {
+	shutdownTracing, err := tracing.Setup(tracing.Config{
+		Exporter:    conf.Tracing.Exporter,
+		Endpoint:    conf.Tracing.Endpoint,
+		Insecure:    conf.Tracing.Insecure,
+		Headers:     conf.Tracing.Headers,
+		File:        conf.Tracing.File,
+		SampleRatio: conf.Tracing.SampleRatio,
+		Node:        nodeName(conf),
+	})
+	if err != nil {
+		return err
+	}
+
+	r, err := repository.NewProbe(conf)
+	if err != nil {
+		return err
+	}
+	ln, err := net.Listen("tcp", conf.HTTP.Server)
+	if err != nil {
+		r.Close()
+		return err
+	}
+	s, err := New(conf, r)
+	if err != nil {
+		ln.Close()
+		r.Close()
+		return err
+	}
+	config.Watch()
+
+	// Start server
+	go func() {
+		if err := s.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.Infoln("server shutdown", err)
+		}
+	}()
+
+	// Wait for interrupt or termination signal to drain the server gracefully.
+	// Use a buffered channel to avoid missing signals as recommended for signal.Notify
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	<-quit
+	signal.Stop(quit)
+
+	ctx, cancel := context.WithTimeout(context.Background(), conf.Shutdown.Timeout)
+	defer cancel()
+	s.Shutdown(ctx)
+	if err := shutdownTracing(ctx); err != nil {
+		log.Warnln("failed to flush spans", err)
+	}
 
-// Bootstrap starts the http server up
-func Bootstrap() error {
-	if viper.GetBool("app.debug") {
+	return nil
+}
+
+// nodeName returns the name of the instance within the cluster, which defaults to the hostname
+func nodeName(conf *config.Config) string {
+	if conf.Cluster.Node != "" {
+		return conf.Cluster.Node
+	}
+	node, _ := os.Hostname()
+	return node
+}
+
+// New creates a Server with conf which records probe requests to r. The server is started with Server.Echo.
+func New(conf *config.Config, r repository.Store) (*Server, error) {
+	return NewWithTransport(conf, r, nil)
+}
+
+// NewWithTransport creates a Server like New which gossips with the other instances over transport, e.g. of a
+// cluster.Network joining in-process instances within tests. The transport of cluster.peers is used if nil.
+func NewWithTransport(conf *config.Config, r repository.Store, transport cluster.Transport) (*Server, error) {
+	if conf.App.Debug {
 		fmt.Println("debug enabled")
-		viper.Debug()
+	}
+
+	trusted, err := realip.ParseTrusted(conf.Proxy.Trusted)
+	if err != nil {
+		return nil, err
+	}
+
+	sProm := service.NewPrometheus()
+	originsConfig := func(conf *config.Config) origin.Config {
+		return origin.Config{
+			AllowAll:     conf.Origins.AllowAll,
+			Rules:        conf.Origins.Rules(),
+			AllowMissing: conf.Origins.AllowMissing,
+			Metrics:      sProm,
+		}
+	}
+	origins, err := origin.New(originsConfig(conf))
+	if err != nil {
+		return nil, err
+	}
+	// message types have been validated with the config
+	sitesConfig := func(conf *config.Config) []site.Config {
+		sites := make([]site.Config, 0, len(conf.Sites))
+		for _, s := range conf.Sites {
+			types := make([]messages.MessageType, 0, len(s.Messages))
+			for _, name := range s.Messages {
+				if t, err := site.ParseMessageType(name); err == nil {
+					types = append(types, t)
+				}
+			}
+			sites = append(sites, site.Config{
+				ID:           s.ID,
+				Key:          s.Key,
+				Origins:      s.Origins,
+				Messages:     types,
+				MessageRate:  s.MessageRate,
+				MessageBurst: s.MessageBurst,
+			})
+		}
+		return sites
+	}
+	sites, err := site.New(origins, sitesConfig(conf), originsConfig(conf))
+	if err != nil {
+		return nil, err
 	}
 
 	e := echo.New()
-	e.Debug = viper.GetBool("app.debug")
+	e.Debug = conf.App.Debug
 	e.Validator = &Validator{}
-	e.Use(middleware.LoggerWithConfig(middleware.LoggerConfig{
-		Format: "${time_rfc3339} | \u001B[97;34m${status} ${latency_human}\u001B[0m | \033[97;36m${method} ${uri}\033[0m\n",
+	// client addresses are resolved once here, so that limits, geoip and logs all see the same address
+	e.IPExtractor = realip.Extractor(trusted, conf.Proxy.Header)
+	e.Use(middleware.RequestLoggerWithConfig(middleware.RequestLoggerConfig{
+		LogStatus:   true,
+		LogLatency:  true,
+		LogMethod:   true,
+		LogURI:      true,
+		LogRemoteIP: true,
+		LogValuesFunc: func(c echo.Context, v middleware.RequestLoggerValues) error {
+			httpLog.WithFields(logrus.Fields{
+				"status":  v.Status,
+				"latency": v.Latency.String(),
+				"method":  v.Method,
+				"uri":     v.URI,
+				"remote":  v.RemoteIP,
+			}).Infoln("request served")
+			return nil
+		},
 	}))
 	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
+		// upgrades are not subject to CORS: their origin is checked by the websocket upgrader
+		Skipper: func(c echo.Context) bool {
+			return websocket.IsWebSocketUpgrade(c.Request())
+		},
 		// AllowCredentials: true,
-		AllowMethods: []string{http.MethodGet},
-		AllowOrigins: commons.PenguinDomainsOrigin(),
-		MaxAge:       int((time.Hour * 24).Seconds()),
+		AllowMethods:    []string{http.MethodGet, http.MethodPost},
+		AllowOriginFunc: sites.AllowOrigin,
+		MaxAge:          int((time.Hour * 24).Seconds()),
 	}))
 	e.HTTPErrorHandler = func(err error, c echo.Context) {
 		if c.Response().Committed {
 			return
 		}
-		if viper.GetBool("app.debug") {
+		if conf.App.Debug {
 			spew.Dump(err)
 		}
 		e.DefaultHTTPErrorHandler(err, c)
 	}
 
-	r := repository.NewProbe()
-	hub := wspool.NewHub()
-	sBonjour := service.NewBonjour(r)
-	sProm := service.NewPrometheus()
-	c := controller.NewBonjour(sBonjour, sProm, hub)
-	e.Server.RegisterOnShutdown(func() {
-		go hub.Evict()
+	pseudonyms, err := pseudonym.New(pseudonym.Config{
+		Rotation: conf.Privacy.SaltRotation,
+		Keep:     conf.Privacy.SaltsKept,
+		File:     conf.Privacy.SaltFile,
 	})
+	if err != nil {
+		return nil, err
+	}
+	queriesConfig := func(conf *config.Config) searchquery.Config {
+		return searchquery.Config{
+			MaxLength: conf.Search.MaxQueryLength,
+			KeepRaw:   conf.Search.StoreRawQuery,
+			Metrics:   sProm,
+		}
+	}
+	queries := searchquery.New(queriesConfig(conf))
+	sBonjour := service.NewBonjour(r, pseudonyms, queries)
+	sOptOut := service.NewOptOut(r, pseudonyms, conf.Privacy.DeletionInterval)
+	if err := sOptOut.Load(context.Background()); err != nil {
+		return nil, err
+	}
+	hubConfig := func(conf *config.Config) wspool.Config {
+		return wspool.Config{
+			InvalidThreshold:  conf.Limits.InvalidMessageThreshold,
+			InvalidHalfLife:   conf.Limits.InvalidMessageHalfLife,
+			MessageRate:       conf.Limits.MessageRate,
+			MessageBurst:      conf.Limits.MessageBurst,
+			ThrottleThreshold: conf.Limits.ThrottleThreshold,
+			ThrottleHalfLife:  conf.Limits.ThrottleHalfLife,
+			Metrics:           sProm,
+		}
+	}
+	hub := wspool.NewHub(hubConfig(conf))
+	if conf.Session.Secret == "" {
+		log.Warnln("session.secret is not set: resume tokens will be invalidated on restart")
+	}
+	sessions := session.NewStore(session.NewSigner([]byte(conf.Session.Secret)), conf.Session.ResumeWindow)
+	classifier, err := botdetect.New(conf.Bot.RulesFile)
+	if err != nil {
+		return nil, err
+	}
+	limiterConfig := func(conf *config.Config) connlimit.Config {
+		return connlimit.Config{
+			MaxPerIP:      conf.Limits.MaxConnectionsPerIP,
+			MaxPerUID:     conf.Limits.MaxConnectionsPerUID,
+			IPv6PrefixLen: conf.Limits.IPv6PrefixLen,
+			Rate:          conf.Limits.ConnectionRate,
+			Burst:         conf.Limits.ConnectionBurst,
+		}
+	}
+	limiter := connlimit.New(limiterConfig(conf))
+	geo, err := geoip.New(conf.GeoIP.File)
+	if err != nil {
+		return nil, err
+	}
+	unregister := config.OnReload(func(conf *config.Config) {
+		if err := origins.SetConfig(originsConfig(conf)); err != nil {
+			log.Warnln("failed to apply origins, keeping the ones in effect", err)
+		}
+		if err := sites.SetConfig(sitesConfig(conf), originsConfig(conf)); err != nil {
+			log.Warnln("failed to apply sites, keeping the ones in effect", err)
+		}
+		hub.SetConfig(hubConfig(conf))
+		limiter.SetConfig(limiterConfig(conf))
+		queries.SetConfig(queriesConfig(conf))
+		if err := geo.SetFile(conf.GeoIP.File); err != nil {
+			log.Warnln("failed to load geoip database, keeping the one loaded", err)
+		}
+	})
+
+	routes := cluster.NewRoutes()
+	node := nodeName(conf)
+	if transport == nil {
+		if len(conf.Cluster.Peers) > 0 {
+			t := cluster.NewHTTP(node, conf.Cluster.Peers, conf.Cluster.Secret)
+			e.POST(cluster.GossipPath, echo.WrapHandler(t))
+			transport = t
+		} else {
+			transport = cluster.NewNetwork().Join(node)
+		}
+	}
+	cl := cluster.New(node, transport, conf.Cluster.Interval, func() (int, map[string]int) {
+		return hub.Len(), routes.Snapshot()
+	})
+	// broadcasts are relayed as ServerBroadcast messages, from this instance or the peers
+	cl.OnMessage(func(payload []byte) {
+		var m messages.ServerBroadcast
+		if err := proto.Unmarshal(payload, &m); err != nil {
+			log.Warnln("dropped invalid broadcast", err)
+			return
+		}
+		hub.Broadcast(&m)
+	})
+	c := controller.NewBonjour(sBonjour, sOptOut, sProm, hub, sessions, classifier, limiter, cl, routes, geo, origins, sites)
 
-	if viper.GetBool("app.debug") {
+	if conf.App.Debug {
 		e.File("/web", "web/index.html")
 		e.File("/web/events.js", "web/events.js")
 	}
 
 	e.GET("/", c.LiveHandler)
-	e.GET("/metrics", echo.WrapHandler(promhttp.Handler()))
+	e.GET("/live", c.ClusterLiveHandler)
+	optOut := controller.NewOptOut(sOptOut, limiter)
+	e.POST("/opt-out", optOut.OptOutHandler)
+	e.GET("/opt-out/:id", optOut.DeletionHandler)
+	if conf.Admin.Token != "" {
+		e.GET("/sources", controller.NewSources(sBonjour, conf.Admin.Token).TopSourcesHandler)
+		e.POST("/broadcast", controller.NewBroadcast(cl, conf.Admin.Token).BroadcastHandler)
+	}
+	if conf.Metrics.Enabled {
+		e.GET(conf.Metrics.Path, echo.WrapHandler(sProm.Handler()))
+	}
 	e.GET("/ping", func(c echo.Context) error {
 		return c.String(http.StatusOK, "OK")
 	})
 	e.GET("/health", func(c echo.Context) error {
-		if err := r.DB.Exec(context.Background(), "SELECT 1"); err != nil {
+		if err := r.Ping(context.Background()); err != nil {
 			return c.String(http.StatusInternalServerError, "DB error")
 		}
 
 		return c.String(http.StatusOK, "OK")
 	})
-
-	// Start server
-	go func() {
-		if err := e.Start(viper.GetString("http.server")); err != nil && err != http.ErrServerClosed {
-			log.Infoln("server shutdown", err)
+	e.GET("/ready", func(ec echo.Context) error {
+		if c.Draining() {
+			return ec.String(http.StatusServiceUnavailable, "Draining")
 		}
-	}()
+		return ec.String(http.StatusOK, "OK")
+	})
 
-	// Wait for interrupt signal to gracefully shutdown the server with a timeout of 24 hours.
-	// Use a buffered channel to avoid missing signals as recommended for signal.Notify
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt)
-	<-quit
-	ctx, cancel := context.WithTimeout(context.Background(), 24*time.Hour)
+	// background loops run until the server is shut down
+	ctx, cancel := context.WithCancel(context.Background())
+	go geo.Run(ctx, conf.GeoIP.ReloadInterval)
+	go sessions.Run(ctx)
+	go limiter.Run(ctx)
+	go cl.Run(ctx)
+	go sOptOut.Run(ctx)
+
+	return &Server{
+		Echo:    e,
+		conf:    conf,
+		trusted: trusted,
+		store:   r,
+		hub:     hub,
+		bonjour: c,
+		stop: func() {
+			unregister()
+			cancel()
+		},
+	}, nil
+}
+
+// Serve serves on ln until the server is shut down. PROXY protocol headers are read from the connections of trusted
+// proxies if enabled.
+func (s *Server) Serve(ln net.Listener) error {
+	if s.conf.Proxy.ProxyProtocol {
+		ln = proxyproto.NewListener(ln, s.trusted.ContainsAddr, s.conf.Proxy.ProxyProtocolTimeout)
+	}
+	s.Echo.Listener = ln
+	return s.Echo.Start("")
+}
+
+// Wait waits for the handlers of all connections to finish recording, or for ctx to be done.
+// It shall not be called while new connections are being accepted.
+func (s *Server) Wait(ctx context.Context) error {
+	return s.bonjour.Wait(ctx)
+}
+
+// Shutdown drains the server within the deadline of ctx: readiness is failed and new connections are
+// rejected first, then connected clients are asked to go away in paced batches, and finally the http
+// server, the background loops and the storage are closed once pending writes are done, or shutdown.writeTimeout
+// has passed.
+func (s *Server) Shutdown(ctx context.Context) {
+	conf, e, r, hub, c := s.conf.Shutdown, s.Echo, s.store, s.hub, s.bonjour
+	log.Infoln("draining: readiness is failing and new connections are rejected")
+	c.Drain()
+
+	// give load balancers time to observe the failing readiness before clients are asked to reconnect
+	select {
+	case <-time.After(conf.ReadinessDelay):
+	case <-ctx.Done():
+	}
+
+	log.Infoln("draining: evicting", hub.Len(), "clients")
+	if err := hub.Evict(ctx, conf.Spread); err != nil {
+		log.Warnln("draining: deadline exceeded while evicting clients, closed", hub.Len(), "remaining clients forcibly")
+	}
+	// pending writes are waited for on their own, as the deadline may have been spent on evicting clients
+	wctx, cancel := context.WithTimeout(context.Background(), conf.WriteTimeout)
 	defer cancel()
+	if err := c.Wait(wctx); err != nil {
+		log.Warnln("draining: timed out waiting for pending writes, abandoned", c.Pending(), "handlers")
+	}
+
 	if err := e.Shutdown(ctx); err != nil {
 		log.Infoln("received non-nil err from Shutdown()", err)
 	}
-
-	if len(hub.Clients) > 0 {
-		log.Infoln("waiting for clients to disconnect")
-		for {
-			l := len(hub.Clients)
-			if l == 0 {
-				break
-			}
-			log.Infoln("waiting for", l, "clients to disconnect")
-			time.Sleep(time.Minute)
-		}
+	s.stop()
+	if err := r.Close(); err != nil {
+		log.Warnln("failed to close storage", err)
 	}
-
-	return nil
+	log.Infoln("drained")
 }
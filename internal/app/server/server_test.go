@@ -0,0 +1,957 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/penguin-statistics/probe/internal/app/config"
+	"github.com/penguin-statistics/probe/internal/app/model"
+	"github.com/penguin-statistics/probe/internal/app/server/servertest"
+	"github.com/penguin-statistics/probe/internal/pkg/dnt"
+	"github.com/penguin-statistics/probe/internal/pkg/geoip/geoiptest"
+	"github.com/penguin-statistics/probe/internal/pkg/messages"
+	"github.com/penguin-statistics/probe/internal/pkg/proxyproto"
+)
+
+func TestBonjour(t *testing.T) {
+	s := servertest.Start(t, nil)
+
+	for name, modify := range map[string]func(b *servertest.Bonjour){
+		"should reject missing version":       func(b *servertest.Bonjour) { b.Version = "" },
+		"should reject missing platform":      func(b *servertest.Bonjour) { b.Platform = "" },
+		"should reject unknown platform":      func(b *servertest.Bonjour) { b.Platform = "fridge" },
+		"should reject malformed uid":         func(b *servertest.Bonjour) { b.UID = "short" },
+		"should reject unsupported protocols": func(b *servertest.Bonjour) { b.Subprotocols = []string{"probe.v9+pb"} },
+	} {
+		t.Run(name, func(t *testing.T) {
+			b := servertest.NewBonjour()
+			modify(&b)
+			_, resp, err := s.Dial(b)
+			if err == nil || resp == nil || resp.StatusCode != http.StatusBadRequest {
+				t.Fatal("expect bad request, got", resp, err)
+			}
+		})
+	}
+	if n := len(s.Store.Bonjours()); n != 0 {
+		t.Error("expect invalid bonjours not recorded, got", n)
+	}
+
+	t.Run("should record bonjour and initial impression", func(t *testing.T) {
+		b := servertest.NewBonjour()
+		b.Referer = "/result/stage/main/main_01-07"
+		c := s.MustDial(b)
+		c.MustReadSession()
+		c.Close()
+		s.WaitIdle()
+
+		bonjours := s.Store.Bonjours()
+		if len(bonjours) != 1 || bonjours[0].Legacy != 0 {
+			t.Fatal("expect bonjour recorded, got", bonjours)
+		}
+		if b := bonjours[0]; b.Browser != "chrome" || b.BrowserVersion != 120 || b.OS != "windows" || b.Device != "desktop" {
+			t.Error("expect user agent parsed, got", b.Browser, b.BrowserVersion, b.OS, b.Device)
+		}
+		impressions := s.Store.Impressions()
+		if len(impressions) != 1 || impressions[0].BonjourID != bonjours[0].ID || impressions[0].Path != b.Referer {
+			t.Error("expect initial impression recorded, got", impressions)
+		}
+	})
+
+	t.Run("should record uid as a pseudonym", func(t *testing.T) {
+		b := servertest.NewBonjour()
+		for i := 0; i < 2; i++ {
+			c := s.MustDial(b)
+			c.MustReadSession()
+			c.Close()
+			s.WaitIdle()
+		}
+
+		bonjours := s.Store.Bonjours()[1:]
+		if len(bonjours) != 2 || len(bonjours[0].UID) != 32 || bonjours[0].UID == b.UID {
+			t.Fatal("expect uid replaced by a pseudonym, got", bonjours)
+		}
+		if bonjours[1].UID != bonjours[0].UID {
+			t.Error("expect visits linkable within the salt rotation")
+		}
+	})
+
+	t.Run("should record search queries redacted and normalized", func(t *testing.T) {
+		c := s.MustDial(servertest.NewBonjour())
+		c.MustReadSession()
+		c.MustSend(servertest.EnteredSearchResult("ＳＫ－５ doctor@example.com", "wk_armor_5", 0))
+		c.MustReadACK()
+		c.Close()
+		s.WaitIdle()
+
+		events := s.Store.EventsSearchResultEntered()
+		if len(events) != 1 || events[0].Query != "sk-5 [email]" || events[0].QueryRaw != "" {
+			t.Error("expect query redacted and normalized, got", events)
+		}
+	})
+}
+
+func TestLegacy(t *testing.T) {
+	s := servertest.Start(t, nil)
+
+	b := servertest.NewBonjour()
+	b.Legacy = true
+	b.UID = ""
+	resp, err := s.Request(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatal("expect no content, got", resp.StatusCode)
+	}
+
+	bonjours := s.Store.Bonjours()
+	if len(bonjours) != 1 || bonjours[0].Legacy != 1 || len(bonjours[0].UID) != 32 {
+		t.Error("expect legacy bonjour recorded with a generated uid, got", bonjours)
+	}
+	if n := len(s.Store.Impressions()); n != 0 {
+		t.Error("expect no impression recorded for legacy clients, got", n)
+	}
+}
+
+func TestACK(t *testing.T) {
+	s := servertest.Start(t, nil)
+
+	t.Run("should acknowledge messages with their seq", func(t *testing.T) {
+		c := s.MustDial(servertest.NewBonjour())
+		c.MustReadSession()
+
+		seq := c.MustSend(servertest.Navigated("/planner"))
+		if ack := c.MustReadACK(); ack.GetType() != messages.MessageType_NAVIGATED || ack.GetSeq() != seq || ack.GetMessage() != "" {
+			t.Error("expect navigation acknowledged, got", ack)
+		}
+		seq = c.MustSend(servertest.EnteredSearchResult("1-7", "main_01-07", 2))
+		if ack := c.MustReadACK(); ack.GetType() != messages.MessageType_ENTERED_SEARCH_RESULT || ack.GetSeq() != seq {
+			t.Error("expect search result acknowledged, got", ack)
+		}
+		c.Close()
+		s.WaitIdle()
+
+		if impressions := s.Store.Impressions(); len(impressions) != 2 || impressions[1].Path != "/planner" {
+			t.Error("expect navigation recorded, got", impressions)
+		}
+		if events := s.Store.EventsSearchResultEntered(); len(events) != 1 || events[0].Destination != "stage:main_01-07" || events[0].ResultPosition != 2 {
+			t.Error("expect search result recorded, got", events)
+		}
+	})
+
+	t.Run("should acknowledge without seq to v1 clients", func(t *testing.T) {
+		b := servertest.NewBonjour()
+		b.Subprotocols = []string{"pb"}
+		c := s.MustDial(b)
+		defer c.Close()
+		if c.Conn.Subprotocol() != "pb" {
+			t.Error("expect legacy subprotocol selected, got", c.Conn.Subprotocol())
+		}
+		c.MustSend(servertest.Navigated("/about"))
+		if ack := c.MustReadACK(); ack.GetType() != messages.MessageType_NAVIGATED || ack.GetSeq() != 0 {
+			t.Error("expect plain ACK, got", ack)
+		}
+	})
+}
+
+func TestReconnect(t *testing.T) {
+	s := servertest.Start(t, nil)
+
+	b := servertest.NewBonjour()
+	c := s.MustDial(b)
+	session := c.MustReadSession()
+	if session.GetResumed() || session.GetResumeToken() == "" {
+		t.Fatal("expect a new session with a resume token, got", session)
+	}
+	c.MustSend(servertest.Navigated("/planner"))
+	c.MustReadACK()
+	c.Close()
+	s.WaitIdle()
+
+	t.Run("should resume session with a valid token", func(t *testing.T) {
+		b = b.Reconnect(session.GetResumeToken())
+		c := s.MustDial(b)
+		defer c.Close()
+		resumed := c.MustReadSession()
+		if !resumed.GetResumed() || resumed.GetLastSeq() != 1 {
+			t.Fatal("expect session resumed with its last seq, got", resumed)
+		}
+
+		// a retransmission is acknowledged again but not recorded twice
+		c.SetSeq(0)
+		c.MustSend(servertest.Navigated("/planner"))
+		if ack := c.MustReadACK(); ack.GetSeq() != 1 {
+			t.Error("expect retransmission acknowledged, got", ack)
+		}
+		c.MustSend(servertest.Navigated("/about"))
+		c.MustReadACK()
+		c.Close()
+		s.WaitIdle()
+
+		if n := len(s.Store.Bonjours()); n != 1 {
+			t.Error("expect no bonjour recorded on resume, got", n)
+		}
+		impressions := s.Store.Impressions()
+		if len(impressions) != 3 || impressions[2].Path != "/about" || impressions[2].BonjourID != impressions[0].BonjourID {
+			t.Error("expect impressions recorded once within the original session, got", impressions)
+		}
+	})
+
+	t.Run("should start a new session without a valid token", func(t *testing.T) {
+		c := s.MustDial(b.Reconnect("forged"))
+		defer c.Close()
+		if session := c.MustReadSession(); session.GetResumed() {
+			t.Fatal("expect session not resumed")
+		}
+		c.Close()
+		s.WaitIdle()
+		if n := len(s.Store.Bonjours()); n != 2 {
+			t.Error("expect a new bonjour recorded, got", n)
+		}
+	})
+
+	t.Run("should refresh resume tokens of connected clients", func(t *testing.T) {
+		s := servertest.Start(t, func(conf *config.Config) {
+			conf.Session.ResumeWindow = 200 * time.Millisecond
+		})
+		b := servertest.NewBonjour()
+		c := s.MustDial(b)
+		c.MustReadSession()
+		c.MustSend(servertest.Navigated("/planner"))
+		c.MustReadACK()
+		refreshed := c.MustReadSession()
+		if refreshed.GetResumed() || refreshed.GetLastSeq() != 1 || refreshed.GetResumeToken() == "" {
+			t.Fatal("expect a fresh token of the session, got", refreshed)
+		}
+		c.Close()
+		s.WaitIdle()
+
+		c = s.MustDial(b.Reconnect(refreshed.GetResumeToken()))
+		defer c.Close()
+		if resumed := c.MustReadSession(); !resumed.GetResumed() {
+			t.Error("expect session resumed with the refreshed token, got", resumed)
+		}
+	})
+}
+
+func TestInvalidMessage(t *testing.T) {
+	s := servertest.Start(t, func(conf *config.Config) {
+		conf.Limits.InvalidMessageThreshold = 3
+		conf.Limits.InvalidMessageHalfLife = time.Hour
+	})
+
+	c := s.MustDial(servertest.NewBonjour())
+	c.MustReadSession()
+
+	invalid := []struct {
+		messageType int
+		payload     []byte
+	}{
+		{websocket.TextMessage, []byte("hello")},
+		{websocket.BinaryMessage, []byte{0xff, 0xff, 0xff}},
+	}
+	for _, m := range invalid {
+		if err := c.SendRaw(m.messageType, m.payload); err != nil {
+			t.Fatal(err)
+		}
+		if ack := c.MustReadACK(); ack.GetMessage() != "invalid websocket message" {
+			t.Error("expect invalid message reported, got", ack)
+		}
+	}
+
+	// messages failing the validation are acknowledged before they are processed
+	c.MustSend(servertest.Navigated("not a route"))
+	c.MustReadACK()
+	if ack := c.MustReadACK(); ack.GetMessage() != "too many invalid messages" {
+		t.Error("expect client told off, got", ack)
+	}
+	if closeErr := c.ReadClose(); closeErr == nil || closeErr.Code != websocket.ClosePolicyViolation {
+		t.Error("expect connection closed with a policy violation, got", closeErr)
+	}
+}
+
+func TestOptOut(t *testing.T) {
+	s := servertest.Start(t, nil)
+
+	other := s.MustDial(servertest.NewBonjour())
+	other.MustReadSession()
+	other.Close()
+
+	b := servertest.NewBonjour()
+	c := s.MustDial(b)
+	c.MustReadSession()
+	c.MustSend(servertest.EnteredSearchResult("1-7", "main_01-07", 0))
+	c.MustReadACK()
+	c.Close()
+	s.WaitIdle()
+
+	// the session stays connected while the user opts out
+	c = s.MustDial(b)
+	c.MustReadSession()
+
+	t.Run("should reject malformed uid", func(t *testing.T) {
+		resp, err := s.PostForm("/opt-out", url.Values{"u": {"short"}})
+		if err != nil || resp.StatusCode != http.StatusBadRequest {
+			t.Error("expect bad request, got", resp, err)
+		}
+	})
+
+	resp, err := s.PostForm("/opt-out", url.Values{"u": {b.UID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var deletion model.Deletion
+	err = json.NewDecoder(resp.Body).Decode(&deletion)
+	resp.Body.Close()
+	if err != nil || resp.StatusCode != http.StatusAccepted || deletion.ID == "" {
+		t.Fatal("expect deletion scheduled, got", resp.StatusCode, deletion, err)
+	}
+	if location := resp.Header.Get("Location"); location != "/opt-out/"+deletion.ID {
+		t.Error("expect location of the deletion, got", location)
+	}
+
+	t.Run("should stop recording the session connected", func(t *testing.T) {
+		c.MustSend(servertest.Navigated("/result/stage/main/main_01-07"))
+		c.ReadClose()
+		s.WaitIdle()
+		for _, i := range s.Store.Impressions() {
+			if i.Path == "/result/stage/main/main_01-07" {
+				t.Error("expect no impression recorded after opting out")
+			}
+		}
+	})
+
+	t.Run("should delete sessions recorded", func(t *testing.T) {
+		deadline := time.Now().Add(servertest.Timeout)
+		for deletion.Status != model.DeletionDone {
+			if time.Now().After(deadline) {
+				t.Fatal("timed out waiting for the deletion, got", deletion)
+			}
+			time.Sleep(10 * time.Millisecond)
+			resp, err := s.Get("/opt-out/" + deletion.ID)
+			if err != nil || resp.StatusCode != http.StatusOK {
+				t.Fatal("expect deletion status, got", resp, err)
+			}
+			err = json.NewDecoder(resp.Body).Decode(&deletion)
+			resp.Body.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if len(deletion.Tables) != 4 || deletion.Tables[3] != "bonjours" {
+			t.Error("expect sessions deleted from all tables, got", deletion.Tables)
+		}
+
+		bonjours := s.Store.Bonjours()
+		if len(bonjours) != 1 {
+			t.Fatal("expect sessions of other users kept, got", bonjours)
+		}
+		impressions := s.Store.Impressions()
+		if len(impressions) != 1 || impressions[0].BonjourID != bonjours[0].ID {
+			t.Error("expect impressions of the user deleted, got", impressions)
+		}
+		if events := s.Store.EventsSearchResultEntered(); len(events) != 0 {
+			t.Error("expect events of the user deleted, got", events)
+		}
+	})
+
+	t.Run("should not record users opted out", func(t *testing.T) {
+		_, resp, err := s.Dial(b)
+		if err == nil || resp == nil || resp.StatusCode != http.StatusNoContent {
+			t.Fatal("expect no content, got", resp, err)
+		}
+		if n := len(s.Store.Bonjours()); n != 1 {
+			t.Error("expect nothing recorded, got", n, "bonjours")
+		}
+	})
+
+	t.Run("should report unknown deletions", func(t *testing.T) {
+		resp, err := s.Get("/opt-out/unknown")
+		if err != nil || resp.StatusCode != http.StatusNotFound {
+			t.Error("expect not found, got", resp, err)
+		}
+	})
+}
+
+func TestPrivacySignals(t *testing.T) {
+	visit := func(t *testing.T, s *servertest.Server, b servertest.Bonjour) {
+		c := s.MustDial(b)
+		c.MustReadSession()
+		c.MustSend(servertest.Navigated("/search"))
+		c.MustReadACK()
+		c.MustSend(servertest.EnteredSearchResult("1-7", "main_01-07", 0))
+		c.MustReadACK()
+		c.Close()
+		s.WaitIdle()
+
+		body := metrics(t, s)
+		for _, metric := range []string{`probe_unique_view_total{country="unknown",platform="web",site="main"} 1`, `probe_page_view_total{platform="web",site="main"} 2`} {
+			if !strings.Contains(body, metric) {
+				t.Error("expect visit counted in aggregate metrics as", metric)
+			}
+		}
+	}
+	signaling := func() servertest.Bonjour {
+		b := servertest.NewBonjour()
+		b.Header = http.Header{"Sec-Gpc": {"1"}}
+		return b
+	}
+
+	t.Run("should record visits as is with the ignore policy", func(t *testing.T) {
+		s := servertest.Start(t, func(conf *config.Config) {
+			conf.Privacy.Signals = dnt.PolicyIgnore
+		})
+		visit(t, s, signaling())
+		bonjours := s.Store.Bonjours()
+		if len(bonjours) != 1 || bonjours[0].UID == "" {
+			t.Fatal("expect bonjour recorded with uid, got", bonjours)
+		}
+		if events := s.Store.EventsSearchResultEntered(); len(events) != 1 || events[0].BonjourID != bonjours[0].ID {
+			t.Error("expect event linked to the session, got", events)
+		}
+	})
+
+	t.Run("should record visits without uid and session linkage with the anonymous policy", func(t *testing.T) {
+		s := servertest.Start(t, func(conf *config.Config) {
+			conf.Privacy.Signals = dnt.PolicyAnonymous
+		})
+		b := servertest.NewBonjour()
+		b.Platform = "app:ios"
+		b.DoNotTrack = true
+		c := s.MustDial(b)
+		c.MustReadSession()
+		c.Close()
+		visit(t, s, signaling())
+
+		bonjours := s.Store.Bonjours()
+		if len(bonjours) != 2 || bonjours[0].UID != "" || bonjours[1].UID != "" {
+			t.Fatal("expect bonjours recorded without uid, got", bonjours)
+		}
+		impressions := s.Store.Impressions()
+		if len(impressions) != 3 {
+			t.Fatal("expect impressions recorded, got", impressions)
+		}
+		for _, i := range impressions {
+			if i.BonjourID != "" {
+				t.Error("expect impression unlinked from the session, got", i)
+			}
+		}
+		if events := s.Store.EventsSearchResultEntered(); len(events) != 1 || events[0].BonjourID != "" {
+			t.Error("expect event unlinked from the session, got", events)
+		}
+	})
+
+	t.Run("should record nothing with the aggregate policy", func(t *testing.T) {
+		s := servertest.Start(t, func(conf *config.Config) {
+			conf.Privacy.Signals = dnt.PolicyAggregate
+		})
+		b := signaling()
+		b.Header = http.Header{"Dnt": {"1"}}
+		visit(t, s, b)
+		if n := len(s.Store.Bonjours()) + len(s.Store.Impressions()) + len(s.Store.EventsSearchResultEntered()); n != 0 {
+			t.Error("expect nothing recorded, got", n, "records")
+		}
+		if metric := `probe_session_user_agent_total{browser="chrome",device="desktop",os="windows",site="main"} 1`; !strings.Contains(metrics(t, s), metric) {
+			t.Error("expect session counted by user agent as", metric)
+		}
+	})
+}
+
+// metrics returns the metrics exposed by s
+func metrics(t *testing.T, s *servertest.Server) string {
+	resp, err := s.Get("/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestGeoIP(t *testing.T) {
+	file := geoiptest.Write(t, map[string]string{"127.0.0.0/8": "JP"})
+	for name, c := range map[string]struct {
+		labeled []string
+		label   string
+	}{
+		"should label countries labeled on their own": {[]string{"CN", "JP"}, "JP"},
+		"should label other countries as other":       {[]string{"CN"}, "other"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s := servertest.Start(t, func(conf *config.Config) {
+				conf.GeoIP.File = file
+				conf.GeoIP.MetricCountries = c.labeled
+			})
+			client := s.MustDial(servertest.NewBonjour())
+			client.MustReadSession()
+			client.Close()
+			s.WaitIdle()
+
+			if bonjours := s.Store.Bonjours(); len(bonjours) != 1 || bonjours[0].Country != "JP" {
+				t.Error("expect country of the client recorded, got", bonjours)
+			}
+			if metric := `probe_unique_view_total{country="` + c.label + `",platform="web",site="main"} 1`; !strings.Contains(metrics(t, s), metric) {
+				t.Error("expect unique view labeled as", metric)
+			}
+		})
+	}
+}
+
+func TestAttribution(t *testing.T) {
+	s := servertest.Start(t, func(conf *config.Config) {
+		conf.Admin.Token = "admin-token"
+	})
+	getSources := func(query, token string) *http.Response {
+		req, err := http.NewRequest(http.MethodGet, s.URL+"/sources"+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	visit := func(b servertest.Bonjour) {
+		client := s.MustDial(b)
+		client.MustReadSession()
+		client.Close()
+		s.WaitIdle()
+	}
+
+	campaign := servertest.NewBonjour()
+	campaign.Referer = "/?utm_source=GitHub&utm_medium=readme"
+	visit(campaign)
+	visit(campaign.Reconnect(""))
+
+	search := servertest.NewBonjour()
+	search.DocumentReferrer = "https://www.google.co.jp/"
+	visit(search)
+
+	// clients reporting bare routes are attributed by the Referer header
+	header := servertest.NewBonjour()
+	header.Header = http.Header{"Referer": {"https://penguin-stats.io/?utm_source=github"}}
+	visit(header)
+
+	legacy := servertest.NewBonjour()
+	legacy.Legacy = true
+	legacy.Header = http.Header{"Referer": {"https://www.bilibili.com/video/1"}}
+	resp, err := s.Request(legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	t.Run("should attribute landing sessions only", func(t *testing.T) {
+		bonjours := s.Store.Bonjours()
+		if len(bonjours) != 5 {
+			t.Fatal("expect 5 bonjours recorded, got", len(bonjours))
+		}
+		if b := bonjours[0]; b.UTMSource != "github" || b.UTMMedium != "readme" || b.ReferrerClass != "direct" {
+			t.Error("expect landing attributed to the campaign, got", b)
+		}
+		if b := bonjours[1]; b.UTMSource != "" || b.ReferrerClass != "" {
+			t.Error("expect reconnect left unattributed, got", b)
+		}
+		if b := bonjours[2]; b.ReferrerDomain != "google.co.jp" || b.ReferrerClass != "search" {
+			t.Error("expect landing attributed to the search engine, got", b)
+		}
+		if b := bonjours[3]; b.UTMSource != "github" || b.ReferrerClass != "direct" {
+			t.Error("expect landing attributed to the campaign of the page, got", b)
+		}
+		if b := bonjours[4]; b.ReferrerDomain != "bilibili.com" || b.ReferrerClass != "social" {
+			t.Error("expect legacy landing attributed to the social network, got", b)
+		}
+	})
+
+	t.Run("should report top sources", func(t *testing.T) {
+		resp := getSources("?limit=2", "admin-token")
+		defer resp.Body.Close()
+		var sources []model.Source
+		if err := json.NewDecoder(resp.Body).Decode(&sources); err != nil {
+			t.Fatal(err)
+		}
+		expected := []model.Source{{Class: "direct", Source: "github", Sessions: 2}, {Class: "search", Source: "google.co.jp", Sessions: 1}}
+		if len(sources) != len(expected) || sources[0] != expected[0] || sources[1] != expected[1] {
+			t.Error("expect top sources", expected, "got", sources)
+		}
+	})
+
+	t.Run("should reject invalid periods", func(t *testing.T) {
+		resp := getSources("?since=2023-01-02T00:00:00Z&until=2023-01-01T00:00:00Z", "admin-token")
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Error("expect bad request, got", resp.StatusCode)
+		}
+	})
+
+	t.Run("should reject requests without the admin token", func(t *testing.T) {
+		resp := getSources("", "forged")
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Error("expect unauthorized, got", resp.StatusCode)
+		}
+
+		resp, err := servertest.Start(t, nil).Get("/sources")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Error("expect sources not served without an admin token, got", resp.StatusCode)
+		}
+	})
+}
+
+func TestRealIP(t *testing.T) {
+	file := geoiptest.Write(t, map[string]string{"127.0.0.0/8": "CN", "203.0.113.0/24": "JP"})
+	src := &net.TCPAddr{IP: net.ParseIP("203.0.113.7").To4(), Port: 56324}
+	proxy := &net.TCPAddr{IP: net.ParseIP("127.0.0.1").To4(), Port: 8100}
+	for name, c := range map[string]struct {
+		trusted       []string
+		header        string
+		proxyProtocol bool
+		request       http.Header
+		proxyHeader   []byte
+		country       string
+	}{
+		"should resolve from headers of trusted proxies":   {[]string{"127.0.0.0/8"}, "x-forwarded-for", false, http.Header{"X-Forwarded-For": {"203.0.113.7"}}, nil, "JP"},
+		"should ignore headers of untrusted peers":         {nil, "x-forwarded-for", false, http.Header{"X-Forwarded-For": {"203.0.113.7"}}, nil, "CN"},
+		"should resolve from proxy protocol v1":            {[]string{"127.0.0.1"}, "none", true, nil, proxyproto.HeaderV1(src, proxy), "JP"},
+		"should resolve from proxy protocol v2":            {[]string{"127.0.0.1"}, "none", true, nil, proxyproto.HeaderV2(src, proxy), "JP"},
+		"should accept trusted peers without proxy header": {[]string{"127.0.0.1"}, "none", true, nil, nil, "CN"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s := servertest.Start(t, func(conf *config.Config) {
+				conf.GeoIP.File = file
+				conf.Proxy.Trusted = c.trusted
+				conf.Proxy.Header = c.header
+				conf.Proxy.ProxyProtocol = c.proxyProtocol
+			})
+			b := servertest.NewBonjour()
+			b.Header = c.request
+			b.ProxyHeader = c.proxyHeader
+			client := s.MustDial(b)
+			client.MustReadSession()
+			client.Close()
+			s.WaitIdle()
+
+			if bonjours := s.Store.Bonjours(); len(bonjours) != 1 || bonjours[0].Country != c.country {
+				t.Error("expect country", c.country, "of the client recorded, got", bonjours)
+			}
+		})
+	}
+}
+
+func TestOrigins(t *testing.T) {
+	s := servertest.Start(t, func(conf *config.Config) {
+		conf.Origins.AllowAll = false
+	})
+
+	for origin, allowed := range map[string]bool{
+		"https://penguin-stats.io":    true,
+		"https://cn.penguin-stats.cn": true,
+		"capacitor://localhost":       true,
+		"https://evil.example.com":    false,
+		"http://localhost:8080":       false,
+	} {
+		b := servertest.NewBonjour()
+		b.Header = http.Header{"Origin": {origin}}
+		client, resp, err := s.Dial(b)
+		if allowed && err != nil {
+			t.Error("expect upgrade from", origin, "allowed, got", err)
+		}
+		if !allowed && (err == nil || resp == nil || resp.StatusCode == http.StatusSwitchingProtocols) {
+			t.Error("expect upgrade from", origin, "rejected")
+		}
+		if client != nil {
+			client.Close()
+		}
+		s.WaitIdle()
+	}
+	if metric := `probe_origin_rejected_total{check="websocket",origin="https://evil.example.com"} 1`; !strings.Contains(metrics(t, s), metric) {
+		t.Error("expect rejection counted as", metric)
+	}
+
+	t.Run("should allow cors requests of the same origins", func(t *testing.T) {
+		for origin, allowed := range map[string]bool{
+			"https://penguin-stats.io": true,
+			"https://evil.example.com": false,
+		} {
+			req, err := http.NewRequest(http.MethodOptions, s.URL+"/opt-out", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Origin", origin)
+			req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if actual := resp.Header.Get("Access-Control-Allow-Origin") == origin; actual != allowed {
+				t.Error("expect cors of", origin, "allowed", allowed, "got", resp.Header)
+			}
+		}
+		if metric := `probe_origin_rejected_total{check="cors",origin="https://evil.example.com"} 1`; !strings.Contains(metrics(t, s), metric) {
+			t.Error("expect rejection counted as", metric)
+		}
+	})
+
+	t.Run("should allow the origins of the environment", func(t *testing.T) {
+		s := servertest.Start(t, func(conf *config.Config) {
+			conf.Origins.AllowAll = false
+			conf.Origins.Environment = config.EnvironmentDevelopment
+		})
+		b := servertest.NewBonjour()
+		b.Header = http.Header{"Origin": {"http://localhost:8080"}}
+		client := s.MustDial(b)
+		client.MustReadSession()
+		client.Close()
+	})
+}
+
+func TestSites(t *testing.T) {
+	s := servertest.Start(t, func(conf *config.Config) {
+		conf.Origins.AllowAll = false
+		conf.Sites = []config.Site{{
+			ID:       "docs",
+			Key:      "docs-key",
+			Origins:  []string{"https://docs.example.com"},
+			Messages: []string{"NAVIGATED"},
+		}}
+	})
+	docs := func() servertest.Bonjour {
+		b := servertest.NewBonjour()
+		b.SiteKey = "docs-key"
+		b.Header = http.Header{"Origin": {"https://docs.example.com"}}
+		return b
+	}
+
+	t.Run("should record the site of the key on every row", func(t *testing.T) {
+		c := s.MustDial(docs())
+		c.MustReadSession()
+		c.MustSend(servertest.EnteredSearchResult("1-7", "main_01-07", 0))
+		c.MustReadACK()
+		if ack := c.MustReadACK(); ack.GetMessage() != "invalid websocket message" {
+			t.Error("expect message type not allowed for the site reported, got", ack)
+		}
+		c.MustSend(servertest.Navigated("/planner"))
+		c.MustReadACK()
+		c.Close()
+		s.WaitIdle()
+
+		if bonjours := s.Store.Bonjours(); len(bonjours) != 1 || bonjours[0].Site != "docs" {
+			t.Error("expect bonjour recorded for the site, got", bonjours)
+		}
+		impressions := s.Store.Impressions()
+		if len(impressions) != 2 {
+			t.Error("expect impressions recorded, got", impressions)
+		}
+		for _, impression := range impressions {
+			if impression.Site != "docs" {
+				t.Error("expect impression recorded for the site, got", impression)
+			}
+		}
+		if events := s.Store.EventsSearchResultEntered(); len(events) != 0 {
+			t.Error("expect messages not allowed for the site not recorded, got", events)
+		}
+		m := metrics(t, s)
+		for _, metric := range []string{
+			`probe_unique_view_total{country="unknown",platform="web",site="docs"} 1`,
+			`probe_page_view_total{platform="web",site="docs"} 2`,
+			`probe_invalid_message_total{reason="disallowed_type"} 1`,
+		} {
+			if !strings.Contains(m, metric) {
+				t.Error("expect site counted as", metric)
+			}
+		}
+	})
+
+	t.Run("should reject unknown site keys", func(t *testing.T) {
+		b := docs()
+		b.SiteKey = "unknown"
+		if _, resp, err := s.Dial(b); err == nil || resp == nil || resp.StatusCode != http.StatusForbidden {
+			t.Error("expect unknown site key rejected, got", resp, err)
+		}
+	})
+
+	t.Run("should allow upgrades from the origins of the site only", func(t *testing.T) {
+		b := docs()
+		b.Header = nil
+		if _, resp, err := s.Dial(b); err == nil || resp == nil || resp.StatusCode == http.StatusSwitchingProtocols {
+			t.Error("expect upgrade from the main site to the site rejected")
+		}
+		b = servertest.NewBonjour()
+		b.Header = http.Header{"Origin": {"https://docs.example.com"}}
+		if _, resp, err := s.Dial(b); err == nil || resp == nil || resp.StatusCode == http.StatusSwitchingProtocols {
+			t.Error("expect upgrade from the site to the main site rejected")
+		}
+		s.WaitIdle()
+	})
+}
+
+func TestBroadcast(t *testing.T) {
+	servers := servertest.StartCluster(t, 2, func(conf *config.Config) {
+		conf.Admin.Token = "admin-token"
+	})
+	broadcast := func(token, message string) *http.Response {
+		req, err := http.NewRequest(http.MethodPost, servers[0].URL+"/broadcast", strings.NewReader(url.Values{"message": {message}}.Encode()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	dial := func(s *servertest.Server, subprotocol, capabilities string) *servertest.Client {
+		b := servertest.NewBonjour()
+		b.Subprotocols = []string{subprotocol}
+		b.Capabilities = capabilities
+		return s.MustDial(b)
+	}
+	local, remote := dial(servers[0], "probe.v2+pb", "broadcast"), dial(servers[1], "probe.v2+pb", "broadcast")
+	legacy, undeclared := dial(servers[1], "pb", ""), dial(servers[1], "probe.v2+pb", "seqack")
+
+	if resp := broadcast("forged", "maintenance at 10:00"); resp.StatusCode != http.StatusUnauthorized {
+		t.Error("expect broadcast without the admin token rejected, got", resp.StatusCode)
+	}
+	if resp := broadcast("admin-token", "maintenance at 10:00"); resp.StatusCode != http.StatusAccepted {
+		t.Fatal("expect broadcast accepted, got", resp.StatusCode)
+	}
+
+	t.Run("should push broadcasts to clients of every instance", func(t *testing.T) {
+		for _, c := range []*servertest.Client{local, remote} {
+			m, err := c.ReadBroadcast()
+			if err != nil || m.GetMessage() != "maintenance at 10:00" {
+				t.Error("expect broadcast received, got", m, err)
+			}
+		}
+	})
+
+	t.Run("should not push broadcasts to clients which did not negotiate them", func(t *testing.T) {
+		for _, c := range []*servertest.Client{legacy, undeclared} {
+			c.MustSend(servertest.Navigated("/planner"))
+			if ack, err := c.ReadACK(); err != nil || ack.GetType() != messages.MessageType_NAVIGATED {
+				t.Error("expect nothing but the ACK received, got", ack, err)
+			}
+		}
+	})
+}
+
+func TestShutdown(t *testing.T) {
+	s := servertest.Start(t, func(conf *config.Config) {
+		conf.Shutdown.ReadinessDelay = 200 * time.Millisecond
+	})
+
+	c := s.MustDial(servertest.NewBonjour())
+	c.MustReadSession()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ctx, cancel := context.WithTimeout(context.Background(), servertest.Timeout)
+		defer cancel()
+		s.Shutdown(ctx)
+	}()
+
+	t.Run("should fail readiness and reject new connections while draining", func(t *testing.T) {
+		deadline := time.Now().Add(servertest.Timeout)
+		for {
+			resp, err := s.Get("/ready")
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusServiceUnavailable {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("expect readiness to fail")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		_, resp, err := s.Dial(servertest.NewBonjour())
+		if err == nil || resp == nil || resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Retry-After") == "" {
+			t.Error("expect new connection rejected, got", resp, err)
+		}
+	})
+
+	t.Run("should ask connected clients to go away", func(t *testing.T) {
+		if closeErr := c.ReadClose(); closeErr == nil || closeErr.Code != websocket.CloseGoingAway {
+			t.Error("expect connection closed as going away, got", closeErr)
+		}
+	})
+
+	<-done
+	if err := s.Store.Ping(context.Background()); err == nil {
+		t.Error("expect store closed once drained")
+	}
+	if n := len(s.Store.Bonjours()); n != 1 {
+		t.Error("expect records kept, got", n)
+	}
+}
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	s := servertest.Start(t, nil)
+
+	c := s.MustDial(servertest.NewBonjour())
+	c.MustReadSession()
+	c.MustSend(servertest.Navigated("/planner"))
+	c.MustReadACK()
+	c.Close()
+	s.WaitIdle()
+
+	spans := map[string][]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = append(spans[span.Name()], span)
+	}
+	if len(spans["session"]) != 1 || len(spans["message"]) != 1 {
+		t.Fatal("expect a session and a message span, got", spans)
+	}
+	session, message := spans["session"][0], spans["message"][0]
+
+	for _, name := range []string{"bind", "upgrade", "RecordBonjour"} {
+		if len(spans[name]) != 1 || spans[name][0].Parent().SpanID() != session.SpanContext().SpanID() {
+			t.Error("expect", name, "traced within the session")
+		}
+	}
+
+	if message.SpanContext().TraceID() == session.SpanContext().TraceID() {
+		t.Error("expect message traced on its own")
+	}
+	if links := message.Links(); len(links) != 1 || links[0].SpanContext.SpanID() != session.SpanContext().SpanID() {
+		t.Error("expect message linked to the session, got", links)
+	}
+	impressions := spans["RecordImpression"]
+	if len(impressions) != 2 || impressions[1].Parent().SpanID() != message.SpanContext().SpanID() {
+		t.Error("expect impression of the navigation recorded within the message span")
+	}
+}
@@ -0,0 +1,174 @@
+package servertest
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/penguin-statistics/probe/internal/pkg/messages"
+)
+
+// Client is a websocket client which speaks the protobuf protocol of probe
+type Client struct {
+	Conn *websocket.Conn
+
+	t   testing.TB
+	seq uint32
+}
+
+// Message is a message the client sends. Its Meta is filled in by Send.
+type Message interface {
+	proto.Message
+	GetMeta() *messages.Meta
+}
+
+// Navigated returns a Navigated message to path
+func Navigated(path string) *messages.Navigated {
+	return &messages.Navigated{Meta: &messages.Meta{Type: messages.MessageType_NAVIGATED}, Path: path}
+}
+
+// EnteredSearchResult returns an EnteredSearchResult message of query leading to stageID
+func EnteredSearchResult(query, stageID string, position uint32) *messages.EnteredSearchResult {
+	return &messages.EnteredSearchResult{
+		Meta:     &messages.Meta{Type: messages.MessageType_ENTERED_SEARCH_RESULT},
+		Query:    query,
+		Position: position,
+		Id:       &messages.EnteredSearchResult_StageId{StageId: stageID},
+	}
+}
+
+// SetSeq sets the sequence number of the last message sent, e.g. to continue a resumed session
+func (c *Client) SetSeq(seq uint32) {
+	c.seq = seq
+}
+
+// Send numbers m with the next sequence number and sends it. It returns the sequence number.
+func (c *Client) Send(m Message) (uint32, error) {
+	c.seq++
+	m.GetMeta().Seq = c.seq
+	b, err := proto.Marshal(m)
+	if err != nil {
+		return 0, err
+	}
+	return c.seq, c.SendRaw(websocket.BinaryMessage, b)
+}
+
+// MustSend sends m as Send does, failing the test on errors
+func (c *Client) MustSend(m Message) uint32 {
+	c.t.Helper()
+	seq, err := c.Send(m)
+	if err != nil {
+		c.t.Fatal("failed to send:", err)
+	}
+	return seq
+}
+
+// SendRaw sends p in a frame of messageType as is, e.g. to send invalid messages
+func (c *Client) SendRaw(messageType int, p []byte) error {
+	c.Conn.SetWriteDeadline(time.Now().Add(Timeout))
+	return c.Conn.WriteMessage(messageType, p)
+}
+
+// read reads the next message sent by the server along with its type
+func (c *Client) read() (messages.MessageType, []byte, error) {
+	c.Conn.SetReadDeadline(time.Now().Add(Timeout))
+	typ, b, err := c.Conn.ReadMessage()
+	if err != nil {
+		return 0, nil, err
+	}
+	if typ != websocket.BinaryMessage {
+		return 0, nil, fmt.Errorf("unexpected frame type %d", typ)
+	}
+	var ack messages.ServerACK
+	if err := proto.Unmarshal(b, &ack); err != nil {
+		return 0, nil, err
+	}
+	return ack.GetType(), b, nil
+}
+
+// ReadACK reads the next message sent by the server, which shall be a ServerACK
+func (c *Client) ReadACK() (*messages.ServerACK, error) {
+	typ, b, err := c.read()
+	if err != nil {
+		return nil, err
+	}
+	if typ == messages.MessageType_SERVER_SESSION || typ == messages.MessageType_SERVER_BROADCAST {
+		return nil, fmt.Errorf("unexpected message of type %v", typ)
+	}
+	var ack messages.ServerACK
+	return &ack, proto.Unmarshal(b, &ack)
+}
+
+// MustReadACK reads a ServerACK as ReadACK does, failing the test on errors
+func (c *Client) MustReadACK() *messages.ServerACK {
+	c.t.Helper()
+	ack, err := c.ReadACK()
+	if err != nil {
+		c.t.Fatal("failed to read ACK:", err)
+	}
+	return ack
+}
+
+// ReadSession reads the next message sent by the server, which shall be a ServerSession
+func (c *Client) ReadSession() (*messages.ServerSession, error) {
+	typ, b, err := c.read()
+	if err != nil {
+		return nil, err
+	}
+	if typ != messages.MessageType_SERVER_SESSION {
+		return nil, fmt.Errorf("unexpected message of type %v", typ)
+	}
+	var session messages.ServerSession
+	return &session, proto.Unmarshal(b, &session)
+}
+
+// MustReadSession reads a ServerSession as ReadSession does, failing the test on errors
+func (c *Client) MustReadSession() *messages.ServerSession {
+	c.t.Helper()
+	session, err := c.ReadSession()
+	if err != nil {
+		c.t.Fatal("failed to read ServerSession:", err)
+	}
+	return session
+}
+
+// ReadBroadcast reads the next message sent by the server, which shall be a ServerBroadcast
+func (c *Client) ReadBroadcast() (*messages.ServerBroadcast, error) {
+	typ, b, err := c.read()
+	if err != nil {
+		return nil, err
+	}
+	if typ != messages.MessageType_SERVER_BROADCAST {
+		return nil, fmt.Errorf("unexpected message of type %v", typ)
+	}
+	var broadcast messages.ServerBroadcast
+	return &broadcast, proto.Unmarshal(b, &broadcast)
+}
+
+// ReadClose discards messages sent by the server until the connection is closed and returns the close frame
+// received, or nil if the connection has been closed without one
+func (c *Client) ReadClose() *websocket.CloseError {
+	for {
+		if _, _, err := c.read(); err != nil {
+			var closeErr *websocket.CloseError
+			if errors.As(err, &closeErr) {
+				return closeErr
+			}
+			var netErr interface{ Timeout() bool }
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				c.t.Error("timed out waiting for the connection to be closed")
+			}
+			return nil
+		}
+	}
+}
+
+// Close closes the connection normally
+func (c *Client) Close() error {
+	c.Conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(Timeout))
+	return c.Conn.Close()
+}
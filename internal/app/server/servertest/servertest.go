@@ -0,0 +1,279 @@
+// Package servertest boots probe servers in-process for end-to-end tests
+package servertest
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dchest/uniuri"
+	"github.com/gorilla/websocket"
+
+	"github.com/penguin-statistics/probe/internal/app/config"
+	"github.com/penguin-statistics/probe/internal/app/repository"
+	"github.com/penguin-statistics/probe/internal/app/server"
+	"github.com/penguin-statistics/probe/internal/pkg/cluster"
+)
+
+// Timeout bounds every wait of the harness, so that a broken server fails tests rather than hanging them
+const Timeout = 5 * time.Second
+
+// Server is a probe server listening on an ephemeral port of the loopback interface
+type Server struct {
+	*server.Server
+
+	// URL is the base url of the server, e.g. http://127.0.0.1:12345
+	URL string
+	// Store holds everything recorded by the server
+	Store *repository.Memory
+
+	t            testing.TB
+	shutdownonce sync.Once
+}
+
+// Config returns the config Start boots servers with: the defaults, with all origins allowed and a quick shutdown
+func Config() *config.Config {
+	conf := config.Default()
+	conf.Origins.AllowAll = true
+	conf.Shutdown.Timeout = Timeout
+	conf.Shutdown.ReadinessDelay = 0
+	conf.Shutdown.Spread = 0
+	return conf
+}
+
+// Start boots a server with an in-memory store, which is shut down once the test finishes. configure, if not nil,
+// customizes the config returned by Config. As the config is process-wide, tests using Start shall not run in parallel.
+func Start(t testing.TB, configure func(conf *config.Config)) *Server {
+	t.Helper()
+	return start(t, configure, nil)
+}
+
+// StartCluster boots n servers as Start does, which gossip with each other over an in-process network as nodes
+// named node-0 to node-<n-1>
+func StartCluster(t testing.TB, n int, configure func(conf *config.Config)) []*Server {
+	t.Helper()
+	network := cluster.NewNetwork()
+	servers := make([]*Server, n)
+	for i := range servers {
+		node := "node-" + strconv.Itoa(i)
+		servers[i] = start(t, func(conf *config.Config) {
+			conf.Cluster.Node = node
+			if configure != nil {
+				configure(conf)
+			}
+		}, network.Join(node))
+	}
+	return servers
+}
+
+func start(t testing.TB, configure func(conf *config.Config), transport cluster.Transport) *Server {
+	t.Helper()
+	conf := Config()
+	if configure != nil {
+		configure(conf)
+	}
+	if err := config.Set(conf); err != nil {
+		t.Fatal("invalid config:", err)
+	}
+
+	store := repository.NewMemory()
+	s, err := server.NewWithTransport(conf, store, transport)
+	if err != nil {
+		t.Fatal("failed to create server:", err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("failed to listen:", err)
+	}
+	s.Echo.HideBanner = true
+	s.Echo.HidePort = true
+	go s.Serve(ln)
+
+	ts := &Server{
+		Server: s,
+		URL:    "http://" + ln.Addr().String(),
+		Store:  store,
+		t:      t,
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+		defer cancel()
+		ts.Shutdown(ctx)
+	})
+	return ts
+}
+
+// Shutdown drains the server as on a termination signal. It is safe to be called multiple times.
+func (s *Server) Shutdown(ctx context.Context) {
+	s.shutdownonce.Do(func() {
+		s.Server.Shutdown(ctx)
+	})
+}
+
+// WaitIdle waits for the handlers of the connections closed to finish recording, failing the test on timeout
+func (s *Server) WaitIdle() {
+	s.t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+	if err := s.Wait(ctx); err != nil {
+		s.t.Fatal("timed out waiting for connections to finish")
+	}
+}
+
+// Get requests path of the server
+func (s *Server) Get(path string) (*http.Response, error) {
+	client := http.Client{Timeout: Timeout}
+	return client.Get(s.URL + path)
+}
+
+// PostForm sends a POST request with form to path of the server
+func (s *Server) PostForm(path string, form url.Values) (*http.Response, error) {
+	client := http.Client{Timeout: Timeout}
+	return client.PostForm(s.URL+path, form)
+}
+
+// Bonjour describes the bonjour request a client starts a connection with
+type Bonjour struct {
+	Version  string
+	Platform string
+	UID      string
+	Referer  string
+	// DocumentReferrer is the referrer of the page landed on
+	DocumentReferrer string
+	// SiteKey is the key of the site the client belongs to, if other than the main site
+	SiteKey    string
+	Legacy     bool
+	Reconnects int
+	// ResumeToken is the token of the session to resume on reconnects
+	ResumeToken string
+	// Subprotocols are offered during the upgrade. Capabilities are declared in the query.
+	Subprotocols []string
+	Capabilities string
+	// DoNotTrack is the privacy signal of apps in the query. Browsers signal with DNT or Sec-GPC in Header instead.
+	DoNotTrack bool
+	// Header is sent along with the request. Origin and User-Agent default to those of a browser on penguin-stats.io.
+	Header http.Header
+	// ProxyHeader is sent ahead of the request on the connection, as PROXY protocol proxies do
+	ProxyHeader []byte
+}
+
+// NewBonjour returns the bonjour of a web client visiting / for the first time, which speaks the latest protocol
+// with all capabilities
+func NewBonjour() Bonjour {
+	return Bonjour{
+		Version:      "v3.4.1",
+		Platform:     "web",
+		UID:          uniuri.NewLen(32),
+		Referer:      "/",
+		Subprotocols: []string{"probe.v2+pb"},
+		Capabilities: "seqack,batch,resume",
+	}
+}
+
+// Reconnect returns the bonjour of the same client reconnecting, resuming the session of token if not empty
+func (b Bonjour) Reconnect(token string) Bonjour {
+	b.Reconnects++
+	b.ResumeToken = token
+	return b
+}
+
+func (b Bonjour) query() url.Values {
+	q := url.Values{}
+	set := func(key, value string) {
+		if value != "" {
+			q.Set(key, value)
+		}
+	}
+	set("v", b.Version)
+	set("p", b.Platform)
+	set("u", b.UID)
+	set("r", b.Referer)
+	set("dr", b.DocumentReferrer)
+	set("s", b.SiteKey)
+	if b.Legacy {
+		q.Set("l", "1")
+	}
+	if b.Reconnects > 0 {
+		q.Set("i", strconv.Itoa(b.Reconnects))
+	}
+	set("t", b.ResumeToken)
+	set("c", b.Capabilities)
+	if b.DoNotTrack {
+		q.Set("dnt", "1")
+	}
+	return q
+}
+
+func (b Bonjour) header() http.Header {
+	h := http.Header{}
+	h.Set("Origin", "https://penguin-stats.io")
+	h.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
+	h.Set("Accept-Language", "en-US,en;q=0.9")
+	for key, values := range b.Header {
+		h[key] = values
+	}
+	return h
+}
+
+// Request sends b as a plain http request without upgrading, e.g. as legacy clients do
+func (s *Server) Request(b Bonjour) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, s.URL+"/?"+b.query().Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = b.header()
+	client := http.Client{Timeout: Timeout, Transport: &http.Transport{DialContext: b.dial}}
+	return client.Do(req)
+}
+
+// dial connects to addr, sending ProxyHeader first if any
+func (b Bonjour) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, addr)
+	if err != nil || len(b.ProxyHeader) == 0 {
+		return conn, err
+	}
+	if _, err := conn.Write(b.ProxyHeader); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// Dial connects to the server with b. The response is returned along with the error if the upgrade failed.
+func (s *Server) Dial(b Bonjour) (*Client, *http.Response, error) {
+	d := websocket.Dialer{
+		NetDialContext:   b.dial,
+		Subprotocols:     b.Subprotocols,
+		HandshakeTimeout: Timeout,
+	}
+	ws, resp, err := d.Dial("ws"+strings.TrimPrefix(s.URL, "http")+"/?"+b.query().Encode(), b.header())
+	if err != nil {
+		return nil, resp, err
+	}
+	c := &Client{Conn: ws, t: s.t}
+	s.t.Cleanup(func() {
+		ws.Close()
+	})
+	return c, resp, nil
+}
+
+// MustDial connects to the server with b, failing the test if the upgrade failed
+func (s *Server) MustDial(b Bonjour) *Client {
+	s.t.Helper()
+	c, resp, err := s.Dial(b)
+	if err != nil {
+		status := 0
+		if resp != nil {
+			status = resp.StatusCode
+		}
+		s.t.Fatal("failed to dial with status", status, err)
+	}
+	return c
+}
@@ -4,40 +4,87 @@ import (
 	"context"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+
 	"github.com/penguin-statistics/probe/internal/app/model"
 	"github.com/penguin-statistics/probe/internal/app/repository"
+	"github.com/penguin-statistics/probe/internal/pkg/pseudonym"
+	"github.com/penguin-statistics/probe/internal/pkg/searchquery"
+	"github.com/penguin-statistics/probe/internal/pkg/tracing"
 )
 
+var tracer = tracing.Tracer("service")
+
 // Bonjour is the bonjour service
 type Bonjour struct {
-	repo *repository.Probe
+	repo       repository.Store
+	pseudonyms *pseudonym.Pseudonymizer
+	queries    *searchquery.Processor
+}
+
+// NewBonjour creates a bonjour request-related service with repo. UIDs are stored as pseudonyms only, and search
+// queries as processed by queries.
+func NewBonjour(repo repository.Store, pseudonyms *pseudonym.Pseudonymizer, queries *searchquery.Processor) *Bonjour {
+	return &Bonjour{repo: repo, pseudonyms: pseudonyms, queries: queries}
+}
+
+// record runs insert within a span named name, so that the time spent in storage shows in traces
+func (s *Bonjour) record(ctx context.Context, name, bonjourID string, insert func(ctx context.Context) error) error {
+	ctx, span := tracer.Start(ctx, name)
+	span.SetAttributes(attribute.String("probe.bonjour.id", bonjourID))
+	err := insert(ctx)
+	tracing.End(span, err)
+	return err
 }
 
-// NewBonjour creates a bonjour request-related service with repo
-func NewBonjour(repo *repository.Probe) *Bonjour {
-	return &Bonjour{repo: repo}
+// RecordBonjour adds a bonjour request in model.Bonjour to db, with its UID replaced by a pseudonym. An empty UID,
+// i.e. of an anonymous visit, is kept empty.
+func (s *Bonjour) RecordBonjour(ctx context.Context, b *model.Bonjour) error {
+	pseudonymized := *b
+	if b.UID != "" {
+		pseudonymized.UID = s.pseudonyms.Pseudonymize(b.UID)
+	}
+	return s.record(ctx, "RecordBonjour", b.ID, func(ctx context.Context) error {
+		return s.repo.InsertBonjour(ctx, &pseudonymized)
+	})
 }
 
-// RecordBonjour adds a bonjour request in model.Bonjour to db
-func (s *Bonjour) RecordBonjour(b *model.Bonjour) error {
-	return s.repo.DB.Exec(context.Background(), "insert into bonjours (id, created_at, version, platform, uid, legacy) values (?, ?, ?, ?, ?)", b.ID, time.Now().Format("2006-01-02 15:04:05"), b.Version, b.Platform, b.UID, b.Legacy)
+// RecordBonjourFlag adds a late classification of a bonjour in model.BonjourFlag to db
+func (s *Bonjour) RecordBonjourFlag(ctx context.Context, b *model.BonjourFlag) error {
+	return s.record(ctx, "RecordBonjourFlag", b.BonjourID, func(ctx context.Context) error {
+		return s.repo.InsertBonjourFlag(ctx, b)
+	})
 }
 
 // RecordImpression adds a view request in model.Bonjour to db
-func (s *Bonjour) RecordImpression(b *model.Impression) error {
-	return s.repo.DB.Exec(context.Background(), "insert into impressions (id, bonjour_id, path) values (?, ?, ?)", b.ID, b.BonjourID, b.Path)
+func (s *Bonjour) RecordImpression(ctx context.Context, b *model.Impression) error {
+	return s.record(ctx, "RecordImpression", b.BonjourID, func(ctx context.Context) error {
+		return s.repo.InsertImpression(ctx, b)
+	})
 }
 
-// RecordEventSearchResultEntered adds a search result entered event in model.EventSearchResultEntered to db
-func (s *Bonjour) RecordEventSearchResultEntered(b *model.EventSearchResultEntered) error {
-	return s.repo.DB.Exec(context.Background(), "insert into event_search_result_entered (id, bonjour_id, query, result_position, destination) values (?, ?, ?, ?, ?)", b.ID, b.BonjourID, b.Query, b.ResultPosition, b.Destination)
+// RecordEventSearchResultEntered adds a search result entered event in model.EventSearchResultEntered to db,
+// with its query truncated, redacted and normalized
+func (s *Bonjour) RecordEventSearchResultEntered(ctx context.Context, b *model.EventSearchResultEntered) error {
+	query := s.queries.Process(b.Query)
+	processed := *b
+	processed.Query = query.Query
+	processed.QueryRaw = query.Raw
+	return s.record(ctx, "RecordEventSearchResultEntered", b.BonjourID, func(ctx context.Context) error {
+		return s.repo.InsertEventSearchResultEntered(ctx, &processed)
+	})
 }
 
-// Count counts current bonjour requests from db
+// TopSources returns the sources the most landing sessions of site created within [since, until) have been attributed to
+func (s *Bonjour) TopSources(ctx context.Context, site string, since, until time.Time, limit int) (sources []model.Source, err error) {
+	ctx, span := tracer.Start(ctx, "TopSources")
+	defer func() {
+		tracing.End(span, err)
+	}()
+	return s.repo.TopSources(ctx, site, since, until, limit)
+}
+
+// Count counts current bonjour requests of the main site which have not been flagged as bot or suspect from db
 func (s *Bonjour) Count() (uint64, error) {
-	var count uint64
-	if err := s.repo.DB.QueryRow(context.Background(), "select count(*) from bonjours").Scan(&count); err != nil {
-		return 0, err
-	}
-	return count, nil
+	return s.repo.CountUsers(context.Background())
 }
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"time"
+
+	"github.com/elliotchance/pie/pie"
+
+	"github.com/penguin-statistics/probe/internal/app/repository"
+)
+
+// ExportTables are the tables which can be exported
+var ExportTables = pie.Strings{"bonjours", "bonjour_flags", "impressions", "event_search_result_entered"}
+
+// ExportFormats are the formats tables can be exported in
+var ExportFormats = pie.Strings{"csv", "jsonl"}
+
+// Export is the data export service
+type Export struct {
+	repo *repository.Probe
+}
+
+// NewExport creates a data export service with repo
+func NewExport(repo *repository.Probe) *Export {
+	return &Export{repo: repo}
+}
+
+// Export writes rows of table created within [since, until) to w in format. It returns the amount of rows written.
+func (s *Export) Export(ctx context.Context, w io.Writer, table, format string, since, until time.Time) (int, error) {
+	if !ExportTables.Contains(table) {
+		return 0, fmt.Errorf("unknown table %q: shall be one of %v", table, ExportTables)
+	}
+	if !ExportFormats.Contains(format) {
+		return 0, fmt.Errorf("unknown format %q: shall be one of %v", format, ExportFormats)
+	}
+
+	// table is validated against ExportTables above
+	rows, err := s.repo.DB.Query(ctx, "select * from "+table+" where created_at >= ? and created_at < ? order by created_at", since, until)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	columns := rows.Columns()
+	types := rows.ColumnTypes()
+	var write func(values []interface{}) error
+	var flush func() error
+	if format == "csv" {
+		cw := csv.NewWriter(w)
+		if err := cw.Write(columns); err != nil {
+			return 0, err
+		}
+		record := make([]string, len(columns))
+		write = func(values []interface{}) error {
+			for i, v := range values {
+				if t, ok := v.(time.Time); ok {
+					record[i] = t.UTC().Format(time.RFC3339Nano)
+				} else {
+					record[i] = fmt.Sprint(v)
+				}
+			}
+			return cw.Write(record)
+		}
+		flush = func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+	} else {
+		enc := json.NewEncoder(w)
+		write = func(values []interface{}) error {
+			object := make(map[string]interface{}, len(columns))
+			for i, v := range values {
+				object[columns[i]] = v
+			}
+			return enc.Encode(object)
+		}
+		flush = func() error {
+			return nil
+		}
+	}
+
+	n := 0
+	dest := make([]interface{}, len(types))
+	values := make([]interface{}, len(types))
+	for rows.Next() {
+		for i, t := range types {
+			dest[i] = reflect.New(t.ScanType()).Interface()
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return n, err
+		}
+		for i := range dest {
+			values[i] = reflect.ValueOf(dest[i]).Elem().Interface()
+		}
+		if err := write(values); err != nil {
+			return n, err
+		}
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return n, err
+	}
+	return n, flush()
+}
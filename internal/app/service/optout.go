@@ -0,0 +1,192 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/elliotchance/pie/pie"
+	"github.com/oklog/ulid/v2"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/penguin-statistics/probe/internal/app/model"
+	"github.com/penguin-statistics/probe/internal/app/repository"
+	"github.com/penguin-statistics/probe/internal/pkg/logger"
+	"github.com/penguin-statistics/probe/internal/pkg/pseudonym"
+	"github.com/penguin-statistics/probe/internal/pkg/tracing"
+)
+
+var log = logger.New("service")
+
+// OptOut is the opt-out service. Users who opted out are never recorded again, and the sessions recorded
+// for them are deleted by deletion jobs.
+type OptOut struct {
+	repo       repository.Store
+	pseudonyms *pseudonym.Pseudonymizer
+	interval   time.Duration
+	wake       chan struct{}
+
+	mu     sync.RWMutex
+	hashes map[string]struct{}
+}
+
+// NewOptOut creates an opt-out service with repo, which refreshes the opt-out list and retries deletion jobs every interval
+func NewOptOut(repo repository.Store, pseudonyms *pseudonym.Pseudonymizer, interval time.Duration) *OptOut {
+	return &OptOut{
+		repo:       repo,
+		pseudonyms: pseudonyms,
+		interval:   interval,
+		wake:       make(chan struct{}, 1),
+		hashes:     make(map[string]struct{}),
+	}
+}
+
+// HashUID returns the hash uid is kept in the opt-out list with. Unlike pseudonyms it never rotates, so that users
+// stay opted out for good, and as UIDs are random it can't be reversed.
+func HashUID(uid string) string {
+	sum := sha256.Sum256([]byte(uid))
+	return hex.EncodeToString(sum[:])
+}
+
+// OptedOut reports whether the user of uid opted out
+func (s *OptOut) OptedOut(uid string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.hashes[HashUID(uid)]
+	return ok
+}
+
+// Load loads the opt-out list from db, picking up users who opted out through other instances
+func (s *OptOut) Load(ctx context.Context) error {
+	hashes, err := s.repo.OptOuts(ctx)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	for _, hash := range hashes {
+		s.hashes[hash] = struct{}{}
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+// OptOut adds the user of uid to the opt-out list and schedules a deletion job for the sessions recorded for them.
+// Only the sessions recorded under the salts kept can be found: older ones are unlinkable to the user already.
+func (s *OptOut) OptOut(ctx context.Context, uid string) (*model.Deletion, error) {
+	hash := HashUID(uid)
+	if err := s.repo.InsertOptOut(ctx, hash); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.hashes[hash] = struct{}{}
+	s.mu.Unlock()
+
+	now := time.Now().UTC()
+	d := &model.Deletion{
+		ID:        ulid.Make().String(),
+		UIDs:      s.pseudonyms.Pseudonyms(uid),
+		Status:    model.DeletionPending,
+		Tables:    []string{},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := s.repo.SaveDeletion(ctx, d); err != nil {
+		return nil, err
+	}
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return d, nil
+}
+
+// Deletion returns the deletion job by id, or repository.ErrNotFound
+func (s *OptOut) Deletion(ctx context.Context, id string) (*model.Deletion, error) {
+	return s.repo.Deletion(ctx, id)
+}
+
+// Run refreshes the opt-out list and runs the pending deletion jobs every interval, or as soon as a job is scheduled,
+// until ctx is done. Deletions interrupted are run again on the next start.
+func (s *OptOut) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		s.runDeletions(ctx)
+		select {
+		case <-ticker.C:
+			if err := s.Load(ctx); err != nil {
+				log.Warnln("failed to refresh opt-out list", err)
+			}
+		case <-s.wake:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// runDeletions runs the deletion jobs which have not been completed, including the failed and interrupted ones
+func (s *OptOut) runDeletions(ctx context.Context) {
+	ds, err := s.repo.PendingDeletions(ctx)
+	if err != nil {
+		log.Warnln("failed to get pending deletions", err)
+		return
+	}
+	for _, d := range ds {
+		if err := s.runDeletion(ctx, d); err != nil {
+			log.WithField("deletion", d.ID).Warnln("deletion failed", err)
+			d.Status = model.DeletionFailed
+			d.Error = err.Error()
+			d.UpdatedAt = time.Now().UTC()
+			if err := s.repo.SaveDeletion(ctx, d); err != nil {
+				log.WithField("deletion", d.ID).Warnln("failed to save deletion", err)
+			}
+		}
+	}
+}
+
+// runDeletion deletes the events referencing the sessions of d from every event table, then the sessions themselves,
+// saving the progress after each table. Tables already cleared on a previous attempt are skipped.
+func (s *OptOut) runDeletion(ctx context.Context, d *model.Deletion) (err error) {
+	ctx, span := tracer.Start(ctx, "RunDeletion")
+	span.SetAttributes(attribute.String("probe.deletion.id", d.ID))
+	defer func() {
+		tracing.End(span, err)
+	}()
+
+	save := func(status model.DeletionStatus) error {
+		d.Status = status
+		d.Error = ""
+		d.UpdatedAt = time.Now().UTC()
+		return s.repo.SaveDeletion(ctx, d)
+	}
+	if err := save(model.DeletionRunning); err != nil {
+		return err
+	}
+
+	tables, err := s.repo.EventTables(ctx)
+	if err != nil {
+		return err
+	}
+	for _, table := range tables {
+		if pie.Strings(d.Tables).Contains(table) {
+			continue
+		}
+		if err := s.repo.DeleteEvents(ctx, table, d.UIDs); err != nil {
+			return err
+		}
+		d.Tables = append(d.Tables, table)
+		if err := save(model.DeletionRunning); err != nil {
+			return err
+		}
+	}
+
+	// sessions go last, as events are found by the sessions they reference
+	if err := s.repo.DeleteBonjours(ctx, d.UIDs); err != nil {
+		return err
+	}
+	d.Tables = append(d.Tables, "bonjours")
+	return save(model.DeletionDone)
+}
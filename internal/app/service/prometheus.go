@@ -1,8 +1,12 @@
 package service
 
 import (
+	"net/http"
+
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 const (
@@ -10,48 +14,151 @@ const (
 )
 
 type Prometheus struct {
-	pv        *prometheus.CounterVec
-	uv        *prometheus.CounterVec
-	users     *prometheus.CounterFunc
-	reconn    *prometheus.HistogramVec
-	liveUsers *prometheus.GaugeFunc
+	registry         *prometheus.Registry
+	pv               *prometheus.CounterVec
+	uv               *prometheus.CounterVec
+	users            *prometheus.CounterFunc
+	reconn           *prometheus.HistogramVec
+	liveUsers        *prometheus.GaugeFunc
+	clusterLiveUsers *prometheus.GaugeFunc
+	flagged          *prometheus.CounterVec
+	rejected         *prometheus.CounterVec
+	invalid          *prometheus.CounterVec
+	kicked           *prometheus.CounterVec
+	throttled        *prometheus.CounterVec
+	redacted         prometheus.Counter
+	userAgents       *prometheus.CounterVec
+	originRejected   *prometheus.CounterVec
+	originUnmatched  *prometheus.CounterVec
 }
 
+// NewPrometheus creates the metrics of probe in a registry of their own, along with the go and process metrics,
+// so that multiple servers are able to live in a single process, e.g. in tests
 func NewPrometheus() *Prometheus {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	factory := promauto.With(registry)
 	return &Prometheus{
-		pv: promauto.NewCounterVec(prometheus.CounterOpts{
+		registry: registry,
+		pv: factory.NewCounterVec(prometheus.CounterOpts{
 			Namespace: PromNamespace,
 			Name:      "page_view_total",
-			Help:      "Page views partitioned by platform and path",
-		}, []string{"platform"}),
-		uv: promauto.NewCounterVec(prometheus.CounterOpts{
+			Help:      "Page views partitioned by site and platform",
+		}, []string{"site", "platform"}),
+		uv: factory.NewCounterVec(prometheus.CounterOpts{
 			Namespace: PromNamespace,
 			Name:      "unique_view_total",
-			Help:      "Unique views partitioned by platform and path, where path is the first page visited",
-		}, []string{"platform"}),
-		reconn: promauto.NewHistogramVec(prometheus.HistogramOpts{
+			Help:      "Unique views partitioned by site, platform and country, where country is bounded to the countries labeled",
+		}, []string{"site", "platform", "country"}),
+		reconn: factory.NewHistogramVec(prometheus.HistogramOpts{
 			Namespace: PromNamespace,
 			Name:      "reconnection_histogram",
 			Help:      "Reconnection values as histogram representing how many times a client has tried to reconnect the service",
 			Buckets:   []float64{0, 1, 2, 3, 5, 8, 15, 40, 100, 1000, 10000},
+		}, []string{"site", "platform"}),
+		flagged: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: PromNamespace,
+			Name:      "flagged_view_total",
+			Help:      "Views excluded from page and unique views as they are classified as bot or suspect traffic",
+		}, []string{"site", "platform", "classification"}),
+		rejected: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: PromNamespace,
+			Name:      "connection_rejected_total",
+			Help:      "Connections rejected before the upgrade partitioned by the limit they have reached",
+		}, []string{"reason"}),
+		invalid: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: PromNamespace,
+			Name:      "invalid_message_total",
+			Help:      "Invalid messages received partitioned by the reason they are invalid",
+		}, []string{"reason"}),
+		kicked: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: PromNamespace,
+			Name:      "policy_disconnect_total",
+			Help:      "Clients disconnected for violating the policy partitioned by the reason",
+		}, []string{"reason"}),
+		throttled: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: PromNamespace,
+			Name:      "throttled_message_total",
+			Help:      "Messages dropped by the rate limit partitioned by platform",
 		}, []string{"platform"}),
+		redacted: factory.NewCounter(prometheus.CounterOpts{
+			Namespace: PromNamespace,
+			Name:      "search_query_redacted_total",
+			Help:      "Search queries with anything redacted before they are stored, counted once per query",
+		}),
+		userAgents: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: PromNamespace,
+			Name:      "session_user_agent_total",
+			Help:      "Sessions started partitioned by site, browser family, OS family and device class, including flagged traffic",
+		}, []string{"site", "browser", "os", "device"}),
+		originRejected: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: PromNamespace,
+			Name:      "origin_rejected_total",
+			Help:      "Requests rejected for their origin partitioned by the check, either cors or websocket, and the origin, where origin is bounded to the first origins rejected",
+		}, []string{"check", "origin"}),
+		originUnmatched: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: PromNamespace,
+			Name:      "origin_unmatched_total",
+			Help:      "Requests allowed by origins.allowAll although their origin is not matched by the rules partitioned by the check, either cors or websocket, and the origin, where origin is bounded to the first origins unmatched or rejected",
+		}, []string{"check", "origin"}),
 	}
 }
 
-func (p *Prometheus) IncUV(platform string) {
-	p.uv.WithLabelValues(platform).Inc()
+// Handler serves the metrics in the Prometheus exposition format
+func (p *Prometheus) Handler() http.Handler {
+	return promhttp.InstrumentMetricHandler(p.registry, promhttp.HandlerFor(p.registry, promhttp.HandlerOpts{}))
 }
 
-func (p *Prometheus) IncPV(platform string) {
-	p.pv.WithLabelValues(platform).Inc()
+func (p *Prometheus) IncUV(site, platform, country string) {
+	p.uv.WithLabelValues(site, platform, country).Inc()
 }
 
-func (p *Prometheus) RecordReconnection(platform string, reconnects int) {
-	p.reconn.WithLabelValues(platform).Observe(float64(reconnects))
+func (p *Prometheus) IncPV(site, platform string) {
+	p.pv.WithLabelValues(site, platform).Inc()
+}
+
+func (p *Prometheus) IncFlagged(site, platform string, classification string) {
+	p.flagged.WithLabelValues(site, platform, classification).Inc()
+}
+
+func (p *Prometheus) IncRejected(reason string) {
+	p.rejected.WithLabelValues(reason).Inc()
+}
+
+func (p *Prometheus) IncInvalidMessage(reason string) {
+	p.invalid.WithLabelValues(reason).Inc()
+}
+
+func (p *Prometheus) IncPolicyDisconnect(reason string) {
+	p.kicked.WithLabelValues(reason).Inc()
+}
+
+func (p *Prometheus) IncThrottled(platform string) {
+	p.throttled.WithLabelValues(platform).Inc()
+}
+
+func (p *Prometheus) IncRedacted() {
+	p.redacted.Inc()
+}
+
+func (p *Prometheus) IncUserAgent(site, browser, os, device string) {
+	p.userAgents.WithLabelValues(site, browser, os, device).Inc()
+}
+
+func (p *Prometheus) IncOriginRejected(check, origin string) {
+	p.originRejected.WithLabelValues(check, origin).Inc()
+}
+
+func (p *Prometheus) IncOriginUnmatched(check, origin string) {
+	p.originUnmatched.WithLabelValues(check, origin).Inc()
+}
+
+func (p *Prometheus) RecordReconnection(site, platform string, reconnects int) {
+	p.reconn.WithLabelValues(site, platform).Observe(float64(reconnects))
 }
 
 func (p *Prometheus) RegisterLiveUserFunc(function func() float64) {
-	g := promauto.NewGaugeFunc(prometheus.GaugeOpts{
+	g := promauto.With(p.registry).NewGaugeFunc(prometheus.GaugeOpts{
 		Namespace: PromNamespace,
 		Name:      "live_users",
 		Help:      "Live users connected to probe",
@@ -60,8 +167,18 @@ func (p *Prometheus) RegisterLiveUserFunc(function func() float64) {
 	p.liveUsers = &g
 }
 
+func (p *Prometheus) RegisterClusterLiveUserFunc(function func() float64) {
+	g := promauto.With(p.registry).NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: PromNamespace,
+		Name:      "cluster_live_users",
+		Help:      "Live users connected to all probe instances within the cluster",
+	}, function)
+
+	p.clusterLiveUsers = &g
+}
+
 func (p *Prometheus) RegisterUsersFunc(function func() float64) {
-	g := promauto.NewCounterFunc(prometheus.CounterOpts{
+	g := promauto.With(p.registry).NewCounterFunc(prometheus.CounterOpts{
 		Namespace: PromNamespace,
 		Name:      "users_count",
 		Help:      "Users count in total which connected to the probe service",
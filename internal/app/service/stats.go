@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/penguin-statistics/probe/internal/app/model"
+	"github.com/penguin-statistics/probe/internal/app/repository"
+	"github.com/penguin-statistics/probe/internal/pkg/botdetect"
+)
+
+// Stats is the quick statistics service
+type Stats struct {
+	repo *repository.Probe
+}
+
+// NewStats creates a quick statistics service with repo
+func NewStats(repo *repository.Probe) *Stats {
+	return &Stats{repo: repo}
+}
+
+// Summary summarizes the traffic recorded since, with top paths of the most impressions
+func (s *Stats) Summary(ctx context.Context, since time.Time, top int) (*model.Stats, error) {
+	stats := &model.Stats{Since: since}
+
+	count, err := s.repo.CountUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stats.Users = count
+
+	rows, err := s.repo.DB.Query(ctx, "select platform, classification, count() from bonjours where created_at >= ? group by platform, classification order by platform, classification", since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var platform, classification uint8
+		var c model.BonjourCount
+		if err := rows.Scan(&platform, &classification, &c.Count); err != nil {
+			return nil, err
+		}
+		p := model.Platform(platform)
+		c.Platform = p.Marshal()
+		c.Classification = botdetect.Classification(classification).String()
+		stats.Bonjours = append(stats.Bonjours, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.DB.QueryRow(ctx, "select count() from impressions where created_at >= ?", since).Scan(&stats.Impressions); err != nil {
+		return nil, err
+	}
+
+	rows, err = s.repo.DB.Query(ctx, "select path, count() as c from impressions where created_at >= ? group by path order by c desc limit ?", since, top)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var c model.PathCount
+		if err := rows.Scan(&c.Path, &c.Count); err != nil {
+			return nil, err
+		}
+		stats.TopPaths = append(stats.TopPaths, c)
+	}
+	return stats, rows.Err()
+}
@@ -0,0 +1,123 @@
+// Package attribution attributes landings to campaigns, by the UTM parameters of the route landed on, and to
+// sources, by the referrer of the page classified into a bounded set of classes
+package attribution
+
+import (
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/elliotchance/pie/pie"
+	"golang.org/x/net/publicsuffix"
+)
+
+// Classes of referrers
+const (
+	// ClassDirect is a landing without referrer
+	ClassDirect = "direct"
+	// ClassInternal is a landing referred by a page of our own domains
+	ClassInternal = "internal"
+	// ClassSearch is a landing referred by a search engine
+	ClassSearch = "search"
+	// ClassSocial is a landing referred by a social network, forum or video site
+	ClassSocial = "social"
+	// ClassReferral is a landing referred by any other site
+	ClassReferral = "referral"
+)
+
+// maxValueLength is the maximum bytes of UTM values and domains kept
+const maxValueLength = 64
+
+// searchDomains and socialDomains are matched against the registrable domain of referrers without public suffix,
+// e.g. google for google.co.jp. socialHosts are matched against the whole host before.
+var (
+	searchDomains = pie.Strings{"google", "bing", "baidu", "yandex", "duckduckgo", "yahoo", "naver", "sogou", "so", "sm", "ecosia", "brave", "startpage", "qwant", "seznam", "daum"}
+	socialDomains = pie.Strings{"twitter", "x", "t", "facebook", "fb", "instagram", "threads", "reddit", "weibo", "bilibili", "b23", "youtube", "youtu", "tiktok", "douyin", "discord", "zhihu", "nga", "ngabbs", "skland", "xiaohongshu", "xhslink", "bsky", "telegram", "line", "vk", "kakao", "qq"}
+	socialHosts   = pie.Strings{"tieba.baidu.com", "m.tieba.baidu.com"}
+)
+
+// Attribution is the attribution of a landing
+type Attribution struct {
+	// Source, Medium and Campaign are the utm_source, utm_medium and utm_campaign of the route landed on
+	Source   string
+	Medium   string
+	Campaign string
+	// ReferrerDomain is the registrable domain of an external referrer, e.g. google.co.jp
+	ReferrerDomain string
+	// ReferrerClass is the class of the referrer
+	ReferrerClass string
+}
+
+// Resolve attributes a landing on route, which may carry UTM parameters in its query string, referred by referrer.
+// Referrers of the registrable domains internal are classified as internal.
+func Resolve(route, referrer string, internal []string) Attribution {
+	var a Attribution
+	if u, err := url.Parse(route); err == nil {
+		q := u.Query()
+		a.Source = value(q.Get("utm_source"))
+		a.Medium = value(q.Get("utm_medium"))
+		a.Campaign = value(q.Get("utm_campaign"))
+	}
+
+	host := ""
+	if u, err := url.Parse(referrer); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		host = strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	}
+	if host == "" {
+		a.ReferrerClass = ClassDirect
+		return a
+	}
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		// e.g. addresses and localhost
+		domain = host
+	}
+	if pie.Strings(internal).Contains(domain) {
+		a.ReferrerClass = ClassInternal
+		return a
+	}
+
+	a.ReferrerDomain = truncate(domain)
+	name := domain
+	if i := strings.Index(domain, "."); i > 0 {
+		name = domain[:i]
+	}
+	switch {
+	case socialHosts.Contains(host):
+		a.ReferrerClass = ClassSocial
+	case searchDomains.Contains(name):
+		a.ReferrerClass = ClassSearch
+	case socialDomains.Contains(name):
+		a.ReferrerClass = ClassSocial
+	default:
+		a.ReferrerClass = ClassReferral
+	}
+	return a
+}
+
+// IsInternal reports whether the registrable domain of rawURL is one of internal
+func IsInternal(rawURL string, internal []string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Hostname() == "" {
+		return false
+	}
+	domain, err := publicsuffix.EffectiveTLDPlusOne(strings.ToLower(u.Hostname()))
+	return err == nil && pie.Strings(internal).Contains(domain)
+}
+
+// value normalizes a UTM value
+func value(v string) string {
+	return truncate(strings.ToLower(strings.TrimSpace(v)))
+}
+
+// truncate truncates s to maxValueLength bytes without splitting a character
+func truncate(s string) string {
+	if len(s) <= maxValueLength {
+		return s
+	}
+	s = s[:maxValueLength]
+	for !utf8.ValidString(s) {
+		s = s[:len(s)-1]
+	}
+	return s
+}
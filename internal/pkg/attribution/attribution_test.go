@@ -0,0 +1,50 @@
+package attribution
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	internal := []string{"penguin-stats.io", "penguin-stats.cn"}
+	for _, c := range []struct {
+		route, referrer string
+		expected        Attribution
+	}{
+		{"/", "", Attribution{ReferrerClass: ClassDirect}},
+		{"/?utm_source=GitHub&utm_medium=readme&utm_campaign=Launch", "", Attribution{Source: "github", Medium: "readme", Campaign: "launch", ReferrerClass: ClassDirect}},
+		{"/result/stage", "https://www.google.co.jp/", Attribution{ReferrerDomain: "google.co.jp", ReferrerClass: ClassSearch}},
+		{"/", "https://tieba.baidu.com/p/1", Attribution{ReferrerDomain: "baidu.com", ReferrerClass: ClassSocial}},
+		{"/", "https://www.baidu.com/s?wd=penguin", Attribution{ReferrerDomain: "baidu.com", ReferrerClass: ClassSearch}},
+		{"/", "https://www.bilibili.com/video/1", Attribution{ReferrerDomain: "bilibili.com", ReferrerClass: ClassSocial}},
+		{"/", "https://prts.wiki/w/1", Attribution{ReferrerDomain: "prts.wiki", ReferrerClass: ClassReferral}},
+		{"/", "https://cn.penguin-stats.cn/search", Attribution{ReferrerClass: ClassInternal}},
+		{"/", "android-app://com.example", Attribution{ReferrerClass: ClassDirect}},
+		{"/", "://", Attribution{ReferrerClass: ClassDirect}},
+	} {
+		if actual := Resolve(c.route, c.referrer, internal); actual != c.expected {
+			t.Errorf("expect %+v for %q referred by %q, got %+v", c.expected, c.route, c.referrer, actual)
+		}
+	}
+
+	t.Run("should truncate long values", func(t *testing.T) {
+		a := Resolve("/?utm_campaign="+strings.Repeat("a", 100), "", internal)
+		if len(a.Campaign) != maxValueLength {
+			t.Error("expect campaign truncated, got", a.Campaign)
+		}
+	})
+}
+
+func TestIsInternal(t *testing.T) {
+	internal := []string{"penguin-stats.io"}
+	for url, expected := range map[string]bool{
+		"https://penguin-stats.io/result":       true,
+		"https://www.penguin-stats.io/":         true,
+		"https://penguin-stats.io.example.com/": false,
+		"":                                      false,
+	} {
+		if actual := IsInternal(url, internal); actual != expected {
+			t.Errorf("expect %v for %q, got %v", expected, url, actual)
+		}
+	}
+}
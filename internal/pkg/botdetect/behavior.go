@@ -0,0 +1,54 @@
+package botdetect
+
+import "time"
+
+const (
+	// navigationWindow is the window in which navigations are counted to determine the navigation rate
+	navigationWindow = 10 * time.Second
+	// maxNavigationsPerWindow is the maximum navigations a human is able to perform within navigationWindow
+	maxNavigationsPerWindow = 20
+)
+
+// Behavior tracks behavioral signals of a single connection. It is not safe for concurrent use.
+type Behavior struct {
+	resumed      bool
+	navigations  int
+	windowStart  time.Time
+	windowCount  int
+	rateExceeded bool
+}
+
+// NewBehavior creates a Behavior tracker. Connections of resumed sessions never raise SignalZeroNavigation,
+// as the client may have navigated within its previous connections.
+func NewBehavior(resumed bool) *Behavior {
+	return &Behavior{resumed: resumed}
+}
+
+// Navigated records a navigation happened at now
+func (b *Behavior) Navigated(now time.Time) {
+	b.navigations++
+	if now.Sub(b.windowStart) > navigationWindow {
+		b.windowStart = now
+		b.windowCount = 0
+	}
+	b.windowCount++
+	if b.windowCount > maxNavigationsPerWindow {
+		b.rateExceeded = true
+	}
+}
+
+// RateExceeded reports whether the session has ever navigated faster than a human is able to
+func (b *Behavior) RateExceeded() bool {
+	return b.rateExceeded
+}
+
+// Signals returns the behavioral signals raised so far
+func (b *Behavior) Signals() (signals []Signal) {
+	if b.navigations == 0 && !b.resumed {
+		signals = append(signals, SignalZeroNavigation)
+	}
+	if b.rateExceeded {
+		signals = append(signals, SignalNavigationRate)
+	}
+	return signals
+}
@@ -0,0 +1,176 @@
+// Package botdetect classifies bonjour requests and sessions as human, suspect or bot traffic
+package botdetect
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql/driver"
+	_ "embed"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+)
+
+//go:embed rules.txt
+var defaultRules []byte
+
+const (
+	// suspectScore is the minimum score for traffic to be classified as Suspect
+	suspectScore = 50
+	// botScore is the minimum score for traffic to be classified as Bot
+	botScore = 100
+)
+
+// Classification is the result of classifying traffic
+type Classification uint8
+
+const (
+	// Human is traffic which seems to be initiated by a real user
+	Human Classification = iota
+	// Suspect is traffic with some signals of automation
+	Suspect
+	// Bot is traffic which is almost certainly automated
+	Bot
+)
+
+// String returns the name of the classification, used as a metric label
+func (c Classification) String() string {
+	switch c {
+	case Human:
+		return "human"
+	case Suspect:
+		return "suspect"
+	case Bot:
+		return "bot"
+	}
+	return "unknown"
+}
+
+// Value implements driver.Valuer
+func (c Classification) Value() (driver.Value, error) {
+	return uint8(c), nil
+}
+
+// Signal is a single piece of evidence of automated traffic
+type Signal struct {
+	Name  string
+	Score int
+}
+
+var (
+	// SignalUserAgentRule is raised when the User-Agent matches one of the rules
+	SignalUserAgentRule = Signal{Name: "ua_rule", Score: botScore}
+	// SignalMissingUserAgent is raised when the request has no User-Agent at all
+	SignalMissingUserAgent = Signal{Name: "missing_ua", Score: botScore}
+	// SignalMissingAcceptLanguage is raised when the request has no Accept-Language, which every browser sends
+	SignalMissingAcceptLanguage = Signal{Name: "missing_accept_language", Score: 30}
+	// SignalMissingOrigin is raised when a web client does not send an Origin on upgrade, which every browser does
+	SignalMissingOrigin = Signal{Name: "missing_origin", Score: 30}
+	// SignalNoUpgrade is raised when a non-legacy client never upgrades to websocket
+	SignalNoUpgrade = Signal{Name: "no_upgrade", Score: 50}
+	// SignalZeroNavigation is raised when a session ends without any navigation
+	SignalZeroNavigation = Signal{Name: "zero_navigation", Score: 20}
+	// SignalNavigationRate is raised when a session navigates faster than a human is able to
+	SignalNavigationRate = Signal{Name: "navigation_rate", Score: botScore}
+)
+
+// Verdict is the accumulated evidence of a bonjour request or session
+type Verdict struct {
+	Score   int
+	Signals []string
+}
+
+// With returns a new Verdict with signals added
+func (v Verdict) With(signals ...Signal) Verdict {
+	n := Verdict{Score: v.Score, Signals: append([]string(nil), v.Signals...)}
+	for _, s := range signals {
+		n.Score += s.Score
+		n.Signals = append(n.Signals, s.Name)
+	}
+	return n
+}
+
+// Classification classifies the verdict by its score
+func (v Verdict) Classification() Classification {
+	switch {
+	case v.Score >= botScore:
+		return Bot
+	case v.Score >= suspectScore:
+		return Suspect
+	}
+	return Human
+}
+
+// Reason returns the names of the signals raised as a comma-separated list
+func (v Verdict) Reason() string {
+	return strings.Join(v.Signals, ",")
+}
+
+// Classifier classifies bonjour requests by User-Agent rules and headers
+type Classifier struct {
+	rules []*regexp.Regexp
+}
+
+// New creates a Classifier with User-Agent rules loaded from rulesFile, or the default rules if rulesFile is empty
+func New(rulesFile string) (*Classifier, error) {
+	var r io.Reader = bytes.NewReader(defaultRules)
+	if rulesFile != "" {
+		f, err := os.Open(rulesFile)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	rules, err := parseRules(r)
+	if err != nil {
+		return nil, err
+	}
+	return &Classifier{rules: rules}, nil
+}
+
+func parseRules(r io.Reader) (rules []*regexp.Regexp, err error) {
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		s := strings.TrimSpace(scanner.Text())
+		if s == "" || strings.HasPrefix(s, "#") {
+			continue
+		}
+		rule, err := regexp.Compile("(?i)" + s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rule on line %d: %w", line, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, scanner.Err()
+}
+
+// Classify classifies a bonjour request by its headers. web is whether the client claims to be a web client,
+// in which case browser-only headers are expected as well.
+func (c *Classifier) Classify(r *http.Request, web bool) Verdict {
+	var v Verdict
+
+	ua := r.UserAgent()
+	if ua == "" {
+		return v.With(SignalMissingUserAgent)
+	}
+	for _, rule := range c.rules {
+		if rule.MatchString(ua) {
+			return v.With(SignalUserAgentRule)
+		}
+	}
+
+	if r.Header.Get("Accept-Language") == "" {
+		v = v.With(SignalMissingAcceptLanguage)
+	}
+	if web && r.Header.Get("Upgrade") != "" && r.Header.Get("Origin") == "" {
+		v = v.With(SignalMissingOrigin)
+	}
+	return v
+}
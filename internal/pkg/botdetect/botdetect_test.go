@@ -0,0 +1,71 @@
+package botdetect
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClassify(t *testing.T) {
+	c, err := New("")
+	if err != nil {
+		t.Fatal("failed to load default rules", err)
+	}
+
+	testCases := map[string]struct {
+		headers  map[string]string
+		expected Classification
+	}{
+		"browser": {
+			headers:  map[string]string{"User-Agent": "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Safari/605.1.15", "Accept-Language": "zh-CN"},
+			expected: Human,
+		},
+		"crawler": {
+			headers:  map[string]string{"User-Agent": "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", "Accept-Language": "en"},
+			expected: Bot,
+		},
+		"missing user agent": {
+			headers:  map[string]string{"Accept-Language": "en"},
+			expected: Bot,
+		},
+		"browser without browser headers": {
+			headers:  map[string]string{"User-Agent": "Mozilla/5.0", "Upgrade": "websocket"},
+			expected: Suspect,
+		},
+	}
+	for name, tc := range testCases {
+		r := httptest.NewRequest("GET", "/", nil)
+		for k, v := range tc.headers {
+			r.Header.Set(k, v)
+		}
+		if got := c.Classify(r, true).Classification(); got != tc.expected {
+			t.Errorf("%s: expect %v, got %v", name, tc.expected, got)
+		}
+	}
+}
+
+func TestBehavior(t *testing.T) {
+	t.Run("should only raise zero navigation on fresh sessions", func(t *testing.T) {
+		if s := NewBehavior(false).Signals(); len(s) != 1 || s[0] != SignalZeroNavigation {
+			t.Error("expect zero navigation signal, got", s)
+		}
+		if s := NewBehavior(true).Signals(); len(s) != 0 {
+			t.Error("expect no signals, got", s)
+		}
+	})
+
+	t.Run("should raise navigation rate on impossible navigations", func(t *testing.T) {
+		b := NewBehavior(false)
+		now := time.Now()
+		for i := 0; i < maxNavigationsPerWindow; i++ {
+			b.Navigated(now.Add(time.Duration(i) * 100 * time.Millisecond))
+		}
+		if b.RateExceeded() {
+			t.Fatal("expect rate not exceeded yet")
+		}
+		b.Navigated(now.Add(3 * time.Second))
+		if !b.RateExceeded() {
+			t.Fatal("expect rate exceeded")
+		}
+	})
+}
@@ -0,0 +1,168 @@
+// Package cluster coordinates probe instances behind a load balancer: instances share their live counts
+// with each other and relay broadcast messages to the clients connected to the other instances
+package cluster
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// staleIntervals is the amount of publish intervals after which the state of a silent peer is ignored
+const staleIntervals = 3
+
+// State is the live state of a single instance
+type State struct {
+	// Node is the name of the instance
+	Node string `json:"node"`
+	// Live is the amount of clients connected to the instance
+	Live int `json:"live"`
+	// Routes is the amount of clients connected to the instance partitioned by their current route
+	Routes map[string]int `json:"routes"`
+	// At is the time the state has been received at. It is set by the receiving Transport.
+	At time.Time `json:"-"`
+}
+
+// Transport exchanges states and broadcasts between instances
+type Transport interface {
+	// Publish shares st of the local instance with the peers
+	Publish(st State)
+	// Broadcast relays payload to the peers
+	Broadcast(payload []byte)
+	// Peers returns the last states received from the peers
+	Peers() []State
+	// OnMessage sets f to be called with every payload broadcast by the peers
+	OnMessage(f func(payload []byte))
+}
+
+// Source returns the current live state of the local instance
+type Source func() (live int, routes map[string]int)
+
+// Cluster aggregates live states of the local instance and its peers
+type Cluster struct {
+	node      string
+	transport Transport
+	interval  time.Duration
+	source    Source
+
+	mu        sync.RWMutex
+	onMessage func(payload []byte)
+}
+
+// New creates a Cluster for the local instance named node, which publishes the state from source every interval
+func New(node string, transport Transport, interval time.Duration, source Source) *Cluster {
+	c := &Cluster{
+		node:      node,
+		transport: transport,
+		interval:  interval,
+		source:    source,
+	}
+	transport.OnMessage(c.deliver)
+	return c
+}
+
+// Node returns the name of the local instance
+func (c *Cluster) Node() string {
+	return c.node
+}
+
+// Local returns the current state of the local instance
+func (c *Cluster) Local() State {
+	live, routes := c.source()
+	return State{Node: c.node, Live: live, Routes: routes, At: time.Now()}
+}
+
+// Live returns the amount of clients connected to the whole cluster, in total and partitioned by route.
+// Peers which have not published within a few intervals are considered gone.
+func (c *Cluster) Live() (int, map[string]int) {
+	local := c.Local()
+	live, routes := local.Live, make(map[string]int, len(local.Routes))
+	for route, n := range local.Routes {
+		routes[route] += n
+	}
+	deadline := time.Now().Add(-staleIntervals * c.interval)
+	for _, st := range c.transport.Peers() {
+		if st.Node == c.node || st.At.Before(deadline) {
+			continue
+		}
+		live += st.Live
+		for route, n := range st.Routes {
+			routes[route] += n
+		}
+	}
+	return live, routes
+}
+
+// OnMessage sets f to be called with every payload broadcast, from the local instance or the peers
+func (c *Cluster) OnMessage(f func(payload []byte)) {
+	c.mu.Lock()
+	c.onMessage = f
+	c.mu.Unlock()
+}
+
+// Broadcast delivers payload to the local instance and relays it to the peers
+func (c *Cluster) Broadcast(payload []byte) {
+	c.deliver(payload)
+	c.transport.Broadcast(payload)
+}
+
+func (c *Cluster) deliver(payload []byte) {
+	c.mu.RLock()
+	f := c.onMessage
+	c.mu.RUnlock()
+	if f != nil {
+		f(payload)
+	}
+}
+
+// Run publishes the state of the local instance every interval until ctx is done
+func (c *Cluster) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.transport.Publish(c.Local())
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Routes counts clients by their current route
+type Routes struct {
+	mu     sync.Mutex
+	routes map[string]int
+}
+
+// NewRoutes creates an empty Routes
+func NewRoutes() *Routes {
+	return &Routes{routes: make(map[string]int)}
+}
+
+// Move moves a client from route from to route to. An empty from adds a client, and an empty to removes one.
+func (r *Routes) Move(from, to string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if from != "" {
+		if r.routes[from] <= 1 {
+			delete(r.routes, from)
+		} else {
+			r.routes[from]--
+		}
+	}
+	if to != "" {
+		r.routes[to]++
+	}
+}
+
+// Snapshot returns a copy of the current counts
+func (r *Routes) Snapshot() map[string]int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	routes := make(map[string]int, len(r.routes))
+	for route, n := range r.routes {
+		routes[route] = n
+	}
+	return routes
+}
@@ -0,0 +1,129 @@
+package cluster
+
+import (
+	"context"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func staticSource(live int, routes map[string]int) Source {
+	return func() (int, map[string]int) {
+		return live, routes
+	}
+}
+
+func TestCluster(t *testing.T) {
+	network := NewNetwork()
+	a := New("a", network.Join("a"), time.Hour, staticSource(3, map[string]int{"/": 2, "/search": 1}))
+	b := New("b", network.Join("b"), time.Hour, staticSource(2, map[string]int{"/": 2}))
+
+	t.Run("should aggregate live counts of published peers", func(t *testing.T) {
+		if live, _ := a.Live(); live != 3 {
+			t.Fatal("expect only local count before peers publish, got", live)
+		}
+		b.transport.Publish(b.Local())
+		live, routes := a.Live()
+		if live != 5 || routes["/"] != 4 || routes["/search"] != 1 {
+			t.Fatal("expect aggregated counts, got", live, routes)
+		}
+	})
+
+	t.Run("should ignore stale peers", func(t *testing.T) {
+		c := New("c", network.Join("c"), time.Millisecond, staticSource(1, nil))
+		b.transport.Publish(b.Local())
+		if live, _ := c.Live(); live != 3 {
+			t.Fatal("expect fresh peer states to be aggregated, got", live)
+		}
+		time.Sleep(10 * time.Millisecond)
+		if live, _ := c.Live(); live != 1 {
+			t.Fatal("expect stale peer states to be ignored, got", live)
+		}
+	})
+
+	t.Run("should relay broadcasts to local and peers", func(t *testing.T) {
+		var mu sync.Mutex
+		received := map[string]string{}
+		for _, c := range []*Cluster{a, b} {
+			node := c.Node()
+			c.OnMessage(func(payload []byte) {
+				mu.Lock()
+				received[node] = string(payload)
+				mu.Unlock()
+			})
+		}
+		a.Broadcast([]byte("hello"))
+		if received["a"] != "hello" || received["b"] != "hello" {
+			t.Fatal("expect broadcast delivered to all nodes, got", received)
+		}
+	})
+
+	t.Run("should publish until ctx is done", func(t *testing.T) {
+		d := New("d", network.Join("d"), time.Millisecond, staticSource(4, nil))
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			d.Run(ctx)
+			close(done)
+		}()
+		published := func() bool {
+			for _, st := range a.transport.Peers() {
+				if st.Node == "d" {
+					return true
+				}
+			}
+			return false
+		}
+		for deadline := time.Now().Add(time.Second); !published(); time.Sleep(time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatal("expect state published")
+			}
+		}
+		cancel()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("expect Run to return once ctx is done")
+		}
+	})
+}
+
+func TestHTTP(t *testing.T) {
+	ta := NewHTTP("a", nil, "secret")
+	sa := httptest.NewServer(ta)
+	defer sa.Close()
+
+	tb := NewHTTP("b", []string{sa.URL + "/"}, "secret")
+	tb.Publish(State{Node: "b", Live: 2, Routes: map[string]int{"/": 2}})
+	peers := ta.Peers()
+	if len(peers) != 1 || peers[0].Node != "b" || peers[0].Live != 2 || peers[0].At.IsZero() {
+		t.Fatal("expect state of b received, got", peers)
+	}
+
+	var received []byte
+	ta.OnMessage(func(payload []byte) {
+		received = payload
+	})
+	tb.Broadcast([]byte("hello"))
+	if string(received) != "hello" {
+		t.Fatal("expect broadcast received, got", received)
+	}
+
+	impostor := NewHTTP("c", []string{sa.URL}, "wrong")
+	impostor.Publish(State{Node: "c", Live: 100})
+	if len(ta.Peers()) != 1 {
+		t.Fatal("expect state with wrong secret to be rejected")
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	r := NewRoutes()
+	r.Move("", "/")
+	r.Move("", "/")
+	r.Move("/", "/search")
+	r.Move("/search", "")
+	if routes := r.Snapshot(); len(routes) != 1 || routes["/"] != 1 {
+		t.Fatal("expect a single client at /, got", routes)
+	}
+}
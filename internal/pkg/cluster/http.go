@@ -0,0 +1,158 @@
+package cluster
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/penguin-statistics/probe/internal/pkg/logger"
+)
+
+// GossipPath is the path the HTTP transport receives peer requests at
+const GossipPath = "/cluster/gossip"
+
+// requestTimeout is the time allowed for a peer to respond to a gossip request
+const requestTimeout = 2 * time.Second
+
+// maxEnvelopeSize is the maximum size of gossip requests accepted
+const maxEnvelopeSize = 1 << 20
+
+var log = logger.New("cluster")
+
+// envelope is the body of gossip requests. Exactly one of State and Message is set.
+type envelope struct {
+	State   *State `json:"state,omitempty"`
+	Message []byte `json:"message,omitempty"`
+}
+
+// HTTP is a Transport which sends states and broadcasts to every configured peer over HTTP.
+// Peers authenticate each other by a shared secret.
+type HTTP struct {
+	node   string
+	peers  []string
+	secret string
+	client *http.Client
+
+	mu        sync.RWMutex
+	states    map[string]State
+	onMessage func(payload []byte)
+}
+
+// NewHTTP creates the HTTP transport of node. peers are the base URLs of the other instances,
+// and secret is the secret shared between all instances.
+func NewHTTP(node string, peers []string, secret string) *HTTP {
+	urls := make([]string, len(peers))
+	for i, peer := range peers {
+		urls[i] = strings.TrimSuffix(peer, "/") + GossipPath
+	}
+	return &HTTP{
+		node:   node,
+		peers:  urls,
+		secret: secret,
+		client: &http.Client{Timeout: requestTimeout},
+		states: make(map[string]State),
+	}
+}
+
+func (t *HTTP) Publish(st State) {
+	t.send(envelope{State: &st})
+}
+
+func (t *HTTP) Broadcast(payload []byte) {
+	t.send(envelope{Message: payload})
+}
+
+// send posts e to all peers concurrently. Unreachable peers are skipped: their states
+// expire at the other instances as well.
+func (t *HTTP) send(e envelope) {
+	body, err := json.Marshal(e)
+	if err != nil {
+		log.Warnln("failed to marshal gossip envelope", err)
+		return
+	}
+	var wg sync.WaitGroup
+	for _, peer := range t.peers {
+		wg.Add(1)
+		go func(peer string) {
+			defer wg.Done()
+			req, err := http.NewRequest(http.MethodPost, peer, bytes.NewReader(body))
+			if err != nil {
+				log.Warnln("failed to create gossip request", err)
+				return
+			}
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+t.secret)
+			resp, err := t.client.Do(req)
+			if err != nil {
+				log.Debugln("failed to gossip with peer", peer, err)
+				return
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusNoContent {
+				log.Debugln("peer", peer, "rejected gossip with status", resp.StatusCode)
+			}
+		}(peer)
+	}
+	wg.Wait()
+}
+
+func (t *HTTP) Peers() []State {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	states := make([]State, 0, len(t.states))
+	for _, st := range t.states {
+		states = append(states, st)
+	}
+	return states
+}
+
+func (t *HTTP) OnMessage(f func(payload []byte)) {
+	t.mu.Lock()
+	t.onMessage = f
+	t.mu.Unlock()
+}
+
+// ServeHTTP receives gossip requests from the peers. It shall be mounted at GossipPath.
+func (t *HTTP) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(t.secret)) != 1 {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var e envelope
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxEnvelopeSize)).Decode(&e); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	switch {
+	case e.State != nil:
+		if e.State.Node == "" || e.State.Node == t.node {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		e.State.At = time.Now()
+		t.mu.Lock()
+		t.states[e.State.Node] = *e.State
+		t.mu.Unlock()
+	case e.Message != nil:
+		t.mu.RLock()
+		f := t.onMessage
+		t.mu.RUnlock()
+		if f != nil {
+			f(e.Message)
+		}
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
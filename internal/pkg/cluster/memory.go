@@ -0,0 +1,89 @@
+package cluster
+
+import (
+	"sync"
+	"time"
+)
+
+// Network connects in-process transports with each other. It serves as the transport of a standalone
+// instance, and of multiple instances within tests.
+type Network struct {
+	mu    sync.RWMutex
+	nodes map[string]*memory
+}
+
+// NewNetwork creates an empty Network
+func NewNetwork() *Network {
+	return &Network{nodes: make(map[string]*memory)}
+}
+
+// Join creates the Transport of node within the network
+func (n *Network) Join(node string) Transport {
+	m := &memory{
+		network: n,
+		node:    node,
+		states:  make(map[string]State),
+	}
+	n.mu.Lock()
+	n.nodes[node] = m
+	n.mu.Unlock()
+	return m
+}
+
+// peers returns the transports within the network except the one of node
+func (n *Network) peers(node string) []*memory {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	peers := make([]*memory, 0, len(n.nodes))
+	for name, m := range n.nodes {
+		if name != node {
+			peers = append(peers, m)
+		}
+	}
+	return peers
+}
+
+type memory struct {
+	network *Network
+	node    string
+
+	mu        sync.RWMutex
+	states    map[string]State
+	onMessage func(payload []byte)
+}
+
+func (m *memory) Publish(st State) {
+	st.At = time.Now()
+	for _, peer := range m.network.peers(m.node) {
+		peer.mu.Lock()
+		peer.states[st.Node] = st
+		peer.mu.Unlock()
+	}
+}
+
+func (m *memory) Broadcast(payload []byte) {
+	for _, peer := range m.network.peers(m.node) {
+		peer.mu.RLock()
+		f := peer.onMessage
+		peer.mu.RUnlock()
+		if f != nil {
+			f(payload)
+		}
+	}
+}
+
+func (m *memory) Peers() []State {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	states := make([]State, 0, len(m.states))
+	for _, st := range m.states {
+		states = append(states, st)
+	}
+	return states
+}
+
+func (m *memory) OnMessage(f func(payload []byte)) {
+	m.mu.Lock()
+	m.onMessage = f
+	m.mu.Unlock()
+}
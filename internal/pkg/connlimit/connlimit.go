@@ -0,0 +1,196 @@
+// Package connlimit limits concurrent connections per client address and per UID, as well as the rate of
+// connection attempts per client address
+package connlimit
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	// janitorPeriod is the period idle rate limiters are removed in
+	janitorPeriod = time.Minute
+	// defaultRetryAfter is the time clients over a concurrent connections limit are asked to wait for without a
+	// connection rate limit
+	defaultRetryAfter = 10 * time.Second
+)
+
+var (
+	// ErrTooManyIPConnections is returned when the address group has reached its concurrent connections limit
+	ErrTooManyIPConnections = errors.New("too many connections from this address")
+	// ErrTooManyUIDConnections is returned when the uid has reached its concurrent connections limit
+	ErrTooManyUIDConnections = errors.New("too many connections for this uid")
+)
+
+// Config configures a Limiter. Zero values disable the corresponding limit.
+type Config struct {
+	// MaxPerIP is the maximum concurrent connections per address group
+	MaxPerIP int
+	// MaxPerUID is the maximum concurrent connections per uid
+	MaxPerUID int
+	// IPv6PrefixLen is the prefix length IPv6 addresses are grouped by, as a single host usually owns a whole prefix
+	IPv6PrefixLen int
+	// Rate is the connection attempts allowed per second per address group
+	Rate float64
+	// Burst is the connection attempts allowed to exceed Rate momentarily
+	Burst int
+}
+
+// Limiter enforces Config
+type Limiter struct {
+	config Config
+
+	mu    sync.Mutex
+	ips   map[string]int
+	uids  map[string]int
+	rates map[string]*rate.Limiter
+}
+
+// New creates a Limiter enforcing config
+func New(config Config) *Limiter {
+	return &Limiter{
+		config: normalize(config),
+		ips:    make(map[string]int),
+		uids:   make(map[string]int),
+		rates:  make(map[string]*rate.Limiter),
+	}
+}
+
+func normalize(config Config) Config {
+	if config.IPv6PrefixLen <= 0 || config.IPv6PrefixLen > 128 {
+		config.IPv6PrefixLen = 128
+	}
+	if config.Burst <= 0 {
+		config.Burst = 1
+	}
+	return config
+}
+
+// SetConfig replaces the limits enforced. Connections already accepted are kept even if they exceed the
+// new limits, and rate limits start over.
+func (l *Limiter) SetConfig(config Config) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.config = normalize(config)
+	l.rates = make(map[string]*rate.Limiter)
+}
+
+// Key returns the group ip belongs to: IPv4 addresses are grouped by themselves and
+// IPv6 addresses are grouped by their prefix
+func (l *Limiter) Key(ip string) string {
+	l.mu.Lock()
+	prefixLen := l.config.IPv6PrefixLen
+	l.mu.Unlock()
+	return key(ip, prefixLen)
+}
+
+func key(ip string, prefixLen int) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ip
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return v4.String()
+	}
+	mask := net.CIDRMask(prefixLen, 128)
+	return (&net.IPNet{IP: parsed.Mask(mask), Mask: mask}).String()
+}
+
+// Allow reports whether a connection attempt from ip is allowed by the rate limit.
+// If not, it also returns how long the client shall wait before retrying.
+func (l *Limiter) Allow(ip string) (bool, time.Duration) {
+	l.mu.Lock()
+	if l.config.Rate <= 0 {
+		l.mu.Unlock()
+		return true, 0
+	}
+	k := key(ip, l.config.IPv6PrefixLen)
+	limiter, ok := l.rates[k]
+	if !ok {
+		limiter = rate.NewLimiter(rate.Limit(l.config.Rate), l.config.Burst)
+		l.rates[k] = limiter
+	}
+	l.mu.Unlock()
+
+	r := limiter.Reserve()
+	if delay := r.Delay(); delay > 0 {
+		r.Cancel()
+		return false, delay
+	}
+	return true, 0
+}
+
+// RetryAfter returns the time clients over a concurrent connections limit are asked to wait for before trying
+// again, i.e. the time a connection attempt is refilled in, or defaultRetryAfter without a connection rate limit
+func (l *Limiter) RetryAfter() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.config.Rate <= 0 {
+		return defaultRetryAfter
+	}
+	return time.Duration(float64(time.Second) / l.config.Rate)
+}
+
+// Acquire takes a concurrent connection slot for ip and uid. An empty uid is not limited.
+// release shall be called exactly once after the connection is gone.
+func (l *Limiter) Acquire(ip, uid string) (release func(), err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	key := key(ip, l.config.IPv6PrefixLen)
+	if l.config.MaxPerIP > 0 && l.ips[key] >= l.config.MaxPerIP {
+		return nil, ErrTooManyIPConnections
+	}
+	if uid != "" && l.config.MaxPerUID > 0 && l.uids[uid] >= l.config.MaxPerUID {
+		return nil, ErrTooManyUIDConnections
+	}
+	l.ips[key]++
+	if uid != "" {
+		l.uids[uid]++
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			decrement(l.ips, key)
+			if uid != "" {
+				decrement(l.uids, uid)
+			}
+		})
+	}, nil
+}
+
+func decrement(m map[string]int, key string) {
+	if m[key] <= 1 {
+		delete(m, key)
+		return
+	}
+	m[key]--
+}
+
+// Run periodically removes rate limiters which are full, as they behave the same as new ones, until ctx is done
+func (l *Limiter) Run(ctx context.Context) {
+	ticker := time.NewTicker(janitorPeriod)
+	defer ticker.Stop()
+	for {
+		var now time.Time
+		select {
+		case now = <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		l.mu.Lock()
+		for key, limiter := range l.rates {
+			if limiter.TokensAt(now) >= float64(l.config.Burst) {
+				delete(l.rates, key)
+			}
+		}
+		l.mu.Unlock()
+	}
+}
@@ -0,0 +1,61 @@
+package connlimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	l := New(Config{MaxPerIP: 2, MaxPerUID: 1, IPv6PrefixLen: 64, Rate: 1, Burst: 2})
+
+	t.Run("should group IPv6 addresses by prefix", func(t *testing.T) {
+		if a, b := l.Key("2001:db8::1"), l.Key("2001:db8::ffff:1"); a != b {
+			t.Error("expect same group, got", a, b)
+		}
+		if a, b := l.Key("2001:db8:0:1::1"), l.Key("2001:db8::1"); a == b {
+			t.Error("expect different groups, got", a)
+		}
+		if k := l.Key("192.0.2.1"); k != "192.0.2.1" {
+			t.Error("expect IPv4 address as is, got", k)
+		}
+	})
+
+	t.Run("should limit concurrent connections", func(t *testing.T) {
+		release, err := l.Acquire("2001:db8::1", "uid-a")
+		if err != nil {
+			t.Fatal("unexpected error", err)
+		}
+		if _, err := l.Acquire("2001:db8::2", "uid-a"); err != ErrTooManyUIDConnections {
+			t.Error("expect ErrTooManyUIDConnections, got", err)
+		}
+		if _, err := l.Acquire("2001:db8::2", "uid-b"); err != nil {
+			t.Error("unexpected error", err)
+		}
+		if _, err := l.Acquire("2001:db8::3", ""); err != ErrTooManyIPConnections {
+			t.Error("expect ErrTooManyIPConnections, got", err)
+		}
+		release()
+		release()
+		if _, err := l.Acquire("2001:db8::3", "uid-a"); err != nil {
+			t.Error("unexpected error after release", err)
+		}
+
+		if retryAfter := l.RetryAfter(); retryAfter != time.Second {
+			t.Error("expect retry after the connection rate refill, got", retryAfter)
+		}
+		if retryAfter := New(Config{MaxPerIP: 1}).RetryAfter(); retryAfter != defaultRetryAfter {
+			t.Error("expect default retry after without a connection rate, got", retryAfter)
+		}
+	})
+
+	t.Run("should limit connection rate", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			if ok, _ := l.Allow("192.0.2.1"); !ok {
+				t.Fatal("expect burst to be allowed")
+			}
+		}
+		if ok, retryAfter := l.Allow("192.0.2.1"); ok || retryAfter <= 0 {
+			t.Error("expect rejection with retry after, got", ok, retryAfter)
+		}
+	})
+}
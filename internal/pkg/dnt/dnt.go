@@ -0,0 +1,23 @@
+// Package dnt reads the privacy signals of requests, i.e. Do-Not-Track and Global Privacy Control, and defines
+// the policies they may be honored with
+package dnt
+
+import "net/http"
+
+const (
+	// PolicyIgnore records visits signaling not to be tracked as any other
+	PolicyIgnore = "ignore"
+	// PolicyAnonymous records visits signaling not to be tracked without their UID, and the events reported
+	// within them without the session they were reported in
+	PolicyAnonymous = "anonymous"
+	// PolicyAggregate records nothing for visits signaling not to be tracked: they are counted in aggregate metrics only
+	PolicyAggregate = "aggregate"
+)
+
+// Policies are the policies signals may be honored with
+var Policies = []string{PolicyIgnore, PolicyAnonymous, PolicyAggregate}
+
+// Requested reports whether the request of h signals not to be tracked, with either `DNT: 1` or `Sec-GPC: 1`
+func Requested(h http.Header) bool {
+	return h.Get("DNT") == "1" || h.Get("Sec-GPC") == "1"
+}
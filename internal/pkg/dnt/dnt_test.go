@@ -0,0 +1,23 @@
+package dnt
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRequested(t *testing.T) {
+	for _, c := range []struct {
+		header   http.Header
+		expected bool
+	}{
+		{http.Header{}, false},
+		{http.Header{"Dnt": {"1"}}, true},
+		{http.Header{"Dnt": {"0"}}, false},
+		{http.Header{"Sec-Gpc": {"1"}}, true},
+		{http.Header{"Sec-Gpc": {"0"}, "Dnt": {"unset"}}, false},
+	} {
+		if actual := Requested(c.header); actual != c.expected {
+			t.Errorf("expect %v for %v, got %v", c.expected, c.header, actual)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+// Package geoip resolves client addresses to countries offline with a local MMDB database, e.g. GeoLite2-Country
+// or DB-IP Country Lite. Addresses are resolved in memory only and never kept.
+package geoip
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+
+	"github.com/penguin-statistics/probe/internal/pkg/logger"
+)
+
+const (
+	// Unknown is the country of addresses which are not resolved, e.g. private addresses, or when no database is loaded
+	Unknown = ""
+	// LabelUnknown is the metric label of Unknown
+	LabelUnknown = "unknown"
+	// LabelOther is the metric label of countries which are not labeled on their own
+	LabelOther = "other"
+)
+
+var log = logger.New("geoip")
+
+// record is the part of a country database record resolved
+type record struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	RegisteredCountry struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"registered_country"`
+}
+
+// Resolver resolves addresses to countries with the database of a file, which is reloaded when it changes
+type Resolver struct {
+	mu      sync.RWMutex
+	file    string
+	db      *maxminddb.Reader
+	modTime time.Time
+	size    int64
+}
+
+// New creates a Resolver with the database in file. Addresses are not resolved if file is empty.
+func New(file string) (*Resolver, error) {
+	r := &Resolver{}
+	if err := r.SetFile(file); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// open reads the database in file. The database is read into memory, so that it is not affected by the file
+// being overwritten.
+func open(file string) (*maxminddb.Reader, os.FileInfo, error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	db, err := maxminddb.FromBytes(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	return db, info, nil
+}
+
+// SetFile switches to the database in file, or stops resolving addresses if file is empty. The database
+// loaded is kept if the one in file is not able to be loaded.
+func (r *Resolver) SetFile(file string) error {
+	if file == "" {
+		r.mu.Lock()
+		r.file, r.db, r.modTime, r.size = "", nil, time.Time{}, 0
+		r.mu.Unlock()
+		return nil
+	}
+	db, info, err := open(file)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.file, r.db, r.modTime, r.size = file, db, info.ModTime(), info.Size()
+	r.mu.Unlock()
+	return nil
+}
+
+// Reload reloads the database if its file has been modified since it was loaded
+func (r *Resolver) Reload() error {
+	r.mu.RLock()
+	file, modTime, size := r.file, r.modTime, r.size
+	r.mu.RUnlock()
+	if file == "" {
+		return nil
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+	if info.ModTime().Equal(modTime) && info.Size() == size {
+		return nil
+	}
+	db, info, err := open(file)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// the file may have been switched meanwhile
+	if r.file == file {
+		r.db, r.modTime, r.size = db, info.ModTime(), info.Size()
+		log.Infoln("reloaded database", file)
+	}
+	return nil
+}
+
+// Run checks the database file for updates every interval, e.g. by geoipupdate, until ctx is done
+func (r *Resolver) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		if err := r.Reload(); err != nil {
+			log.Warnln("failed to reload database, keeping the one loaded", err)
+		}
+	}
+}
+
+// Country returns the ISO 3166-1 alpha-2 code of the country ip is located in, falling back to the country ip is
+// registered in, or Unknown
+func (r *Resolver) Country(ip net.IP) string {
+	r.mu.RLock()
+	db := r.db
+	r.mu.RUnlock()
+	if db == nil || ip == nil {
+		return Unknown
+	}
+	var rec record
+	if err := db.Lookup(ip, &rec); err != nil {
+		var invalid maxminddb.InvalidDatabaseError
+		if errors.As(err, &invalid) {
+			if l, ok := logger.Sample(log, "geoip: invalid database"); ok {
+				l.Warnln("failed to look up address", err)
+			}
+		}
+		return Unknown
+	}
+	if rec.Country.ISOCode != "" {
+		return rec.Country.ISOCode
+	}
+	return rec.RegisteredCountry.ISOCode
+}
+
+// Label returns the metric label of country, which is the country itself if labeled, so that labels are bounded
+func Label(country string, labeled []string) string {
+	if country == Unknown {
+		return LabelUnknown
+	}
+	for _, l := range labeled {
+		if l == country {
+			return country
+		}
+	}
+	return LabelOther
+}
@@ -0,0 +1,75 @@
+package geoip
+
+import (
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/penguin-statistics/probe/internal/pkg/geoip/geoiptest"
+)
+
+func TestResolver(t *testing.T) {
+	file := geoiptest.Write(t, map[string]string{
+		"1.0.0.0/24":  "CN",
+		"8.8.8.0/24":  "US",
+		"133.0.0.0/8": "JP",
+	})
+	r, err := New(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for ip, expected := range map[string]string{
+		"1.0.0.1":   "CN",
+		"8.8.8.8":   "US",
+		"133.1.2.3": "JP",
+		"10.0.0.1":  Unknown,
+		"::1":       Unknown,
+	} {
+		if actual := r.Country(net.ParseIP(ip)); actual != expected {
+			t.Errorf("expect %s located in %q, got %q", ip, expected, actual)
+		}
+	}
+
+	t.Run("should reload the database once modified", func(t *testing.T) {
+		geoiptest.Rewrite(t, file, map[string]string{"10.0.0.0/8": "KR"})
+		later := time.Now().Add(time.Minute)
+		if err := os.Chtimes(file, later, later); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.Reload(); err != nil {
+			t.Fatal(err)
+		}
+		if country := r.Country(net.ParseIP("10.0.0.1")); country != "KR" {
+			t.Error("expect database reloaded, got", country)
+		}
+	})
+
+	t.Run("should keep the database loaded if the file is invalid", func(t *testing.T) {
+		if err := r.SetFile(file + ".missing"); err == nil {
+			t.Error("expect error on missing file")
+		}
+		if country := r.Country(net.ParseIP("10.0.0.1")); country != "KR" {
+			t.Error("expect database kept, got", country)
+		}
+	})
+
+	t.Run("should resolve nothing without file", func(t *testing.T) {
+		if err := r.SetFile(""); err != nil {
+			t.Fatal(err)
+		}
+		if country := r.Country(net.ParseIP("10.0.0.1")); country != Unknown {
+			t.Error("expect nothing resolved, got", country)
+		}
+	})
+}
+
+func TestLabel(t *testing.T) {
+	labeled := []string{"CN", "US"}
+	for country, expected := range map[string]string{"CN": "CN", "FR": LabelOther, Unknown: LabelUnknown} {
+		if actual := Label(country, labeled); actual != expected {
+			t.Errorf("expect %q labeled %q, got %q", country, expected, actual)
+		}
+	}
+}
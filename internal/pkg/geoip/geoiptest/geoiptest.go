@@ -0,0 +1,160 @@
+// Package geoiptest writes country databases in the MMDB format for tests
+package geoiptest
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// recordSize is the bits of a record in the search tree
+const recordSize = 24
+
+type node struct {
+	children [2]*node
+	// country is set if the node is a leaf, i.e. a network
+	country string
+	index   int
+}
+
+// Encode encodes an IPv4 country database in which the networks in CIDR notation are located in the countries
+// given by their ISO codes
+func Encode(networks map[string]string) ([]byte, error) {
+	root := &node{}
+	for cidr, country := range networks {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		ip := network.IP.To4()
+		ones, _ := network.Mask.Size()
+		if ip == nil || ones == 0 {
+			return nil, fmt.Errorf("unsupported network %s", cidr)
+		}
+		n := root
+		for bit := 0; bit < ones; bit++ {
+			b := ip[bit/8] >> (7 - bit%8) & 1
+			if n.children[b] == nil {
+				n.children[b] = &node{}
+			}
+			n = n.children[b]
+		}
+		n.country = country
+	}
+
+	// number the nodes of the search tree breadth-first, leaves being records of the data section
+	var nodes []*node
+	for queue := []*node{root}; len(queue) > 0; queue = queue[1:] {
+		n := queue[0]
+		n.index = len(nodes)
+		nodes = append(nodes, n)
+		for _, child := range n.children {
+			if child != nil && child.country == "" {
+				queue = append(queue, child)
+			}
+		}
+	}
+
+	var data []byte
+	offsets := map[string]int{}
+	record := func(child *node) int {
+		switch {
+		case child == nil:
+			return len(nodes)
+		case child.country == "":
+			return child.index
+		}
+		offset, ok := offsets[child.country]
+		if !ok {
+			offset = len(data)
+			offsets[child.country] = offset
+			data = append(data, encodeMap(1)...)
+			data = append(data, encodeString("country")...)
+			data = append(data, encodeMap(1)...)
+			data = append(data, encodeString("iso_code")...)
+			data = append(data, encodeString(child.country)...)
+		}
+		return len(nodes) + 16 + offset
+	}
+
+	var b []byte
+	for _, n := range nodes {
+		for _, child := range n.children {
+			r := record(child)
+			b = append(b, byte(r>>16), byte(r>>8), byte(r))
+		}
+	}
+	b = append(b, make([]byte, 16)...)
+	b = append(b, data...)
+
+	b = append(b, "\xab\xcd\xefMaxMind.com"...)
+	b = append(b, encodeMap(9)...)
+	for _, field := range [][2][]byte{
+		{encodeString("node_count"), encodeUint(6, uint64(len(nodes)))},
+		{encodeString("record_size"), encodeUint(5, recordSize)},
+		{encodeString("ip_version"), encodeUint(5, 4)},
+		{encodeString("database_type"), encodeString("Test-Country")},
+		{encodeString("languages"), {0, 11 - 7}},
+		{encodeString("description"), encodeMap(0)},
+		{encodeString("binary_format_major_version"), encodeUint(5, 2)},
+		{encodeString("binary_format_minor_version"), encodeUint(5, 0)},
+		{encodeString("build_epoch"), encodeUint64(1700000000)},
+	} {
+		b = append(b, field[0]...)
+		b = append(b, field[1]...)
+	}
+	return b, nil
+}
+
+func encodeString(s string) []byte {
+	return append([]byte{2<<5 | byte(len(s))}, s...)
+}
+
+func encodeMap(size int) []byte {
+	return []byte{7<<5 | byte(size)}
+}
+
+// encodeUint encodes v as an unsigned integer of typ, which is 5 for uint16 and 6 for uint32
+func encodeUint(typ byte, v uint64) []byte {
+	b := encodeUintBytes(v)
+	return append([]byte{typ<<5 | byte(len(b))}, b...)
+}
+
+// encodeUint64 encodes v as an uint64, which is an extended type
+func encodeUint64(v uint64) []byte {
+	b := encodeUintBytes(v)
+	return append([]byte{byte(len(b)), 9 - 7}, b...)
+}
+
+// encodeUintBytes returns the big-endian bytes of v without leading zeros
+func encodeUintBytes(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	for len(b) > 0 && b[0] == 0 {
+		b = b[1:]
+	}
+	return b
+}
+
+// Write writes the country database of networks to a file in a temporary directory of t, and returns its path
+func Write(t testing.TB, networks map[string]string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "country.mmdb")
+	Rewrite(t, file, networks)
+	return file
+}
+
+// Rewrite replaces the country database in file with the one of networks
+func Rewrite(t testing.TB, file string, networks map[string]string) {
+	t.Helper()
+	b, err := Encode(networks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,17 +1,117 @@
 package logger
 
 import (
+	"sync"
+	"time"
+
 	"github.com/sirupsen/logrus"
-	"github.com/spf13/viper"
 )
 
-// New creates a new logrus logger
-func New(module string) *logrus.Entry {
+// Formats of log lines
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// module is a logger created for a module
+type module struct {
+	name   string
+	logger *logrus.Logger
+}
+
+var (
+	mu           sync.Mutex
+	modules      []module
+	level        = logrus.InfoLevel
+	moduleLevels = map[string]logrus.Level{}
+	reportCaller bool
+	formatter    logrus.Formatter = newFormatter(FormatText)
+)
+
+// New creates a new logrus logger for module
+func New(name string) *logrus.Entry {
 	l := logrus.New()
-	l.SetFormatter(&logrus.TextFormatter{TimestampFormat: "2006-01-02 15:04:05.000", FullTimestamp: true})
-	if viper.GetBool("app.debug") {
-		l.SetLevel(logrus.TraceLevel)
-		l.SetReportCaller(true)
+
+	mu.Lock()
+	l.SetFormatter(formatter)
+	l.SetLevel(levelOf(name))
+	l.SetReportCaller(reportCaller)
+	modules = append(modules, module{name: name, logger: l})
+	mu.Unlock()
+
+	return l.WithField("module", name)
+}
+
+func newFormatter(format string) logrus.Formatter {
+	if format == FormatJSON {
+		return &logrus.JSONFormatter{TimestampFormat: time.RFC3339Nano}
+	}
+	return &logrus.TextFormatter{TimestampFormat: "2006-01-02 15:04:05.000", FullTimestamp: true}
+}
+
+// levelOf returns the level of module. It shall be called with mu held.
+func levelOf(name string) logrus.Level {
+	if l, ok := moduleLevels[name]; ok {
+		return l
+	}
+	return level
+}
+
+// ParseLevel parses a level name, e.g. info. Unknown names are parsed as info along with an error.
+func ParseLevel(name string) (logrus.Level, error) {
+	l, err := logrus.ParseLevel(name)
+	if err != nil {
+		return logrus.InfoLevel, err
+	}
+	return l, nil
+}
+
+// ValidFormat reports whether format is a known format, i.e. text or json
+func ValidFormat(format string) bool {
+	return format == FormatText || format == FormatJSON
+}
+
+// SetLevel sets the level of all loggers, including the ones created later on, except for modules with
+// a level set by SetModuleLevels
+func SetLevel(l logrus.Level) {
+	mu.Lock()
+	defer mu.Unlock()
+	level = l
+	for _, m := range modules {
+		m.logger.SetLevel(levelOf(m.name))
+	}
+}
+
+// SetModuleLevels sets the levels of the loggers of modules in levels, replacing the ones set previously.
+// Loggers of other modules log at the level set by SetLevel.
+func SetModuleLevels(levels map[string]logrus.Level) {
+	mu.Lock()
+	defer mu.Unlock()
+	moduleLevels = make(map[string]logrus.Level, len(levels))
+	for name, l := range levels {
+		moduleLevels[name] = l
+	}
+	for _, m := range modules {
+		m.logger.SetLevel(levelOf(m.name))
+	}
+}
+
+// SetFormat sets the format of all loggers, including the ones created later on. Unknown formats fall back to text.
+func SetFormat(format string) {
+	mu.Lock()
+	defer mu.Unlock()
+	formatter = newFormatter(format)
+	for _, m := range modules {
+		m.logger.SetFormatter(formatter)
+	}
+}
+
+// SetReportCaller sets whether all loggers, including the ones created later on, report the caller
+func SetReportCaller(enabled bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	reportCaller = enabled
+	for _, m := range modules {
+		m.logger.SetReportCaller(enabled)
 	}
-	return l.WithField("module", module)
 }
@@ -0,0 +1,52 @@
+package logger
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestModuleLevels(t *testing.T) {
+	defer SetModuleLevels(nil)
+	defer SetLevel(logrus.InfoLevel)
+
+	a, b := New("a"), New("b")
+	SetModuleLevels(map[string]logrus.Level{"a": logrus.DebugLevel})
+	SetLevel(logrus.WarnLevel)
+	c := New("a")
+	if a.Logger.GetLevel() != logrus.DebugLevel || c.Logger.GetLevel() != logrus.DebugLevel {
+		t.Error("expect module level to override the default level")
+	}
+	if b.Logger.GetLevel() != logrus.WarnLevel {
+		t.Error("expect default level for other modules, got", b.Logger.GetLevel())
+	}
+
+	SetModuleLevels(nil)
+	if a.Logger.GetLevel() != logrus.WarnLevel {
+		t.Error("expect module level to be reset, got", a.Logger.GetLevel())
+	}
+}
+
+func TestSampler(t *testing.T) {
+	s := NewSampler(2, time.Second)
+	now := time.Now()
+	for i, expected := range []bool{true, true, false, false} {
+		if ok, _ := s.Allow("key", now); ok != expected {
+			t.Error("unexpected sampling of line", i)
+		}
+	}
+	if ok, _ := s.Allow("other", now); !ok {
+		t.Error("expect keys sampled separately")
+	}
+	if ok, dropped := s.Allow("key", now.Add(time.Second)); !ok || dropped != 2 {
+		t.Error("expect next interval allowed with dropped lines counted, got", ok, dropped)
+	}
+
+	s.SetConfig(0, time.Second)
+	for i := 0; i < 5; i++ {
+		if ok, _ := s.Allow("key", now.Add(time.Second)); !ok {
+			t.Fatal("expect sampling disabled")
+		}
+	}
+}
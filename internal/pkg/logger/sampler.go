@@ -0,0 +1,88 @@
+package logger
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// window is the lines of a key logged within the current interval
+type window struct {
+	start   time.Time
+	logged  int
+	dropped int
+}
+
+// Sampler limits repetitive lines: only the first Burst lines of a key are logged within every Interval
+type Sampler struct {
+	mu       sync.Mutex
+	burst    int
+	interval time.Duration
+	windows  map[string]*window
+}
+
+// NewSampler creates a Sampler which logs burst lines of a key per interval. A burst of zero disables sampling.
+func NewSampler(burst int, interval time.Duration) *Sampler {
+	return &Sampler{
+		burst:    burst,
+		interval: interval,
+		windows:  make(map[string]*window),
+	}
+}
+
+// SetConfig changes the burst and interval of s
+func (s *Sampler) SetConfig(burst int, interval time.Duration) {
+	s.mu.Lock()
+	s.burst = burst
+	s.interval = interval
+	s.mu.Unlock()
+}
+
+// Allow reports whether a line of key shall be logged at now, along with the amount of lines of key dropped
+// within the previous interval, if this is the first line of an interval
+func (s *Sampler) Allow(key string, now time.Time) (bool, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.burst <= 0 {
+		return true, 0
+	}
+	w, ok := s.windows[key]
+	if !ok {
+		w = &window{start: now}
+		s.windows[key] = w
+	}
+	dropped := 0
+	if now.Sub(w.start) >= s.interval {
+		dropped = w.dropped
+		*w = window{start: now}
+	}
+	if w.logged >= s.burst {
+		w.dropped++
+		return false, 0
+	}
+	w.logged++
+	return true, dropped
+}
+
+var sampler = NewSampler(0, time.Second)
+
+// SetSampling sets the sampling of lines logged with Sample. A burst of zero disables sampling.
+func SetSampling(burst int, interval time.Duration) {
+	sampler.SetConfig(burst, interval)
+}
+
+// Sample reports whether a high-volume line of key shall be logged with e, e.g.
+//
+//	if e, ok := logger.Sample(log, "unknown message type"); ok {
+//		e.Debugln("unknown message type", t)
+//	}
+//
+// Lines dropped within the previous interval are counted in the sampled field of the entry returned.
+func Sample(e *logrus.Entry, key string) (*logrus.Entry, bool) {
+	ok, dropped := sampler.Allow(key, time.Now())
+	if dropped > 0 {
+		e = e.WithField("sampled", dropped)
+	}
+	return e, ok
+}
@@ -140,7 +140,10 @@ const (
 	MessageType_NAVIGATED               MessageType = 1
 	MessageType_ENTERED_SEARCH_RESULT   MessageType = 2
 	MessageType_EXECUTED_ADVANCED_QUERY MessageType = 3
+	MessageType_BATCH                   MessageType = 4
 	MessageType_SERVER_ACK              MessageType = 64
+	MessageType_SERVER_SESSION          MessageType = 65
+	MessageType_SERVER_BROADCAST        MessageType = 66
 )
 
 // Enum value maps for MessageType.
@@ -150,14 +153,20 @@ var (
 		1:  "NAVIGATED",
 		2:  "ENTERED_SEARCH_RESULT",
 		3:  "EXECUTED_ADVANCED_QUERY",
+		4:  "BATCH",
 		64: "SERVER_ACK",
+		65: "SERVER_SESSION",
+		66: "SERVER_BROADCAST",
 	}
 	MessageType_value = map[string]int32{
 		"UNKNOWN":                 0,
 		"NAVIGATED":               1,
 		"ENTERED_SEARCH_RESULT":   2,
 		"EXECUTED_ADVANCED_QUERY": 3,
+		"BATCH":                   4,
 		"SERVER_ACK":              64,
+		"SERVER_SESSION":          65,
+		"SERVER_BROADCAST":        66,
 	}
 )
 
@@ -195,6 +204,9 @@ type Meta struct {
 
 	Type     MessageType `protobuf:"varint,1,opt,name=type,proto3,enum=PenguinProbe.MessageType" json:"type,omitempty"`
 	Language Language    `protobuf:"varint,2,opt,name=language,proto3,enum=PenguinProbe.Language" json:"language,omitempty"`
+	// seq is a client-assigned sequence number echoed back in ServerACK.
+	// Only honored for clients which negotiated the `seqack` capability.
+	Seq uint32 `protobuf:"varint,3,opt,name=seq,proto3" json:"seq,omitempty"`
 }
 
 func (x *Meta) Reset() {
@@ -243,6 +255,13 @@ func (x *Meta) GetLanguage() Language {
 	return Language_ZH_CN
 }
 
+func (x *Meta) GetSeq() uint32 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
 type Skeleton struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -504,6 +523,63 @@ func (x *Navigated) GetPath() string {
 	return ""
 }
 
+// Batch carries multiple encoded messages in a single frame.
+// Only honored for clients which negotiated the `batch` capability.
+type Batch struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Meta     *Meta    `protobuf:"bytes,1,opt,name=meta,proto3" json:"meta,omitempty"`
+	Messages [][]byte `protobuf:"bytes,2,rep,name=messages,proto3" json:"messages,omitempty"`
+}
+
+func (x *Batch) Reset() {
+	*x = Batch{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_shared_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Batch) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Batch) ProtoMessage() {}
+
+func (x *Batch) ProtoReflect() protoreflect.Message {
+	mi := &file_shared_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Batch.ProtoReflect.Descriptor instead.
+func (*Batch) Descriptor() ([]byte, []int) {
+	return file_shared_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Batch) GetMeta() *Meta {
+	if x != nil {
+		return x.Meta
+	}
+	return nil
+}
+
+func (x *Batch) GetMessages() [][]byte {
+	if x != nil {
+		return x.Messages
+	}
+	return nil
+}
+
 type ServerACK struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -511,12 +587,15 @@ type ServerACK struct {
 
 	Type    MessageType `protobuf:"varint,1,opt,name=type,proto3,enum=PenguinProbe.MessageType" json:"type,omitempty"`
 	Message string      `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	Seq     uint32      `protobuf:"varint,3,opt,name=seq,proto3" json:"seq,omitempty"`
+	// retryAfter is the milliseconds to wait before sending again, set when the message has been dropped by the rate limit
+	RetryAfter uint32 `protobuf:"varint,4,opt,name=retryAfter,proto3" json:"retryAfter,omitempty"`
 }
 
 func (x *ServerACK) Reset() {
 	*x = ServerACK{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_shared_proto_msgTypes[5]
+		mi := &file_shared_proto_msgTypes[6]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -529,7 +608,7 @@ func (x *ServerACK) String() string {
 func (*ServerACK) ProtoMessage() {}
 
 func (x *ServerACK) ProtoReflect() protoreflect.Message {
-	mi := &file_shared_proto_msgTypes[5]
+	mi := &file_shared_proto_msgTypes[6]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -542,7 +621,7 @@ func (x *ServerACK) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use ServerACK.ProtoReflect.Descriptor instead.
 func (*ServerACK) Descriptor() ([]byte, []int) {
-	return file_shared_proto_rawDescGZIP(), []int{5}
+	return file_shared_proto_rawDescGZIP(), []int{6}
 }
 
 func (x *ServerACK) GetType() MessageType {
@@ -559,6 +638,153 @@ func (x *ServerACK) GetMessage() string {
 	return ""
 }
 
+func (x *ServerACK) GetSeq() uint32 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *ServerACK) GetRetryAfter() uint32 {
+	if x != nil {
+		return x.RetryAfter
+	}
+	return 0
+}
+
+// ServerSession is sent right after the upgrade to clients which negotiated the `resume` capability, and again
+// with a fresh resume token every half of the resume window
+type ServerSession struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// type is always SERVER_SESSION
+	Type MessageType `protobuf:"varint,1,opt,name=type,proto3,enum=PenguinProbe.MessageType" json:"type,omitempty"`
+	// resumeToken shall be presented with the `t` query param when reconnecting
+	ResumeToken string `protobuf:"bytes,2,opt,name=resumeToken,proto3" json:"resumeToken,omitempty"`
+	Resumed     bool   `protobuf:"varint,3,opt,name=resumed,proto3" json:"resumed,omitempty"`
+	// lastSeq is the last sequence number received within the resumed session
+	LastSeq uint32 `protobuf:"varint,4,opt,name=lastSeq,proto3" json:"lastSeq,omitempty"`
+}
+
+func (x *ServerSession) Reset() {
+	*x = ServerSession{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_shared_proto_msgTypes[7]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ServerSession) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ServerSession) ProtoMessage() {}
+
+func (x *ServerSession) ProtoReflect() protoreflect.Message {
+	mi := &file_shared_proto_msgTypes[7]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ServerSession.ProtoReflect.Descriptor instead.
+func (*ServerSession) Descriptor() ([]byte, []int) {
+	return file_shared_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *ServerSession) GetType() MessageType {
+	if x != nil {
+		return x.Type
+	}
+	return MessageType_UNKNOWN
+}
+
+func (x *ServerSession) GetResumeToken() string {
+	if x != nil {
+		return x.ResumeToken
+	}
+	return ""
+}
+
+func (x *ServerSession) GetResumed() bool {
+	if x != nil {
+		return x.Resumed
+	}
+	return false
+}
+
+func (x *ServerSession) GetLastSeq() uint32 {
+	if x != nil {
+		return x.LastSeq
+	}
+	return 0
+}
+
+// ServerBroadcast is pushed to clients which negotiated the `broadcast` capability, e.g. to announce a maintenance
+type ServerBroadcast struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// type is always SERVER_BROADCAST
+	Type    MessageType `protobuf:"varint,1,opt,name=type,proto3,enum=PenguinProbe.MessageType" json:"type,omitempty"`
+	Message string      `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+}
+
+func (x *ServerBroadcast) Reset() {
+	*x = ServerBroadcast{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_shared_proto_msgTypes[8]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ServerBroadcast) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ServerBroadcast) ProtoMessage() {}
+
+func (x *ServerBroadcast) ProtoReflect() protoreflect.Message {
+	mi := &file_shared_proto_msgTypes[8]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ServerBroadcast.ProtoReflect.Descriptor instead.
+func (*ServerBroadcast) Descriptor() ([]byte, []int) {
+	return file_shared_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *ServerBroadcast) GetType() MessageType {
+	if x != nil {
+		return x.Type
+	}
+	return MessageType_UNKNOWN
+}
+
+func (x *ServerBroadcast) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
 type ExecutedAdvancedQuery_AdvancedQuery struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -576,7 +802,7 @@ type ExecutedAdvancedQuery_AdvancedQuery struct {
 func (x *ExecutedAdvancedQuery_AdvancedQuery) Reset() {
 	*x = ExecutedAdvancedQuery_AdvancedQuery{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_shared_proto_msgTypes[6]
+		mi := &file_shared_proto_msgTypes[9]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -589,7 +815,7 @@ func (x *ExecutedAdvancedQuery_AdvancedQuery) String() string {
 func (*ExecutedAdvancedQuery_AdvancedQuery) ProtoMessage() {}
 
 func (x *ExecutedAdvancedQuery_AdvancedQuery) ProtoReflect() protoreflect.Message {
-	mi := &file_shared_proto_msgTypes[6]
+	mi := &file_shared_proto_msgTypes[9]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -658,76 +884,103 @@ var File_shared_proto protoreflect.FileDescriptor
 
 var file_shared_proto_rawDesc = []byte{
 	0x0a, 0x0c, 0x73, 0x68, 0x61, 0x72, 0x65, 0x64, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x0c,
-	0x50, 0x65, 0x6e, 0x67, 0x75, 0x69, 0x6e, 0x50, 0x72, 0x6f, 0x62, 0x65, 0x22, 0x69, 0x0a, 0x04,
+	0x50, 0x65, 0x6e, 0x67, 0x75, 0x69, 0x6e, 0x50, 0x72, 0x6f, 0x62, 0x65, 0x22, 0x7b, 0x0a, 0x04,
 	0x4d, 0x65, 0x74, 0x61, 0x12, 0x2d, 0x0a, 0x04, 0x74, 0x79, 0x70, 0x65, 0x18, 0x01, 0x20, 0x01,
 	0x28, 0x0e, 0x32, 0x19, 0x2e, 0x50, 0x65, 0x6e, 0x67, 0x75, 0x69, 0x6e, 0x50, 0x72, 0x6f, 0x62,
 	0x65, 0x2e, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x54, 0x79, 0x70, 0x65, 0x52, 0x04, 0x74,
 	0x79, 0x70, 0x65, 0x12, 0x32, 0x0a, 0x08, 0x6c, 0x61, 0x6e, 0x67, 0x75, 0x61, 0x67, 0x65, 0x18,
 	0x02, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x16, 0x2e, 0x50, 0x65, 0x6e, 0x67, 0x75, 0x69, 0x6e, 0x50,
 	0x72, 0x6f, 0x62, 0x65, 0x2e, 0x4c, 0x61, 0x6e, 0x67, 0x75, 0x61, 0x67, 0x65, 0x52, 0x08, 0x6c,
-	0x61, 0x6e, 0x67, 0x75, 0x61, 0x67, 0x65, 0x22, 0x32, 0x0a, 0x08, 0x53, 0x6b, 0x65, 0x6c, 0x65,
-	0x74, 0x6f, 0x6e, 0x12, 0x26, 0x0a, 0x04, 0x6d, 0x65, 0x74, 0x61, 0x18, 0x01, 0x20, 0x01, 0x28,
-	0x0b, 0x32, 0x12, 0x2e, 0x50, 0x65, 0x6e, 0x67, 0x75, 0x69, 0x6e, 0x50, 0x72, 0x6f, 0x62, 0x65,
-	0x2e, 0x4d, 0x65, 0x74, 0x61, 0x52, 0x04, 0x6d, 0x65, 0x74, 0x61, 0x22, 0xab, 0x01, 0x0a, 0x13,
-	0x45, 0x6e, 0x74, 0x65, 0x72, 0x65, 0x64, 0x53, 0x65, 0x61, 0x72, 0x63, 0x68, 0x52, 0x65, 0x73,
-	0x75, 0x6c, 0x74, 0x12, 0x26, 0x0a, 0x04, 0x6d, 0x65, 0x74, 0x61, 0x18, 0x01, 0x20, 0x01, 0x28,
-	0x0b, 0x32, 0x12, 0x2e, 0x50, 0x65, 0x6e, 0x67, 0x75, 0x69, 0x6e, 0x50, 0x72, 0x6f, 0x62, 0x65,
-	0x2e, 0x4d, 0x65, 0x74, 0x61, 0x52, 0x04, 0x6d, 0x65, 0x74, 0x61, 0x12, 0x1a, 0x0a, 0x07, 0x73,
-	0x74, 0x61, 0x67, 0x65, 0x49, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x48, 0x00, 0x52, 0x07,
-	0x73, 0x74, 0x61, 0x67, 0x65, 0x49, 0x64, 0x12, 0x18, 0x0a, 0x06, 0x69, 0x74, 0x65, 0x6d, 0x49,
-	0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x48, 0x00, 0x52, 0x06, 0x69, 0x74, 0x65, 0x6d, 0x49,
-	0x64, 0x12, 0x14, 0x0a, 0x05, 0x71, 0x75, 0x65, 0x72, 0x79, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09,
-	0x52, 0x05, 0x71, 0x75, 0x65, 0x72, 0x79, 0x12, 0x1a, 0x0a, 0x08, 0x70, 0x6f, 0x73, 0x69, 0x74,
-	0x69, 0x6f, 0x6e, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x08, 0x70, 0x6f, 0x73, 0x69, 0x74,
-	0x69, 0x6f, 0x6e, 0x42, 0x04, 0x0a, 0x02, 0x69, 0x64, 0x22, 0xe4, 0x02, 0x0a, 0x15, 0x45, 0x78,
+	0x61, 0x6e, 0x67, 0x75, 0x61, 0x67, 0x65, 0x12, 0x10, 0x0a, 0x03, 0x73, 0x65, 0x71, 0x18, 0x03,
+	0x20, 0x01, 0x28, 0x0d, 0x52, 0x03, 0x73, 0x65, 0x71, 0x22, 0x32, 0x0a, 0x08, 0x53, 0x6b, 0x65,
+	0x6c, 0x65, 0x74, 0x6f, 0x6e, 0x12, 0x26, 0x0a, 0x04, 0x6d, 0x65, 0x74, 0x61, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x0b, 0x32, 0x12, 0x2e, 0x50, 0x65, 0x6e, 0x67, 0x75, 0x69, 0x6e, 0x50, 0x72, 0x6f,
+	0x62, 0x65, 0x2e, 0x4d, 0x65, 0x74, 0x61, 0x52, 0x04, 0x6d, 0x65, 0x74, 0x61, 0x22, 0xab, 0x01,
+	0x0a, 0x13, 0x45, 0x6e, 0x74, 0x65, 0x72, 0x65, 0x64, 0x53, 0x65, 0x61, 0x72, 0x63, 0x68, 0x52,
+	0x65, 0x73, 0x75, 0x6c, 0x74, 0x12, 0x26, 0x0a, 0x04, 0x6d, 0x65, 0x74, 0x61, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x0b, 0x32, 0x12, 0x2e, 0x50, 0x65, 0x6e, 0x67, 0x75, 0x69, 0x6e, 0x50, 0x72, 0x6f,
+	0x62, 0x65, 0x2e, 0x4d, 0x65, 0x74, 0x61, 0x52, 0x04, 0x6d, 0x65, 0x74, 0x61, 0x12, 0x1a, 0x0a,
+	0x07, 0x73, 0x74, 0x61, 0x67, 0x65, 0x49, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x48, 0x00,
+	0x52, 0x07, 0x73, 0x74, 0x61, 0x67, 0x65, 0x49, 0x64, 0x12, 0x18, 0x0a, 0x06, 0x69, 0x74, 0x65,
+	0x6d, 0x49, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x48, 0x00, 0x52, 0x06, 0x69, 0x74, 0x65,
+	0x6d, 0x49, 0x64, 0x12, 0x14, 0x0a, 0x05, 0x71, 0x75, 0x65, 0x72, 0x79, 0x18, 0x04, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x05, 0x71, 0x75, 0x65, 0x72, 0x79, 0x12, 0x1a, 0x0a, 0x08, 0x70, 0x6f, 0x73,
+	0x69, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x08, 0x70, 0x6f, 0x73,
+	0x69, 0x74, 0x69, 0x6f, 0x6e, 0x42, 0x04, 0x0a, 0x02, 0x69, 0x64, 0x22, 0xe4, 0x02, 0x0a, 0x15,
+	0x45, 0x78, 0x65, 0x63, 0x75, 0x74, 0x65, 0x64, 0x41, 0x64, 0x76, 0x61, 0x6e, 0x63, 0x65, 0x64,
+	0x51, 0x75, 0x65, 0x72, 0x79, 0x12, 0x26, 0x0a, 0x04, 0x6d, 0x65, 0x74, 0x61, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x0b, 0x32, 0x12, 0x2e, 0x50, 0x65, 0x6e, 0x67, 0x75, 0x69, 0x6e, 0x50, 0x72, 0x6f,
+	0x62, 0x65, 0x2e, 0x4d, 0x65, 0x74, 0x61, 0x52, 0x04, 0x6d, 0x65, 0x74, 0x61, 0x12, 0x4b, 0x0a,
+	0x07, 0x71, 0x75, 0x65, 0x72, 0x69, 0x65, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x31,
+	0x2e, 0x50, 0x65, 0x6e, 0x67, 0x75, 0x69, 0x6e, 0x50, 0x72, 0x6f, 0x62, 0x65, 0x2e, 0x45, 0x78,
 	0x65, 0x63, 0x75, 0x74, 0x65, 0x64, 0x41, 0x64, 0x76, 0x61, 0x6e, 0x63, 0x65, 0x64, 0x51, 0x75,
-	0x65, 0x72, 0x79, 0x12, 0x26, 0x0a, 0x04, 0x6d, 0x65, 0x74, 0x61, 0x18, 0x01, 0x20, 0x01, 0x28,
-	0x0b, 0x32, 0x12, 0x2e, 0x50, 0x65, 0x6e, 0x67, 0x75, 0x69, 0x6e, 0x50, 0x72, 0x6f, 0x62, 0x65,
-	0x2e, 0x4d, 0x65, 0x74, 0x61, 0x52, 0x04, 0x6d, 0x65, 0x74, 0x61, 0x12, 0x4b, 0x0a, 0x07, 0x71,
-	0x75, 0x65, 0x72, 0x69, 0x65, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x31, 0x2e, 0x50,
-	0x65, 0x6e, 0x67, 0x75, 0x69, 0x6e, 0x50, 0x72, 0x6f, 0x62, 0x65, 0x2e, 0x45, 0x78, 0x65, 0x63,
-	0x75, 0x74, 0x65, 0x64, 0x41, 0x64, 0x76, 0x61, 0x6e, 0x63, 0x65, 0x64, 0x51, 0x75, 0x65, 0x72,
-	0x79, 0x2e, 0x41, 0x64, 0x76, 0x61, 0x6e, 0x63, 0x65, 0x64, 0x51, 0x75, 0x65, 0x72, 0x79, 0x52,
-	0x07, 0x71, 0x75, 0x65, 0x72, 0x69, 0x65, 0x73, 0x1a, 0xd5, 0x01, 0x0a, 0x0d, 0x41, 0x64, 0x76,
-	0x61, 0x6e, 0x63, 0x65, 0x64, 0x51, 0x75, 0x65, 0x72, 0x79, 0x12, 0x18, 0x0a, 0x07, 0x73, 0x74,
-	0x61, 0x67, 0x65, 0x49, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x73, 0x74, 0x61,
-	0x67, 0x65, 0x49, 0x64, 0x12, 0x18, 0x0a, 0x07, 0x69, 0x74, 0x65, 0x6d, 0x49, 0x64, 0x73, 0x18,
-	0x02, 0x20, 0x03, 0x28, 0x09, 0x52, 0x07, 0x69, 0x74, 0x65, 0x6d, 0x49, 0x64, 0x73, 0x12, 0x2c,
-	0x0a, 0x06, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x14,
-	0x2e, 0x50, 0x65, 0x6e, 0x67, 0x75, 0x69, 0x6e, 0x50, 0x72, 0x6f, 0x62, 0x65, 0x2e, 0x53, 0x65,
-	0x72, 0x76, 0x65, 0x72, 0x52, 0x06, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72, 0x12, 0x1e, 0x0a, 0x0a,
-	0x69, 0x73, 0x50, 0x65, 0x72, 0x73, 0x6f, 0x6e, 0x61, 0x6c, 0x18, 0x04, 0x20, 0x01, 0x28, 0x08,
-	0x52, 0x0a, 0x69, 0x73, 0x50, 0x65, 0x72, 0x73, 0x6f, 0x6e, 0x61, 0x6c, 0x12, 0x14, 0x0a, 0x05,
-	0x73, 0x74, 0x61, 0x72, 0x74, 0x18, 0x05, 0x20, 0x01, 0x28, 0x04, 0x52, 0x05, 0x73, 0x74, 0x61,
-	0x72, 0x74, 0x12, 0x10, 0x0a, 0x03, 0x65, 0x6e, 0x64, 0x18, 0x06, 0x20, 0x01, 0x28, 0x04, 0x52,
-	0x03, 0x65, 0x6e, 0x64, 0x12, 0x1a, 0x0a, 0x08, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x76, 0x61, 0x6c,
-	0x18, 0x07, 0x20, 0x01, 0x28, 0x04, 0x52, 0x08, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x76, 0x61, 0x6c,
-	0x22, 0x47, 0x0a, 0x09, 0x4e, 0x61, 0x76, 0x69, 0x67, 0x61, 0x74, 0x65, 0x64, 0x12, 0x26, 0x0a,
-	0x04, 0x6d, 0x65, 0x74, 0x61, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x12, 0x2e, 0x50, 0x65,
-	0x6e, 0x67, 0x75, 0x69, 0x6e, 0x50, 0x72, 0x6f, 0x62, 0x65, 0x2e, 0x4d, 0x65, 0x74, 0x61, 0x52,
-	0x04, 0x6d, 0x65, 0x74, 0x61, 0x12, 0x12, 0x0a, 0x04, 0x70, 0x61, 0x74, 0x68, 0x18, 0x02, 0x20,
-	0x01, 0x28, 0x09, 0x52, 0x04, 0x70, 0x61, 0x74, 0x68, 0x22, 0x54, 0x0a, 0x09, 0x53, 0x65, 0x72,
+	0x65, 0x72, 0x79, 0x2e, 0x41, 0x64, 0x76, 0x61, 0x6e, 0x63, 0x65, 0x64, 0x51, 0x75, 0x65, 0x72,
+	0x79, 0x52, 0x07, 0x71, 0x75, 0x65, 0x72, 0x69, 0x65, 0x73, 0x1a, 0xd5, 0x01, 0x0a, 0x0d, 0x41,
+	0x64, 0x76, 0x61, 0x6e, 0x63, 0x65, 0x64, 0x51, 0x75, 0x65, 0x72, 0x79, 0x12, 0x18, 0x0a, 0x07,
+	0x73, 0x74, 0x61, 0x67, 0x65, 0x49, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x73,
+	0x74, 0x61, 0x67, 0x65, 0x49, 0x64, 0x12, 0x18, 0x0a, 0x07, 0x69, 0x74, 0x65, 0x6d, 0x49, 0x64,
+	0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x09, 0x52, 0x07, 0x69, 0x74, 0x65, 0x6d, 0x49, 0x64, 0x73,
+	0x12, 0x2c, 0x0a, 0x06, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0e,
+	0x32, 0x14, 0x2e, 0x50, 0x65, 0x6e, 0x67, 0x75, 0x69, 0x6e, 0x50, 0x72, 0x6f, 0x62, 0x65, 0x2e,
+	0x53, 0x65, 0x72, 0x76, 0x65, 0x72, 0x52, 0x06, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72, 0x12, 0x1e,
+	0x0a, 0x0a, 0x69, 0x73, 0x50, 0x65, 0x72, 0x73, 0x6f, 0x6e, 0x61, 0x6c, 0x18, 0x04, 0x20, 0x01,
+	0x28, 0x08, 0x52, 0x0a, 0x69, 0x73, 0x50, 0x65, 0x72, 0x73, 0x6f, 0x6e, 0x61, 0x6c, 0x12, 0x14,
+	0x0a, 0x05, 0x73, 0x74, 0x61, 0x72, 0x74, 0x18, 0x05, 0x20, 0x01, 0x28, 0x04, 0x52, 0x05, 0x73,
+	0x74, 0x61, 0x72, 0x74, 0x12, 0x10, 0x0a, 0x03, 0x65, 0x6e, 0x64, 0x18, 0x06, 0x20, 0x01, 0x28,
+	0x04, 0x52, 0x03, 0x65, 0x6e, 0x64, 0x12, 0x1a, 0x0a, 0x08, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x76,
+	0x61, 0x6c, 0x18, 0x07, 0x20, 0x01, 0x28, 0x04, 0x52, 0x08, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x76,
+	0x61, 0x6c, 0x22, 0x47, 0x0a, 0x09, 0x4e, 0x61, 0x76, 0x69, 0x67, 0x61, 0x74, 0x65, 0x64, 0x12,
+	0x26, 0x0a, 0x04, 0x6d, 0x65, 0x74, 0x61, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x12, 0x2e,
+	0x50, 0x65, 0x6e, 0x67, 0x75, 0x69, 0x6e, 0x50, 0x72, 0x6f, 0x62, 0x65, 0x2e, 0x4d, 0x65, 0x74,
+	0x61, 0x52, 0x04, 0x6d, 0x65, 0x74, 0x61, 0x12, 0x12, 0x0a, 0x04, 0x70, 0x61, 0x74, 0x68, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x70, 0x61, 0x74, 0x68, 0x22, 0x4b, 0x0a, 0x05, 0x42,
+	0x61, 0x74, 0x63, 0x68, 0x12, 0x26, 0x0a, 0x04, 0x6d, 0x65, 0x74, 0x61, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x0b, 0x32, 0x12, 0x2e, 0x50, 0x65, 0x6e, 0x67, 0x75, 0x69, 0x6e, 0x50, 0x72, 0x6f, 0x62,
+	0x65, 0x2e, 0x4d, 0x65, 0x74, 0x61, 0x52, 0x04, 0x6d, 0x65, 0x74, 0x61, 0x12, 0x1a, 0x0a, 0x08,
+	0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x0c, 0x52, 0x08,
+	0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x73, 0x22, 0x86, 0x01, 0x0a, 0x09, 0x53, 0x65, 0x72,
 	0x76, 0x65, 0x72, 0x41, 0x43, 0x4b, 0x12, 0x2d, 0x0a, 0x04, 0x74, 0x79, 0x70, 0x65, 0x18, 0x01,
 	0x20, 0x01, 0x28, 0x0e, 0x32, 0x19, 0x2e, 0x50, 0x65, 0x6e, 0x67, 0x75, 0x69, 0x6e, 0x50, 0x72,
 	0x6f, 0x62, 0x65, 0x2e, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x54, 0x79, 0x70, 0x65, 0x52,
 	0x04, 0x74, 0x79, 0x70, 0x65, 0x12, 0x18, 0x0a, 0x07, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65,
-	0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x2a,
-	0x41, 0x0a, 0x08, 0x4c, 0x61, 0x6e, 0x67, 0x75, 0x61, 0x67, 0x65, 0x12, 0x09, 0x0a, 0x05, 0x5a,
-	0x48, 0x5f, 0x43, 0x4e, 0x10, 0x00, 0x12, 0x09, 0x0a, 0x05, 0x45, 0x4e, 0x5f, 0x55, 0x53, 0x10,
-	0x01, 0x12, 0x09, 0x0a, 0x05, 0x4a, 0x41, 0x5f, 0x4a, 0x50, 0x10, 0x02, 0x12, 0x09, 0x0a, 0x05,
-	0x4b, 0x4f, 0x5f, 0x4b, 0x52, 0x10, 0x03, 0x12, 0x09, 0x0a, 0x05, 0x4f, 0x54, 0x48, 0x45, 0x52,
-	0x10, 0x04, 0x2a, 0x28, 0x0a, 0x06, 0x53, 0x65, 0x72, 0x76, 0x65, 0x72, 0x12, 0x06, 0x0a, 0x02,
-	0x43, 0x4e, 0x10, 0x00, 0x12, 0x06, 0x0a, 0x02, 0x55, 0x53, 0x10, 0x01, 0x12, 0x06, 0x0a, 0x02,
-	0x4a, 0x50, 0x10, 0x02, 0x12, 0x06, 0x0a, 0x02, 0x4b, 0x52, 0x10, 0x03, 0x2a, 0x71, 0x0a, 0x0b,
-	0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x54, 0x79, 0x70, 0x65, 0x12, 0x0b, 0x0a, 0x07, 0x55,
-	0x4e, 0x4b, 0x4e, 0x4f, 0x57, 0x4e, 0x10, 0x00, 0x12, 0x0d, 0x0a, 0x09, 0x4e, 0x41, 0x56, 0x49,
-	0x47, 0x41, 0x54, 0x45, 0x44, 0x10, 0x01, 0x12, 0x19, 0x0a, 0x15, 0x45, 0x4e, 0x54, 0x45, 0x52,
-	0x45, 0x44, 0x5f, 0x53, 0x45, 0x41, 0x52, 0x43, 0x48, 0x5f, 0x52, 0x45, 0x53, 0x55, 0x4c, 0x54,
-	0x10, 0x02, 0x12, 0x1b, 0x0a, 0x17, 0x45, 0x58, 0x45, 0x43, 0x55, 0x54, 0x45, 0x44, 0x5f, 0x41,
-	0x44, 0x56, 0x41, 0x4e, 0x43, 0x45, 0x44, 0x5f, 0x51, 0x55, 0x45, 0x52, 0x59, 0x10, 0x03, 0x12,
-	0x0e, 0x0a, 0x0a, 0x53, 0x45, 0x52, 0x56, 0x45, 0x52, 0x5f, 0x41, 0x43, 0x4b, 0x10, 0x40, 0x42,
-	0x0c, 0x5a, 0x0a, 0x2e, 0x3b, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x73, 0x62, 0x06, 0x70,
-	0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x12,
+	0x10, 0x0a, 0x03, 0x73, 0x65, 0x71, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x03, 0x73, 0x65,
+	0x71, 0x12, 0x1e, 0x0a, 0x0a, 0x72, 0x65, 0x74, 0x72, 0x79, 0x41, 0x66, 0x74, 0x65, 0x72, 0x18,
+	0x04, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0a, 0x72, 0x65, 0x74, 0x72, 0x79, 0x41, 0x66, 0x74, 0x65,
+	0x72, 0x22, 0x94, 0x01, 0x0a, 0x0d, 0x53, 0x65, 0x72, 0x76, 0x65, 0x72, 0x53, 0x65, 0x73, 0x73,
+	0x69, 0x6f, 0x6e, 0x12, 0x2d, 0x0a, 0x04, 0x74, 0x79, 0x70, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x0e, 0x32, 0x19, 0x2e, 0x50, 0x65, 0x6e, 0x67, 0x75, 0x69, 0x6e, 0x50, 0x72, 0x6f, 0x62, 0x65,
+	0x2e, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x54, 0x79, 0x70, 0x65, 0x52, 0x04, 0x74, 0x79,
+	0x70, 0x65, 0x12, 0x20, 0x0a, 0x0b, 0x72, 0x65, 0x73, 0x75, 0x6d, 0x65, 0x54, 0x6f, 0x6b, 0x65,
+	0x6e, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x72, 0x65, 0x73, 0x75, 0x6d, 0x65, 0x54,
+	0x6f, 0x6b, 0x65, 0x6e, 0x12, 0x18, 0x0a, 0x07, 0x72, 0x65, 0x73, 0x75, 0x6d, 0x65, 0x64, 0x18,
+	0x03, 0x20, 0x01, 0x28, 0x08, 0x52, 0x07, 0x72, 0x65, 0x73, 0x75, 0x6d, 0x65, 0x64, 0x12, 0x18,
+	0x0a, 0x07, 0x6c, 0x61, 0x73, 0x74, 0x53, 0x65, 0x71, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0d, 0x52,
+	0x07, 0x6c, 0x61, 0x73, 0x74, 0x53, 0x65, 0x71, 0x22, 0x5a, 0x0a, 0x0f, 0x53, 0x65, 0x72, 0x76,
+	0x65, 0x72, 0x42, 0x72, 0x6f, 0x61, 0x64, 0x63, 0x61, 0x73, 0x74, 0x12, 0x2d, 0x0a, 0x04, 0x74,
+	0x79, 0x70, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x19, 0x2e, 0x50, 0x65, 0x6e, 0x67,
+	0x75, 0x69, 0x6e, 0x50, 0x72, 0x6f, 0x62, 0x65, 0x2e, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65,
+	0x54, 0x79, 0x70, 0x65, 0x52, 0x04, 0x74, 0x79, 0x70, 0x65, 0x12, 0x18, 0x0a, 0x07, 0x6d, 0x65,
+	0x73, 0x73, 0x61, 0x67, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x6d, 0x65, 0x73,
+	0x73, 0x61, 0x67, 0x65, 0x2a, 0x41, 0x0a, 0x08, 0x4c, 0x61, 0x6e, 0x67, 0x75, 0x61, 0x67, 0x65,
+	0x12, 0x09, 0x0a, 0x05, 0x5a, 0x48, 0x5f, 0x43, 0x4e, 0x10, 0x00, 0x12, 0x09, 0x0a, 0x05, 0x45,
+	0x4e, 0x5f, 0x55, 0x53, 0x10, 0x01, 0x12, 0x09, 0x0a, 0x05, 0x4a, 0x41, 0x5f, 0x4a, 0x50, 0x10,
+	0x02, 0x12, 0x09, 0x0a, 0x05, 0x4b, 0x4f, 0x5f, 0x4b, 0x52, 0x10, 0x03, 0x12, 0x09, 0x0a, 0x05,
+	0x4f, 0x54, 0x48, 0x45, 0x52, 0x10, 0x04, 0x2a, 0x28, 0x0a, 0x06, 0x53, 0x65, 0x72, 0x76, 0x65,
+	0x72, 0x12, 0x06, 0x0a, 0x02, 0x43, 0x4e, 0x10, 0x00, 0x12, 0x06, 0x0a, 0x02, 0x55, 0x53, 0x10,
+	0x01, 0x12, 0x06, 0x0a, 0x02, 0x4a, 0x50, 0x10, 0x02, 0x12, 0x06, 0x0a, 0x02, 0x4b, 0x52, 0x10,
+	0x03, 0x2a, 0xa6, 0x01, 0x0a, 0x0b, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x54, 0x79, 0x70,
+	0x65, 0x12, 0x0b, 0x0a, 0x07, 0x55, 0x4e, 0x4b, 0x4e, 0x4f, 0x57, 0x4e, 0x10, 0x00, 0x12, 0x0d,
+	0x0a, 0x09, 0x4e, 0x41, 0x56, 0x49, 0x47, 0x41, 0x54, 0x45, 0x44, 0x10, 0x01, 0x12, 0x19, 0x0a,
+	0x15, 0x45, 0x4e, 0x54, 0x45, 0x52, 0x45, 0x44, 0x5f, 0x53, 0x45, 0x41, 0x52, 0x43, 0x48, 0x5f,
+	0x52, 0x45, 0x53, 0x55, 0x4c, 0x54, 0x10, 0x02, 0x12, 0x1b, 0x0a, 0x17, 0x45, 0x58, 0x45, 0x43,
+	0x55, 0x54, 0x45, 0x44, 0x5f, 0x41, 0x44, 0x56, 0x41, 0x4e, 0x43, 0x45, 0x44, 0x5f, 0x51, 0x55,
+	0x45, 0x52, 0x59, 0x10, 0x03, 0x12, 0x09, 0x0a, 0x05, 0x42, 0x41, 0x54, 0x43, 0x48, 0x10, 0x04,
+	0x12, 0x0e, 0x0a, 0x0a, 0x53, 0x45, 0x52, 0x56, 0x45, 0x52, 0x5f, 0x41, 0x43, 0x4b, 0x10, 0x40,
+	0x12, 0x12, 0x0a, 0x0e, 0x53, 0x45, 0x52, 0x56, 0x45, 0x52, 0x5f, 0x53, 0x45, 0x53, 0x53, 0x49,
+	0x4f, 0x4e, 0x10, 0x41, 0x12, 0x14, 0x0a, 0x10, 0x53, 0x45, 0x52, 0x56, 0x45, 0x52, 0x5f, 0x42,
+	0x52, 0x4f, 0x41, 0x44, 0x43, 0x41, 0x53, 0x54, 0x10, 0x42, 0x42, 0x0c, 0x5a, 0x0a, 0x2e, 0x3b,
+	0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x73, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -744,7 +997,7 @@ func file_shared_proto_rawDescGZIP() []byte {
 
 var (
 	file_shared_proto_enumTypes = make([]protoimpl.EnumInfo, 3)
-	file_shared_proto_msgTypes  = make([]protoimpl.MessageInfo, 7)
+	file_shared_proto_msgTypes  = make([]protoimpl.MessageInfo, 10)
 	file_shared_proto_goTypes   = []interface{}{
 		(Language)(0),                 // 0: PenguinProbe.Language
 		(Server)(0),                   // 1: PenguinProbe.Server
@@ -754,26 +1007,31 @@ var (
 		(*EnteredSearchResult)(nil),   // 5: PenguinProbe.EnteredSearchResult
 		(*ExecutedAdvancedQuery)(nil), // 6: PenguinProbe.ExecutedAdvancedQuery
 		(*Navigated)(nil),             // 7: PenguinProbe.Navigated
-		(*ServerACK)(nil),             // 8: PenguinProbe.ServerACK
-		(*ExecutedAdvancedQuery_AdvancedQuery)(nil), // 9: PenguinProbe.ExecutedAdvancedQuery.AdvancedQuery
+		(*Batch)(nil),                 // 8: PenguinProbe.Batch
+		(*ServerACK)(nil),             // 9: PenguinProbe.ServerACK
+		(*ServerSession)(nil),         // 10: PenguinProbe.ServerSession
+		(*ServerBroadcast)(nil),       // 11: PenguinProbe.ServerBroadcast
+		(*ExecutedAdvancedQuery_AdvancedQuery)(nil), // 12: PenguinProbe.ExecutedAdvancedQuery.AdvancedQuery
 	}
 )
-
 var file_shared_proto_depIdxs = []int32{
-	2, // 0: PenguinProbe.Meta.type:type_name -> PenguinProbe.MessageType
-	0, // 1: PenguinProbe.Meta.language:type_name -> PenguinProbe.Language
-	3, // 2: PenguinProbe.Skeleton.meta:type_name -> PenguinProbe.Meta
-	3, // 3: PenguinProbe.EnteredSearchResult.meta:type_name -> PenguinProbe.Meta
-	3, // 4: PenguinProbe.ExecutedAdvancedQuery.meta:type_name -> PenguinProbe.Meta
-	9, // 5: PenguinProbe.ExecutedAdvancedQuery.queries:type_name -> PenguinProbe.ExecutedAdvancedQuery.AdvancedQuery
-	3, // 6: PenguinProbe.Navigated.meta:type_name -> PenguinProbe.Meta
-	2, // 7: PenguinProbe.ServerACK.type:type_name -> PenguinProbe.MessageType
-	1, // 8: PenguinProbe.ExecutedAdvancedQuery.AdvancedQuery.server:type_name -> PenguinProbe.Server
-	9, // [9:9] is the sub-list for method output_type
-	9, // [9:9] is the sub-list for method input_type
-	9, // [9:9] is the sub-list for extension type_name
-	9, // [9:9] is the sub-list for extension extendee
-	0, // [0:9] is the sub-list for field type_name
+	2,  // 0: PenguinProbe.Meta.type:type_name -> PenguinProbe.MessageType
+	0,  // 1: PenguinProbe.Meta.language:type_name -> PenguinProbe.Language
+	3,  // 2: PenguinProbe.Skeleton.meta:type_name -> PenguinProbe.Meta
+	3,  // 3: PenguinProbe.EnteredSearchResult.meta:type_name -> PenguinProbe.Meta
+	3,  // 4: PenguinProbe.ExecutedAdvancedQuery.meta:type_name -> PenguinProbe.Meta
+	12, // 5: PenguinProbe.ExecutedAdvancedQuery.queries:type_name -> PenguinProbe.ExecutedAdvancedQuery.AdvancedQuery
+	3,  // 6: PenguinProbe.Navigated.meta:type_name -> PenguinProbe.Meta
+	3,  // 7: PenguinProbe.Batch.meta:type_name -> PenguinProbe.Meta
+	2,  // 8: PenguinProbe.ServerACK.type:type_name -> PenguinProbe.MessageType
+	2,  // 9: PenguinProbe.ServerSession.type:type_name -> PenguinProbe.MessageType
+	2,  // 10: PenguinProbe.ServerBroadcast.type:type_name -> PenguinProbe.MessageType
+	1,  // 11: PenguinProbe.ExecutedAdvancedQuery.AdvancedQuery.server:type_name -> PenguinProbe.Server
+	12, // [12:12] is the sub-list for method output_type
+	12, // [12:12] is the sub-list for method input_type
+	12, // [12:12] is the sub-list for extension type_name
+	12, // [12:12] is the sub-list for extension extendee
+	0,  // [0:12] is the sub-list for field type_name
 }
 
 func init() { file_shared_proto_init() }
@@ -843,7 +1101,7 @@ func file_shared_proto_init() {
 			}
 		}
 		file_shared_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*ServerACK); i {
+			switch v := v.(*Batch); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -855,6 +1113,42 @@ func file_shared_proto_init() {
 			}
 		}
 		file_shared_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ServerACK); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_shared_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ServerSession); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_shared_proto_msgTypes[8].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ServerBroadcast); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_shared_proto_msgTypes[9].Exporter = func(v interface{}, i int) interface{} {
 			switch v := v.(*ExecutedAdvancedQuery_AdvancedQuery); i {
 			case 0:
 				return &v.state
@@ -877,7 +1171,7 @@ func file_shared_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_shared_proto_rawDesc,
 			NumEnums:      3,
-			NumMessages:   7,
+			NumMessages:   10,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
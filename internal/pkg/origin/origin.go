@@ -0,0 +1,242 @@
+// Package origin checks the Origin header of requests against a policy of allowed origins, which is shared by CORS
+// and websocket upgrades alike
+package origin
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/elliotchance/pie/pie"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/publicsuffix"
+
+	"github.com/penguin-statistics/probe/internal/pkg/logger"
+)
+
+// Checks the origin is checked by
+const (
+	CheckCORS      = "cors"
+	CheckWebsocket = "websocket"
+)
+
+const (
+	// LabelMissing is the metric label of requests without an Origin header
+	LabelMissing = "missing"
+	// LabelOther is the metric label of rejected or unmatched origins beyond the first maxLabeled ones
+	LabelOther = "other"
+	// maxLabeled bounds the origins labeled on their own in metrics, as origins are chosen by clients
+	maxLabeled = 64
+)
+
+var log = logger.New("origin")
+
+// Metrics counts the origins rejected, and the origins not matched by the rules but allowed by AllowAll
+type Metrics interface {
+	IncOriginRejected(check, origin string)
+	IncOriginUnmatched(check, origin string)
+}
+
+// Rule is an origin allowed, in the form of scheme://host[:port]. The host may be * for any host of the scheme,
+// or start with *. for any subdomain, and the port may be * for any port. Without a port, only the default
+// port of the scheme, if any, is allowed.
+type Rule struct {
+	Scheme string
+	Host   string
+	Port   string
+}
+
+// ParseRule parses a rule, e.g. https://penguin-stats.io, https://*.penguin-stats.io, http://localhost:* or
+// capacitor://localhost
+func ParseRule(rule string) (Rule, error) {
+	invalid := fmt.Errorf("origin rule %q shall be in the form of scheme://host[:port]", rule)
+	scheme, host, ok := strings.Cut(strings.ToLower(strings.TrimSuffix(rule, "/")), "://")
+	if !ok || scheme == "" || host == "" || strings.ContainsAny(host, "/@?#") {
+		return Rule{}, invalid
+	}
+	port := ""
+	if i := strings.LastIndex(host, ":"); i > strings.LastIndex(host, "]") {
+		host, port = host[:i], host[i+1:]
+		if port == "" {
+			return Rule{}, invalid
+		}
+		if _, err := strconv.ParseUint(port, 10, 16); err != nil && port != "*" {
+			return Rule{}, invalid
+		}
+	}
+	if host == "" || (host != "*" && strings.Contains(strings.TrimPrefix(host, "*."), "*")) {
+		return Rule{}, fmt.Errorf("origin rule %q shall have a host, *, or a wildcard of subdomains only", rule)
+	}
+	return Rule{Scheme: scheme, Host: host, Port: port}, nil
+}
+
+// Matches reports whether the origin u is allowed by the rule
+func (r Rule) Matches(u *url.URL) bool {
+	if u.Scheme != r.Scheme {
+		return false
+	}
+	switch {
+	case r.Host == "*":
+	case strings.HasPrefix(r.Host, "*."):
+		if !strings.HasSuffix(u.Hostname(), r.Host[1:]) {
+			return false
+		}
+	default:
+		if u.Hostname() != strings.Trim(r.Host, "[]") {
+			return false
+		}
+	}
+	return r.Port == "*" || u.Port() == r.Port
+}
+
+// String returns the rule in the form it is parsed from
+func (r Rule) String() string {
+	if r.Port == "" {
+		return r.Scheme + "://" + r.Host
+	}
+	return r.Scheme + "://" + r.Host + ":" + r.Port
+}
+
+// Config configures a Policy
+type Config struct {
+	// AllowAll allows any origin, e.g. for local development. Origins the rules do not match are logged and counted
+	// as unmatched rather than rejected.
+	AllowAll bool
+	// Rules are the origins allowed
+	Rules []string
+	// AllowMissing allows requests without an Origin header, i.e. of clients other than browsers
+	AllowMissing bool
+	Metrics      Metrics
+}
+
+// Policy decides the origins allowed to connect. Rejections are logged and counted with the origin rejected.
+type Policy struct {
+	mu      sync.RWMutex
+	conf    Config
+	rules   []Rule
+	labeled map[string]struct{}
+}
+
+// New creates a Policy with conf
+func New(conf Config) (*Policy, error) {
+	p := &Policy{labeled: make(map[string]struct{})}
+	if err := p.SetConfig(conf); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// SetConfig applies conf. The config in effect is kept if any rule of conf is invalid.
+func (p *Policy) SetConfig(conf Config) error {
+	rules := make([]Rule, 0, len(conf.Rules))
+	for _, rule := range conf.Rules {
+		r, err := ParseRule(rule)
+		if err != nil {
+			return err
+		}
+		rules = append(rules, r)
+	}
+	p.mu.Lock()
+	p.conf, p.rules = conf, rules
+	p.mu.Unlock()
+	return nil
+}
+
+// Allows reports whether the Origin header value origin is allowed
+func (p *Policy) Allows(origin string) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.conf.AllowAll || p.matches(origin)
+}
+
+// matches reports whether origin is allowed by the rules, regardless of AllowAll. p.mu must be held.
+func (p *Policy) matches(origin string) bool {
+	if origin == "" {
+		return p.conf.AllowMissing
+	}
+	u, err := url.Parse(strings.ToLower(origin))
+	if err != nil || u.Host == "" {
+		return false
+	}
+	for _, r := range p.rules {
+		if r.Matches(u) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check reports whether origin is allowed by check, logging and counting it if not matched by the rules: as
+// unmatched if allowed by AllowAll, or as rejected otherwise
+func (p *Policy) Check(check, origin string) bool {
+	p.mu.RLock()
+	matched, allowAll := p.matches(origin), p.conf.AllowAll
+	p.mu.RUnlock()
+	if matched {
+		return true
+	}
+	fields := log.WithFields(logrus.Fields{"check": check, "origin": origin})
+	if allowAll {
+		if l, ok := logger.Sample(fields, "origin: unmatched"); ok {
+			l.Debugln("origin not matched by the rules, allowed as all origins are allowed")
+		}
+	} else if l, ok := logger.Sample(fields, "origin: rejected"); ok {
+		l.Debugln("origin rejected")
+	}
+	p.mu.Lock()
+	label := origin
+	if label == "" {
+		label = LabelMissing
+	}
+	if _, ok := p.labeled[label]; !ok {
+		if len(p.labeled) < maxLabeled {
+			p.labeled[label] = struct{}{}
+		} else {
+			label = LabelOther
+		}
+	}
+	metrics := p.conf.Metrics
+	p.mu.Unlock()
+	switch {
+	case metrics == nil:
+	case allowAll:
+		metrics.IncOriginUnmatched(check, label)
+	default:
+		metrics.IncOriginRejected(check, label)
+	}
+	return allowAll
+}
+
+// CheckOrigin checks the Origin header of websocket upgrades, e.g. as websocket.Upgrader.CheckOrigin
+func (p *Policy) CheckOrigin(r *http.Request) bool {
+	return p.Check(CheckWebsocket, r.Header.Get("Origin"))
+}
+
+// AllowOrigin checks the Origin header of CORS requests, e.g. as middleware.CORSConfig.AllowOriginFunc
+func (p *Policy) AllowOrigin(origin string) (bool, error) {
+	return p.Check(CheckCORS, origin), nil
+}
+
+// Domains returns the registrable domains of the hosts allowed, e.g. penguin-stats.io for https://*.penguin-stats.io.
+// Hosts without a registrable domain, e.g. localhost, are left out.
+func (p *Policy) Domains() []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	var domains pie.Strings
+	for _, r := range p.rules {
+		host := strings.TrimPrefix(r.Host, "*.")
+		if net.ParseIP(strings.Trim(host, "[]")) != nil {
+			continue
+		}
+		domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+		if err != nil || domains.Contains(domain) {
+			continue
+		}
+		domains = append(domains, domain)
+	}
+	return domains
+}
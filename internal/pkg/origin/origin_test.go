@@ -0,0 +1,134 @@
+package origin
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+type metrics map[string]int
+
+func (m metrics) IncOriginRejected(check, origin string) {
+	m[check+" "+origin]++
+}
+
+func (m metrics) IncOriginUnmatched(check, origin string) {
+	m["unmatched "+check+" "+origin]++
+}
+
+func TestPolicy(t *testing.T) {
+	p, err := New(Config{
+		Rules:        []string{"https://penguin-stats.io", "https://*.penguin-stats.cn", "http://localhost:*", "capacitor://localhost", "https://localhost"},
+		AllowMissing: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for origin, expected := range map[string]bool{
+		"https://penguin-stats.io":          true,
+		"https://PENGUIN-STATS.IO":          true,
+		"https://penguin-stats.io:443":      false,
+		"http://penguin-stats.io":           false,
+		"https://cn.penguin-stats.io":       false,
+		"https://evilpenguin-stats.io":      false,
+		"https://penguin-stats.io.evil.com": false,
+		"https://cn.penguin-stats.cn":       true,
+		"https://a.b.penguin-stats.cn":      true,
+		"https://penguin-stats.cn":          false,
+		"http://localhost:8080":             true,
+		"http://localhost":                  true,
+		"capacitor://localhost":             true,
+		"https://localhost":                 true,
+		"https://localhost:8443":            false,
+		"null":                              false,
+		"":                                  true,
+	} {
+		if actual := p.Allows(origin); actual != expected {
+			t.Errorf("expect %v for %q, got %v", expected, origin, actual)
+		}
+	}
+
+	t.Run("should apply configs", func(t *testing.T) {
+		if err := p.SetConfig(Config{Rules: []string{"https://*"}}); err != nil {
+			t.Fatal(err)
+		}
+		if !p.Allows("https://example.com") || p.Allows("http://example.com") || p.Allows("") {
+			t.Error("expect any https origin allowed only")
+		}
+		if err := p.SetConfig(Config{AllowAll: true, Rules: []string{"https://a*.com"}}); err == nil {
+			t.Error("expect error on invalid rule")
+		}
+		if p.Allows("http://example.com") {
+			t.Error("expect config in effect kept on invalid rules")
+		}
+	})
+}
+
+func TestParseRule(t *testing.T) {
+	for _, rule := range []string{"penguin-stats.io", "https://", "https://penguin-stats.io/path", "http://localhost:", "http://localhost:http", "https://a*.com", "https://*.*.com"} {
+		if _, err := ParseRule(rule); err == nil {
+			t.Errorf("expect error on %q", rule)
+		}
+	}
+	if r, err := ParseRule("HTTP://[::1]:*/"); err != nil || r != (Rule{Scheme: "http", Host: "[::1]", Port: "*"}) {
+		t.Error("unexpected rule", r, err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	m := metrics{}
+	p, err := New(Config{Rules: []string{"https://penguin-stats.io"}, Metrics: m})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should check the Origin header of websocket upgrades", func(t *testing.T) {
+		r := &http.Request{Header: http.Header{"Origin": {"https://penguin-stats.io"}}}
+		if !p.CheckOrigin(r) {
+			t.Error("expect origin of the header allowed")
+		}
+		r.Header.Set("Origin", "https://example.com")
+		if p.CheckOrigin(r) {
+			t.Error("expect origin of the header rejected")
+		}
+		r.Header.Del("Origin")
+		if p.CheckOrigin(r) {
+			t.Error("expect missing origin rejected")
+		}
+	})
+
+	t.Run("should count rejections with the origin bounded", func(t *testing.T) {
+		for i := 0; i < maxLabeled+1; i++ {
+			_, _ = p.AllowOrigin("https://" + string(rune('a'+i%26)) + string(rune('a'+i/26)) + ".example.com")
+		}
+		if m["websocket https://example.com"] != 1 || m["websocket missing"] != 1 {
+			t.Error("expect websocket rejections counted by origin, got", m)
+		}
+		// 2 origins have been labeled by the websocket checks already
+		if m["cors other"] != 3 {
+			t.Error("expect origins beyond the bound counted as other, got", m["cors other"])
+		}
+	})
+
+	t.Run("should count origins the rules do not match as unmatched when all origins are allowed", func(t *testing.T) {
+		if err := p.SetConfig(Config{AllowAll: true, Rules: []string{"https://penguin-stats.io"}, Metrics: m}); err != nil {
+			t.Fatal(err)
+		}
+		if !p.Check(CheckCORS, "https://penguin-stats.io") || !p.Check(CheckCORS, "https://example.com") {
+			t.Error("expect any origin allowed")
+		}
+		if m["unmatched cors https://penguin-stats.io"] != 0 || m["unmatched cors https://example.com"] != 1 || m["cors https://example.com"] != 0 {
+			t.Error("expect origin not matched by the rules counted as unmatched only, got", m)
+		}
+	})
+}
+
+func TestDomains(t *testing.T) {
+	p, err := New(Config{Rules: []string{"https://penguin-stats.io", "https://*.penguin-stats.io", "https://cn.exusi.ai", "http://localhost:*", "http://127.0.0.1:*", "https://*"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if domains := p.Domains(); !reflect.DeepEqual(domains, []string{"penguin-stats.io", "exusi.ai"}) {
+		t.Error("expect registrable domains of the hosts, got", domains)
+	}
+}
@@ -0,0 +1,242 @@
+// Package proxyproto accepts connections relayed by proxies speaking the PROXY protocol, versions 1 and 2, so that
+// the addresses of the clients behind them are seen as the remote addresses of the connections
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInvalidHeader is returned by reads of connections which started with a malformed PROXY protocol header
+var ErrInvalidHeader = errors.New("invalid proxy protocol header")
+
+var (
+	// signatureV1 starts version 1 headers, which are human-readable lines
+	signatureV1 = []byte("PROXY ")
+	// signatureV2 starts version 2 headers, which are binary
+	signatureV2 = []byte("\r\n\r\n\x00\r\nQUIT\n")
+)
+
+// maxLengthV1 is the maximum length of version 1 headers, including the CRLF
+const maxLengthV1 = 107
+
+// Listener accepts connections which may start with a PROXY protocol header. Headers are read from the connections
+// of trusted peers only, and connections of trusted peers without any header are accepted as is, e.g. of health checks.
+type Listener struct {
+	net.Listener
+	trusted func(addr net.Addr) bool
+	timeout time.Duration
+}
+
+// NewListener wraps ln to read PROXY protocol headers from the connections of peers trusted reports true for,
+// giving up reading a header after timeout
+func NewListener(ln net.Listener, trusted func(addr net.Addr) bool, timeout time.Duration) *Listener {
+	return &Listener{Listener: ln, trusted: trusted, timeout: timeout}
+}
+
+// Accept implements net.Listener. The header is read on the first read or address lookup of the connection
+// rather than here, so that slow peers don't hold up other connections.
+func (l *Listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if !l.trusted(conn.RemoteAddr()) {
+		return conn, nil
+	}
+	return &Conn{Conn: conn, r: bufio.NewReader(conn), timeout: l.timeout}, nil
+}
+
+// Conn is a connection of a trusted peer, whose addresses are those carried by its PROXY protocol header if any
+type Conn struct {
+	net.Conn
+	r       *bufio.Reader
+	timeout time.Duration
+
+	once          sync.Once
+	remote, local net.Addr
+	err           error
+}
+
+// init reads the header once, within the timeout
+func (c *Conn) init() {
+	c.once.Do(func() {
+		if c.timeout > 0 {
+			_ = c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+			defer c.Conn.SetReadDeadline(time.Time{})
+		}
+		c.remote, c.local, c.err = ReadHeader(c.r)
+	})
+}
+
+// Read implements net.Conn. It fails with ErrInvalidHeader if the header is malformed.
+func (c *Conn) Read(b []byte) (int, error) {
+	c.init()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.r.Read(b)
+}
+
+// RemoteAddr implements net.Conn, returning the source address of the header if any
+func (c *Conn) RemoteAddr() net.Addr {
+	c.init()
+	if c.remote != nil {
+		return c.remote
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// LocalAddr implements net.Conn, returning the destination address of the header if any
+func (c *Conn) LocalAddr() net.Addr {
+	c.init()
+	if c.local != nil {
+		return c.local
+	}
+	return c.Conn.LocalAddr()
+}
+
+// ReadHeader reads a PROXY protocol header of either version from r, returning the source and destination addresses
+// it carries. Addresses are nil if r doesn't start with a header, or if the header carries none, e.g. of health
+// checks of the proxy itself or of unknown protocols, and the addresses of the connection shall be used instead.
+func ReadHeader(r *bufio.Reader) (src, dst net.Addr, err error) {
+	b, err := r.Peek(1)
+	if err != nil {
+		// left to the reads of the connection to report
+		return nil, nil, nil
+	}
+	switch b[0] {
+	case signatureV1[0]:
+		if b, err := r.Peek(len(signatureV1)); err == nil && bytes.Equal(b, signatureV1) {
+			return readV1(r)
+		}
+	case signatureV2[0]:
+		if b, err := r.Peek(len(signatureV2)); err == nil && bytes.Equal(b, signatureV2) {
+			return readV2(r)
+		}
+	}
+	return nil, nil, nil
+}
+
+// readV1 reads a version 1 header, e.g. PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n
+func readV1(r *bufio.Reader) (src, dst net.Addr, err error) {
+	var line []byte
+	for len(line) < maxLengthV1 {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, nil, ErrInvalidHeader
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, nil, ErrInvalidHeader
+	}
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, nil, ErrInvalidHeader
+	}
+	srcAddr, err := parseV1Addr(fields[2], fields[4], fields[1] == "TCP4")
+	if err != nil {
+		return nil, nil, err
+	}
+	dstAddr, err := parseV1Addr(fields[3], fields[5], fields[1] == "TCP4")
+	if err != nil {
+		return nil, nil, err
+	}
+	return srcAddr, dstAddr, nil
+}
+
+func parseV1Addr(ip, port string, v4 bool) (*net.TCPAddr, error) {
+	addr := net.ParseIP(ip)
+	if addr == nil || (addr.To4() != nil) != v4 {
+		return nil, ErrInvalidHeader
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, ErrInvalidHeader
+	}
+	return &net.TCPAddr{IP: addr, Port: int(p)}, nil
+}
+
+// readV2 reads a version 2 header, which is the signature followed by the version and command, the address family
+// and transport protocol, the length of the rest and the rest, i.e. the addresses and optional TLVs
+func readV2(r *bufio.Reader) (src, dst net.Addr, err error) {
+	header := make([]byte, len(signatureV2)+4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, nil, ErrInvalidHeader
+	}
+	versionCommand, family := header[12], header[13]
+	rest := make([]byte, binary.BigEndian.Uint16(header[14:]))
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return nil, nil, ErrInvalidHeader
+	}
+	if versionCommand>>4 != 2 {
+		return nil, nil, ErrInvalidHeader
+	}
+	switch versionCommand & 0xf {
+	case 0:
+		// LOCAL, e.g. health checks of the proxy itself
+		return nil, nil, nil
+	case 1:
+		// PROXY
+	default:
+		return nil, nil, ErrInvalidHeader
+	}
+
+	var size int
+	switch family >> 4 {
+	case 1:
+		size = net.IPv4len
+	case 2:
+		size = net.IPv6len
+	default:
+		// unspecified or unix addresses, which mean nothing for client addresses
+		return nil, nil, nil
+	}
+	if len(rest) < 2*size+4 {
+		return nil, nil, ErrInvalidHeader
+	}
+	src = &net.TCPAddr{IP: net.IP(rest[:size]), Port: int(binary.BigEndian.Uint16(rest[2*size:]))}
+	dst = &net.TCPAddr{IP: net.IP(rest[size : 2*size]), Port: int(binary.BigEndian.Uint16(rest[2*size+2:]))}
+	return src, dst, nil
+}
+
+// HeaderV1 returns the version 1 header of a TCP connection from src to dst, e.g. for proxies and tests
+func HeaderV1(src, dst *net.TCPAddr) []byte {
+	protocol := "TCP6"
+	if src.IP.To4() != nil {
+		protocol = "TCP4"
+	}
+	return []byte("PROXY " + protocol + " " + src.IP.String() + " " + dst.IP.String() + " " + strconv.Itoa(src.Port) + " " + strconv.Itoa(dst.Port) + "\r\n")
+}
+
+// HeaderV2 returns the version 2 header of a TCP connection from src to dst, e.g. for proxies and tests
+func HeaderV2(src, dst *net.TCPAddr) []byte {
+	family, srcIP, dstIP := byte(0x21), src.IP.To16(), dst.IP.To16()
+	if src.IP.To4() != nil {
+		family, srcIP, dstIP = 0x11, src.IP.To4(), dst.IP.To4()
+	}
+	header := append([]byte{}, signatureV2...)
+	header = append(header, 0x21, family, 0, 0)
+	binary.BigEndian.PutUint16(header[14:], uint16(2*len(srcIP)+4))
+	header = append(header, srcIP...)
+	header = append(header, dstIP...)
+	ports := make([]byte, 4)
+	binary.BigEndian.PutUint16(ports, uint16(src.Port))
+	binary.BigEndian.PutUint16(ports[2:], uint16(dst.Port))
+	return append(header, ports...)
+}
@@ -0,0 +1,111 @@
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadHeader(t *testing.T) {
+	src := &net.TCPAddr{IP: net.ParseIP("203.0.113.7").To4(), Port: 56324}
+	dst := &net.TCPAddr{IP: net.ParseIP("192.0.2.1").To4(), Port: 443}
+	src6 := &net.TCPAddr{IP: net.ParseIP("2001:db8::7"), Port: 56324}
+	dst6 := &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 443}
+	request := "GET / HTTP/1.1\r\n"
+	truncated := HeaderV2(src, dst)[:20]
+	truncated[15] = 4
+
+	for name, c := range map[string]struct {
+		header []byte
+		src    string
+		err    error
+	}{
+		"should read v1 headers":                     {HeaderV1(src, dst), "203.0.113.7:56324", nil},
+		"should read v1 headers of ipv6":             {HeaderV1(src6, dst6), "[2001:db8::7]:56324", nil},
+		"should read v2 headers":                     {HeaderV2(src, dst), "203.0.113.7:56324", nil},
+		"should read v2 headers of ipv6":             {HeaderV2(src6, dst6), "[2001:db8::7]:56324", nil},
+		"should leave connections without header":    {nil, "", nil},
+		"should leave v1 headers of unknown sources": {[]byte("PROXY UNKNOWN\r\n"), "", nil},
+		"should leave v2 headers of local commands":  {append(append([]byte{}, signatureV2...), 0x20, 0, 0, 0), "", nil},
+		"should reject malformed v1 headers":         {[]byte("PROXY TCP4 203.0.113.7 192.0.2.1 56324\r\n"), "", ErrInvalidHeader},
+		"should reject v1 headers of wrong families": {[]byte("PROXY TCP6 203.0.113.7 192.0.2.1 56324 443\r\n"), "", ErrInvalidHeader},
+		"should reject v1 headers too long":          {[]byte("PROXY " + strings.Repeat("A", maxLengthV1)), "", ErrInvalidHeader},
+		"should reject truncated v2 headers":         {truncated, "", ErrInvalidHeader},
+	} {
+		t.Run(name, func(t *testing.T) {
+			r := bufio.NewReader(io.MultiReader(bytes.NewReader(c.header), strings.NewReader(request)))
+			actual, _, err := ReadHeader(r)
+			if err != c.err {
+				t.Fatal("expect error", c.err, "got", err)
+			}
+			if err != nil {
+				return
+			}
+			if (actual == nil && c.src != "") || (actual != nil && actual.String() != c.src) {
+				t.Errorf("expect source %q, got %v", c.src, actual)
+			}
+			if rest, _ := io.ReadAll(r); string(rest) != request {
+				t.Errorf("expect the request left to read, got %q", rest)
+			}
+		})
+	}
+}
+
+func TestListener(t *testing.T) {
+	src := &net.TCPAddr{IP: net.ParseIP("203.0.113.7").To4(), Port: 56324}
+	dst := &net.TCPAddr{IP: net.ParseIP("192.0.2.1").To4(), Port: 443}
+
+	accept := func(t *testing.T, trusted bool, send []byte) (net.Conn, []byte) {
+		inner, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ln := NewListener(inner, func(net.Addr) bool { return trusted }, time.Second)
+		defer ln.Close()
+
+		client, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+		if _, err := client.Write(send); err != nil {
+			t.Fatal(err)
+		}
+
+		conn, err := ln.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+		b := make([]byte, 5)
+		if _, err := io.ReadFull(conn, b); err != nil {
+			t.Fatal(err)
+		}
+		return conn, b
+	}
+
+	t.Run("should take the source of trusted peers from the header", func(t *testing.T) {
+		conn, b := accept(t, true, append(HeaderV1(src, dst), "hello"...))
+		if conn.RemoteAddr().String() != "203.0.113.7:56324" || conn.LocalAddr().String() != "192.0.2.1:443" {
+			t.Error("expect addresses of the header, got", conn.RemoteAddr(), conn.LocalAddr())
+		}
+		if string(b) != "hello" {
+			t.Errorf("expect data after the header, got %q", b)
+		}
+	})
+
+	t.Run("should not read headers of untrusted peers", func(t *testing.T) {
+		conn, b := accept(t, false, append(HeaderV2(src, dst), "hello"...))
+		if host, _, _ := net.SplitHostPort(conn.RemoteAddr().String()); host != "127.0.0.1" {
+			t.Error("expect address of the peer, got", conn.RemoteAddr())
+		}
+		if !bytes.Equal(b, signatureV2[:5]) {
+			t.Errorf("expect the header left as data, got %q", b)
+		}
+	})
+}
@@ -0,0 +1,232 @@
+// Package pseudonym replaces user IDs with keyed hashes under salts which rotate periodically, so that visits of a
+// user are linkable within a period but not across periods once the salts of past periods are forgotten
+package pseudonym
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/penguin-statistics/probe/internal/pkg/logger"
+)
+
+// saltSize is the size of salts in bytes
+const saltSize = 32
+
+const (
+	// lockTimeout is the time waited for other instances to finish rotating salts kept in a shared file
+	lockTimeout = time.Second
+	// lockStale is the age of locks of salt files which are considered left behind by crashed instances
+	lockStale = 10 * time.Second
+	// lockRetry is the interval locks of salt files are retried in
+	lockRetry = 10 * time.Millisecond
+)
+
+var log = logger.New("pseudonym")
+
+// Config configures the rotation of salts
+type Config struct {
+	// Rotation is the period each salt is used for. Periods are aligned to the Unix epoch, e.g. to 00:00 UTC for 24h.
+	Rotation time.Duration
+	// Keep is the amount of salts of past periods kept, e.g. to look up pseudonyms of recent periods
+	Keep int
+	// File is the file salts are kept in across restarts. Salts are kept in memory only if empty.
+	File string
+}
+
+// salt is the salt of a period
+type salt struct {
+	Epoch int64  `json:"epoch"`
+	Key   []byte `json:"key"`
+}
+
+// Pseudonymizer replaces user IDs with pseudonyms
+type Pseudonymizer struct {
+	conf Config
+	now  func() time.Time
+
+	mu sync.Mutex
+	// salts are ordered from the newest to the oldest
+	salts []salt
+}
+
+// New creates a Pseudonymizer with conf, reading the salts kept in conf.File if any
+func New(conf Config) (*Pseudonymizer, error) {
+	if conf.Rotation <= 0 {
+		return nil, errors.New("rotation shall be positive")
+	}
+	p := &Pseudonymizer{conf: conf, now: time.Now}
+	if conf.File != "" {
+		salts, err := load(conf.File)
+		if err != nil {
+			return nil, err
+		}
+		p.salts = salts
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.rotate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Pseudonymize returns the pseudonym of uid under the salt of the current period
+func (p *Pseudonymizer) Pseudonymize(uid string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.rotate(); err != nil {
+		// the salt has been rotated in memory regardless, only keeping it across restarts failed
+		log.Warnln("failed to write salts to file", err)
+	}
+	return hash(p.salts[0].Key, uid)
+}
+
+// Pseudonyms returns the pseudonyms of uid under the salts of the current period and the past periods kept,
+// from the newest to the oldest
+func (p *Pseudonymizer) Pseudonyms(uid string) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.rotate(); err != nil {
+		log.Warnln("failed to write salts to file", err)
+	}
+	pseudonyms := make([]string, len(p.salts))
+	for i, s := range p.salts {
+		pseudonyms[i] = hash(s.Key, uid)
+	}
+	return pseudonyms
+}
+
+// rotate creates the salt of the current period if it is missing and forgets salts of periods older than kept.
+// Instances sharing File adopt the salt of the period created by the first of them, so that they agree on pseudonyms.
+// It shall be called with mu held.
+func (p *Pseudonymizer) rotate() error {
+	epoch := p.now().UnixNano() / int64(p.conf.Rotation)
+	changed := p.forget(epoch)
+	if len(p.salts) > 0 && p.salts[0].Epoch >= epoch {
+		if !changed || p.conf.File == "" {
+			return nil
+		}
+		return p.save()
+	}
+	if p.conf.File == "" {
+		p.salts = append([]salt{newSalt(epoch)}, p.salts...)
+		return nil
+	}
+
+	unlock, err := lock(p.conf.File)
+	if err != nil {
+		// pseudonymize regardless, under a salt of this instance only
+		p.salts = append([]salt{newSalt(epoch)}, p.salts...)
+		return err
+	}
+	defer unlock()
+	salts, err := load(p.conf.File)
+	if err != nil {
+		p.salts = append([]salt{newSalt(epoch)}, p.salts...)
+		return err
+	}
+	if len(salts) > 0 {
+		p.salts = salts
+		p.forget(epoch)
+	}
+	if len(p.salts) == 0 || p.salts[0].Epoch < epoch {
+		p.salts = append([]salt{newSalt(epoch)}, p.salts...)
+	}
+	return p.save()
+}
+
+// forget forgets salts of periods older than kept as of epoch. It reports whether any salt has been forgotten.
+func (p *Pseudonymizer) forget(epoch int64) bool {
+	kept := p.salts[:0]
+	for _, s := range p.salts {
+		if s.Epoch >= epoch-int64(p.conf.Keep) && s.Epoch <= epoch {
+			kept = append(kept, s)
+		}
+	}
+	changed := len(kept) != len(p.salts)
+	p.salts = kept
+	return changed
+}
+
+// newSalt creates a random salt of epoch
+func newSalt(epoch int64) salt {
+	key := make([]byte, saltSize)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	return salt{Epoch: epoch, Key: key}
+}
+
+// load reads the salts kept in file. A file which does not exist yet keeps no salts.
+func load(file string) ([]salt, error) {
+	b, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var salts []salt
+	return salts, json.Unmarshal(b, &salts)
+}
+
+// lock acquires the lock file of file, which instances sharing file hold while rotating, waiting for lockTimeout at
+// most. Locks left behind by crashed instances are broken once older than lockStale.
+func lock(file string) (unlock func(), err error) {
+	name := file + ".lock"
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		f, err := os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(name) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		if info, err := os.Stat(name); err == nil && time.Since(info.ModTime()) > lockStale {
+			os.Remove(name)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, errors.New("timed out waiting for the lock of the salt file")
+		}
+		time.Sleep(lockRetry)
+	}
+}
+
+// save writes the salts to the file atomically, so that a crash never leaves a truncated file behind
+func (p *Pseudonymizer) save() error {
+	b, err := json.Marshal(p.salts)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(p.conf.File), filepath.Base(p.conf.File)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), p.conf.File)
+}
+
+// hash returns the keyed hash of uid, truncated to fit the 32 characters of the uid column
+func hash(key []byte, uid string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(uid))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
@@ -0,0 +1,93 @@
+package pseudonym
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPseudonymizer(t *testing.T) {
+	const uid = "0123456789abcdef0123456789abcdef"
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	t.Run("should rotate salts per period and keep past ones", func(t *testing.T) {
+		p, err := New(Config{Rotation: 24 * time.Hour, Keep: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.now = clock
+
+		first := p.Pseudonymize(uid)
+		if len(first) != 32 || first == uid {
+			t.Fatal("expect a 32-character pseudonym, got", first)
+		}
+		if p.Pseudonymize(uid) != first || p.Pseudonymize("another") == first {
+			t.Error("expect pseudonyms to be stable within a period and distinct per uid")
+		}
+
+		now = now.Add(24 * time.Hour)
+		second := p.Pseudonymize(uid)
+		if second == first {
+			t.Error("expect pseudonym to change once the salt rotates")
+		}
+		if pseudonyms := p.Pseudonyms(uid); len(pseudonyms) != 2 || pseudonyms[0] != second || pseudonyms[1] != first {
+			t.Error("expect pseudonyms under the current and the kept salt, got", pseudonyms)
+		}
+
+		now = now.Add(48 * time.Hour)
+		for _, pseudonym := range p.Pseudonyms(uid) {
+			if pseudonym == first || pseudonym == second {
+				t.Error("expect salts older than kept to be forgotten")
+			}
+		}
+	})
+
+	t.Run("should keep salts in file across restarts", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "salts.json")
+		conf := Config{Rotation: time.Hour, File: file}
+		p, err := New(conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pseudonym := p.Pseudonymize(uid)
+		if info, err := os.Stat(file); err != nil || info.Mode().Perm() != 0o600 {
+			t.Fatal("expect salts written to a private file", err)
+		}
+
+		restarted, err := New(conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if restarted.Pseudonymize(uid) != pseudonym {
+			t.Error("expect salt read from file")
+		}
+	})
+
+	t.Run("should agree on the salt of a period with instances sharing the file", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "salts.json")
+		conf := Config{Rotation: 24 * time.Hour, Keep: 1, File: file}
+		a, err := New(conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := New(conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a.Pseudonymize(uid) != b.Pseudonymize(uid) {
+			t.Error("expect the salt read from file at startup")
+		}
+
+		tomorrow := time.Now().Add(24 * time.Hour)
+		a.now = func() time.Time { return tomorrow }
+		b.now = a.now
+		if a.Pseudonymize(uid) != b.Pseudonymize(uid) {
+			t.Error("expect the salt rotated by another instance adopted")
+		}
+		if _, err := os.Stat(file + ".lock"); !os.IsNotExist(err) {
+			t.Error("expect the lock released, got", err)
+		}
+	})
+}
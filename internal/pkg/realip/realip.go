@@ -0,0 +1,100 @@
+// Package realip resolves the addresses of clients connecting through trusted proxies, e.g. CDNs and load balancers
+package realip
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Headers trusted proxies report client addresses in
+const (
+	// HeaderNone trusts no header: client addresses are the addresses of peers, e.g. behind PROXY protocol proxies
+	HeaderNone = "none"
+	// HeaderXForwardedFor trusts X-Forwarded-For, skipping the addresses appended by trusted proxies
+	HeaderXForwardedFor = "x-forwarded-for"
+	// HeaderXRealIP trusts X-Real-IP set by trusted proxies
+	HeaderXRealIP = "x-real-ip"
+)
+
+// Headers are the headers client addresses can be resolved from
+var Headers = []string{HeaderNone, HeaderXForwardedFor, HeaderXRealIP}
+
+// Trusted are the networks of trusted proxies
+type Trusted []*net.IPNet
+
+// ParseTrusted parses trusted networks from CIDRs or bare addresses
+func ParseTrusted(networks []string) (Trusted, error) {
+	trusted := make(Trusted, 0, len(networks))
+	for _, network := range networks {
+		if !strings.Contains(network, "/") {
+			ip := net.ParseIP(network)
+			if ip == nil {
+				return nil, &net.ParseError{Type: "IP address", Text: network}
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			trusted = append(trusted, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(network)
+		if err != nil {
+			return nil, err
+		}
+		trusted = append(trusted, n)
+	}
+	return trusted, nil
+}
+
+// Contains reports whether ip is within any of the trusted networks
+func (t Trusted) Contains(ip net.IP) bool {
+	for _, n := range t {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ContainsAddr reports whether the host of addr, e.g. the remote address of a connection, is trusted
+func (t Trusted) ContainsAddr(addr net.Addr) bool {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return false
+	}
+	return t.Contains(net.ParseIP(host))
+}
+
+// Extractor returns the extractor of client addresses from header, as reported by the proxies of t. Addresses
+// reported by any other peer are ignored, so that clients can't spoof them. Private networks are not trusted
+// unless listed in t.
+func Extractor(t Trusted, header string) echo.IPExtractor {
+	options := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+	for _, n := range t {
+		options = append(options, echo.TrustIPRange(n))
+	}
+	switch header {
+	case HeaderXForwardedFor:
+		return echo.ExtractIPFromXFFHeader(options...)
+	case HeaderXRealIP:
+		// echo.ExtractIPFromRealIPHeader checks the address reported rather than the peer reporting it
+		direct := echo.ExtractIPDirect()
+		return func(r *http.Request) string {
+			peer := direct(r)
+			if !t.Contains(net.ParseIP(peer)) {
+				return peer
+			}
+			real := strings.TrimSuffix(strings.TrimPrefix(r.Header.Get(echo.HeaderXRealIP), "["), "]")
+			if ip := net.ParseIP(real); ip != nil {
+				return ip.String()
+			}
+			return peer
+		}
+	default:
+		return echo.ExtractIPDirect()
+	}
+}
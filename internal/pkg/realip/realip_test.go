@@ -0,0 +1,41 @@
+package realip
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestExtractor(t *testing.T) {
+	trusted, err := ParseTrusted([]string{"10.0.0.0/8", "192.0.2.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, c := range map[string]struct {
+		header, remote string
+		request        http.Header
+		expected       string
+	}{
+		"should resolve from x-forwarded-for of trusted proxies": {HeaderXForwardedFor, "10.0.0.1:80", http.Header{"X-Forwarded-For": {"203.0.113.7, 192.0.2.1"}}, "203.0.113.7"},
+		"should skip addresses spoofed by clients":               {HeaderXForwardedFor, "10.0.0.1:80", http.Header{"X-Forwarded-For": {"198.51.100.1, 203.0.113.7"}}, "203.0.113.7"},
+		"should ignore x-forwarded-for of untrusted peers":       {HeaderXForwardedFor, "172.16.0.1:80", http.Header{"X-Forwarded-For": {"203.0.113.7"}}, "172.16.0.1"},
+		"should resolve from x-real-ip of trusted proxies":       {HeaderXRealIP, "192.0.2.1:80", http.Header{"X-Real-Ip": {"203.0.113.7"}}, "203.0.113.7"},
+		"should ignore x-real-ip of untrusted peers":             {HeaderXRealIP, "127.0.0.1:80", http.Header{"X-Real-Ip": {"203.0.113.7"}}, "127.0.0.1"},
+		"should ignore headers if none is trusted":               {HeaderNone, "10.0.0.1:80", http.Header{"X-Forwarded-For": {"203.0.113.7"}}, "10.0.0.1"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			r := &http.Request{RemoteAddr: c.remote, Header: c.request}
+			if actual := Extractor(trusted, c.header)(r); actual != c.expected {
+				t.Errorf("expect %s, got %s", c.expected, actual)
+			}
+		})
+	}
+
+	t.Run("should reject invalid networks", func(t *testing.T) {
+		if _, err := ParseTrusted([]string{"10.0.0.0/33"}); err == nil {
+			t.Error("expect error on invalid cidr")
+		}
+		if _, err := ParseTrusted([]string{"example.com"}); err == nil {
+			t.Error("expect error on invalid address")
+		}
+	})
+}
@@ -0,0 +1,150 @@
+// Package searchquery processes search queries reported by clients before they are stored: queries are truncated,
+// PII-like patterns are redacted, and the width and case of queries are normalized, so that e.g. full-width CJK
+// input of a term is stored as the term itself
+package searchquery
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+
+	"golang.org/x/text/width"
+)
+
+// Patterns redacted, in the order they are matched
+const (
+	PatternURL    = "url"
+	PatternEmail  = "email"
+	PatternNumber = "number"
+)
+
+// minRedactedDigits is the least digits a number shall consist of to be redacted, e.g. account IDs and phone
+// numbers, whereas item IDs (5 digits) and stage codes (e.g. 10-17) are kept
+const minRedactedDigits = 6
+
+var patterns = []struct {
+	name string
+	re   *regexp.Regexp
+	// redact reports whether the match shall be redacted. All matches are redacted if nil.
+	redact func(match string) bool
+}{
+	{PatternURL, regexp.MustCompile(`(?i)\b(?:https?://|www\.)\S+`), nil},
+	{PatternEmail, regexp.MustCompile(`[a-zA-Z0-9._%+-]+@[a-zA-Z0-9-]+(?:\.[a-zA-Z0-9-]+)+`), nil},
+	{PatternNumber, regexp.MustCompile(`\+?\d+(?:[ -]\d{3,})*`), func(match string) bool {
+		digits := 0
+		for _, r := range match {
+			if r >= '0' && r <= '9' {
+				digits++
+			}
+		}
+		return digits >= minRedactedDigits
+	}},
+}
+
+// Metrics receives the queries redacted
+type Metrics interface {
+	// IncRedacted counts a query with anything redacted, once whatever the patterns redacted
+	IncRedacted()
+}
+
+type nopMetrics struct{}
+
+func (nopMetrics) IncRedacted() {}
+
+// Config configures a Processor
+type Config struct {
+	// MaxLength is the maximum runes of a query. Longer queries are truncated.
+	MaxLength int
+	// KeepRaw keeps the raw form of queries in addition to the normalized one, unless anything has been redacted
+	KeepRaw bool
+	// Metrics receives the queries redacted. Optional.
+	Metrics Metrics
+}
+
+// Result is a processed query
+type Result struct {
+	// Query is the redacted, normalized and truncated query
+	Query string
+	// Raw is the truncated query as reported, if kept
+	Raw string
+	// Redacted are the patterns redacted from the query
+	Redacted []string
+}
+
+// Processor processes search queries
+type Processor struct {
+	mu     sync.RWMutex
+	config Config
+}
+
+// New creates a Processor with config
+func New(config Config) *Processor {
+	return &Processor{config: config}
+}
+
+// SetConfig replaces the config of the processor. Metrics is kept if not set in config.
+func (p *Processor) SetConfig(config Config) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if config.Metrics == nil {
+		config.Metrics = p.config.Metrics
+	}
+	p.config = config
+}
+
+// Process redacts patterns looking like PII with placeholders such as [email], normalizes the query to narrow width
+// and lower case with whitespaces collapsed, then truncates it. The whole query is redacted before it is truncated,
+// so that PII cut at the length limit is redacted all the same.
+func (p *Processor) Process(query string) Result {
+	p.mu.RLock()
+	config := p.config
+	p.mu.RUnlock()
+	metrics := config.Metrics
+	if metrics == nil {
+		metrics = nopMetrics{}
+	}
+
+	// fold first, so that full-width input is redacted as well
+	normalized := width.Fold.String(query)
+	var redacted []string
+	for _, pattern := range patterns {
+		found := false
+		normalized = pattern.re.ReplaceAllStringFunc(normalized, func(match string) string {
+			if pattern.redact != nil && !pattern.redact(match) {
+				return match
+			}
+			found = true
+			return "[" + pattern.name + "]"
+		})
+		if found {
+			redacted = append(redacted, pattern.name)
+		}
+	}
+	if len(redacted) > 0 {
+		metrics.IncRedacted()
+	}
+
+	result := Result{
+		Query:    truncate(strings.Join(strings.Fields(strings.ToLower(normalized)), " "), config.MaxLength),
+		Redacted: redacted,
+	}
+	if config.KeepRaw && len(redacted) == 0 {
+		result.Raw = truncate(query, config.MaxLength)
+	}
+	return result
+}
+
+// truncate returns the first max runes of s. s is kept as is if max is not positive.
+func truncate(s string, max int) string {
+	if max <= 0 {
+		return s
+	}
+	n := 0
+	for i := range s {
+		if n == max {
+			return s[:i]
+		}
+		n++
+	}
+	return s
+}
@@ -0,0 +1,53 @@
+package searchquery
+
+import (
+	"reflect"
+	"testing"
+)
+
+type countingMetrics struct {
+	redacted int
+}
+
+func (m *countingMetrics) IncRedacted() {
+	m.redacted++
+}
+
+func TestProcess(t *testing.T) {
+	metrics := &countingMetrics{}
+	p := New(Config{MaxLength: 32, KeepRaw: true, Metrics: metrics})
+
+	for _, c := range []struct {
+		query    string
+		expected Result
+	}{
+		{"1-7", Result{Query: "1-7", Raw: "1-7"}},
+		{"  Orirock   Cube ", Result{Query: "orirock cube", Raw: "  Orirock   Cube "}},
+		{"ＳＫ－５　固源岩", Result{Query: "sk-5 固源岩", Raw: "ＳＫ－５　固源岩"}},
+		{"30012 10-17", Result{Query: "30012 10-17", Raw: "30012 10-17"}},
+		{"doctor@example.com", Result{Query: "[email]", Redacted: []string{PatternEmail}}},
+		{"ｄｏｃｔｏｒ＠ｅｘａｍｐｌｅ．ｃｏｍ", Result{Query: "[email]", Redacted: []string{PatternEmail}}},
+		{"uid 12345678", Result{Query: "uid [number]", Redacted: []string{PatternNumber}}},
+		{"+86 138 1234 5678", Result{Query: "[number]", Redacted: []string{PatternNumber}}},
+		{"https://penguin-stats.io/?id=1", Result{Query: "[url]", Redacted: []string{PatternURL}}},
+		{"aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Result{Query: "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Raw: "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"}},
+		// PII straddling the length limit is redacted before the query is truncated
+		{"orirock cube for doctor@example.com", Result{Query: "orirock cube for [email]", Redacted: []string{PatternEmail}}},
+		{"where to farm orirock 13812345678", Result{Query: "where to farm orirock [number]", Redacted: []string{PatternNumber}}},
+		{"doctor@example.com 12345678", Result{Query: "[email] [number]", Redacted: []string{PatternEmail, PatternNumber}}},
+	} {
+		if actual := p.Process(c.query); !reflect.DeepEqual(actual, c.expected) {
+			t.Errorf("expect %q processed as %+v, got %+v", c.query, c.expected, actual)
+		}
+	}
+	if metrics.redacted != 8 {
+		t.Error("expect queries redacted counted once each, got", metrics.redacted)
+	}
+
+	t.Run("should not keep raw queries unless configured", func(t *testing.T) {
+		p.SetConfig(Config{MaxLength: 32})
+		if r := p.Process("Orirock"); r.Raw != "" || r.Query != "orirock" {
+			t.Error("unexpected result", r)
+		}
+	})
+}
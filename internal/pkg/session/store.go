@@ -0,0 +1,177 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// maxClockSkew is the tolerance of tokens issued in the future, e.g. by instances whose clocks are ahead
+const maxClockSkew = time.Minute
+
+// ErrNotResumable describes a session which is unknown, belongs to another user or has been expired, or a token
+// which has been expired
+var ErrNotResumable = errors.New("session not resumable")
+
+// State is the per-session state which survives reconnects within the resume window
+type State struct {
+	// ID is the bonjour ID of the session
+	ID string
+	// UID is the user ID which initiated the session
+	UID string
+
+	mu         sync.Mutex
+	lastRoute  string
+	lastSeq    uint32
+	conns      int
+	detachedAt time.Time
+}
+
+// LastRoute returns the last route the client navigated to within the session
+func (st *State) LastRoute() string {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.lastRoute
+}
+
+// SetLastRoute updates the last route the client navigated to within the session
+func (st *State) SetLastRoute(route string) {
+	st.mu.Lock()
+	st.lastRoute = route
+	st.mu.Unlock()
+}
+
+// LastSeq returns the last sequence number received within the session
+func (st *State) LastSeq() uint32 {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.lastSeq
+}
+
+// SetLastSeq updates the last sequence number received within the session
+func (st *State) SetLastSeq(seq uint32) {
+	st.mu.Lock()
+	st.lastSeq = seq
+	st.mu.Unlock()
+}
+
+// expired reports whether the session has no connections attached for longer than window
+func (st *State) expired(now time.Time, window time.Duration) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.conns == 0 && now.Sub(st.detachedAt) > window
+}
+
+// Store holds session states of connected clients and of those which disconnected within the resume window.
+// States are held in memory, so sessions may only be resumed on the instance which created them.
+type Store struct {
+	signer *Signer
+	window time.Duration
+
+	mu       sync.Mutex
+	sessions map[string]*State
+}
+
+// NewStore creates a Store which signs resume tokens with signer and keeps detached sessions for window
+func NewStore(signer *Signer, window time.Duration) *Store {
+	return &Store{
+		signer:   signer,
+		window:   window,
+		sessions: make(map[string]*State),
+	}
+}
+
+// Create creates and attaches a new session
+func (s *Store) Create(id, uid, route string) *State {
+	st := &State{
+		ID:        id,
+		UID:       uid,
+		lastRoute: route,
+		conns:     1,
+	}
+	s.mu.Lock()
+	s.sessions[id] = st
+	s.mu.Unlock()
+	return st
+}
+
+// Resume verifies token and re-attaches the session it was issued for. The token shall not be expired, uid shall
+// match the one which created the session, and the session shall be either still attached or be detached within
+// the resume window.
+func (s *Store) Resume(token, uid string) (*State, error) {
+	id, issuedAt, err := s.signer.Verify(token)
+	if err != nil {
+		return nil, err
+	}
+	if now := time.Now(); now.Sub(issuedAt) > s.tokenLifetime() || issuedAt.After(now.Add(maxClockSkew)) {
+		return nil, ErrNotResumable
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := s.sessions[id]
+	if !ok || st.UID != uid || st.expired(time.Now(), s.window) {
+		return nil, ErrNotResumable
+	}
+	st.mu.Lock()
+	st.conns++
+	st.mu.Unlock()
+	return st, nil
+}
+
+// Token issues a resume token for st. Tokens expire once the resume window has passed since they could have been
+// refreshed last, so attached clients shall be issued fresh tokens every RefreshInterval.
+func (s *Store) Token(st *State) string {
+	return s.signer.Sign(st.ID, time.Now())
+}
+
+// RefreshInterval returns the interval resume tokens shall be refreshed in for attached clients
+func (s *Store) RefreshInterval() time.Duration {
+	return s.window / 2
+}
+
+// tokenLifetime is the time tokens are valid for after being issued, i.e. the resume window after the next refresh
+func (s *Store) tokenLifetime() time.Duration {
+	return s.RefreshInterval() + s.window
+}
+
+// Detach marks a connection of st as gone. The session is kept for the resume window after its last
+// connection has been detached.
+func (s *Store) Detach(st *State) {
+	st.mu.Lock()
+	st.conns--
+	if st.conns <= 0 {
+		st.conns = 0
+		st.detachedAt = time.Now()
+	}
+	st.mu.Unlock()
+}
+
+// Len returns the amount of sessions held, including the detached ones
+func (s *Store) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sessions)
+}
+
+// Run periodically removes sessions which have been detached for longer than the resume window, until ctx is done
+func (s *Store) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.window / 2)
+	defer ticker.Stop()
+	for {
+		var now time.Time
+		select {
+		case now = <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		s.mu.Lock()
+		for id, st := range s.sessions {
+			if st.expired(now, s.window) {
+				delete(s.sessions, id)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
@@ -0,0 +1,65 @@
+package session
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStore(t *testing.T) {
+	s := NewStore(NewSigner([]byte("secret")), time.Minute)
+
+	t.Run("should resume a detached session within the window", func(t *testing.T) {
+		st := s.Create("session-a", "uid-a", "/")
+		st.SetLastSeq(42)
+		token := s.Token(st)
+		s.Detach(st)
+
+		resumed, err := s.Resume(token, "uid-a")
+		if err != nil {
+			t.Fatal("unexpected error", err)
+		}
+		if resumed.ID != "session-a" || resumed.LastSeq() != 42 {
+			t.Fatal("expect session-a with last seq 42, got", resumed.ID, resumed.LastSeq())
+		}
+	})
+
+	t.Run("should reject tokens of other users or with invalid signatures", func(t *testing.T) {
+		st := s.Create("session-b", "uid-b", "/")
+		token := s.Token(st)
+
+		if _, err := s.Resume(token, "uid-a"); err != ErrNotResumable {
+			t.Error("expect ErrNotResumable, got", err)
+		}
+		if _, err := s.Resume(token+"x", "uid-b"); err != ErrInvalidToken {
+			t.Error("expect ErrInvalidToken, got", err)
+		}
+		if _, err := NewStore(NewSigner([]byte("other")), time.Minute).Resume(token, "uid-b"); err != ErrInvalidToken {
+			t.Error("expect ErrInvalidToken, got", err)
+		}
+	})
+
+	t.Run("should not resume with expired tokens", func(t *testing.T) {
+		st := s.Create("session-d", "uid-d", "/")
+		expired := s.signer.Sign(st.ID, time.Now().Add(-s.tokenLifetime()-time.Second))
+		future := s.signer.Sign(st.ID, time.Now().Add(2*maxClockSkew))
+
+		for _, token := range []string{expired, future} {
+			if _, err := s.Resume(token, "uid-d"); err != ErrNotResumable {
+				t.Error("expect ErrNotResumable, got", err)
+			}
+		}
+		if _, err := s.Resume(s.signer.Sign(st.ID, time.Now().Add(-s.window)), "uid-d"); err != nil {
+			t.Error("expect token issued a window ago to be valid until the next refresh, got", err)
+		}
+	})
+
+	t.Run("should not resume expired sessions", func(t *testing.T) {
+		st := s.Create("session-c", "uid-c", "/")
+		s.Detach(st)
+		st.detachedAt = time.Now().Add(-2 * time.Minute)
+
+		if _, err := s.Resume(s.Token(st), "uid-c"); err != ErrNotResumable {
+			t.Error("expect ErrNotResumable, got", err)
+		}
+	})
+}
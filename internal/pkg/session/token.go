@@ -0,0 +1,64 @@
+package session
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"time"
+)
+
+// ErrInvalidToken describes a resume token which is malformed or has an invalid signature
+var ErrInvalidToken = errors.New("invalid resume token")
+
+// Signer signs and verifies resume tokens with HMAC-SHA256
+type Signer struct {
+	secret []byte
+}
+
+// NewSigner creates a Signer with secret. If secret is empty, a random one is generated, meaning that
+// tokens issued will not be valid anymore after the process restarts.
+func NewSigner(secret []byte) *Signer {
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			panic(err)
+		}
+	}
+	return &Signer{secret: secret}
+}
+
+// Sign issues a token for session id at issuedAt. The issue time is signed along with id, so that tokens expire
+// on their own.
+func (s *Signer) Sign(id string, issuedAt time.Time) string {
+	b := make([]byte, 8, 8+len(id))
+	binary.BigEndian.PutUint64(b, uint64(issuedAt.UnixMilli()))
+	payload := base64.RawURLEncoding.EncodeToString(append(b, id...))
+	return payload + "." + base64.RawURLEncoding.EncodeToString(s.mac(payload))
+}
+
+// Verify verifies token and returns the session id and the time it was issued for
+func (s *Signer) Verify(token string) (string, time.Time, error) {
+	payload, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", time.Time{}, ErrInvalidToken
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(mac, s.mac(payload)) {
+		return "", time.Time{}, ErrInvalidToken
+	}
+	b, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil || len(b) < 8 {
+		return "", time.Time{}, ErrInvalidToken
+	}
+	return string(b[8:]), time.UnixMilli(int64(binary.BigEndian.Uint64(b))), nil
+}
+
+func (s *Signer) mac(payload string) []byte {
+	h := hmac.New(sha256.New, s.secret)
+	h.Write([]byte(payload))
+	return h.Sum(nil)
+}
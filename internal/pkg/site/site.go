@@ -0,0 +1,150 @@
+// Package site maps the site keys presented by clients to the sites, i.e. properties such as the developer docs or
+// the status page, they are recorded for, so that the data of every site is kept apart from the main site
+package site
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/penguin-statistics/probe/internal/pkg/messages"
+	"github.com/penguin-statistics/probe/internal/pkg/origin"
+)
+
+// Main is the ID of the main site, which clients presenting no site key are recorded for
+const Main = "main"
+
+// KeyParam is the query param of bonjour requests clients present site keys with
+const KeyParam = "s"
+
+// ErrUnknownKey is returned for site keys which are not configured
+var ErrUnknownKey = errors.New("unknown site key")
+
+// ParseMessageType parses the name of a message type clients report, e.g. NAVIGATED
+func ParseMessageType(name string) (messages.MessageType, error) {
+	t, ok := messages.MessageType_value[name]
+	// batches are unwrapped by wspool, and types from 64 on are of server messages
+	if !ok || t == int32(messages.MessageType_UNKNOWN) || t == int32(messages.MessageType_BATCH) || t >= 64 {
+		return messages.MessageType_UNKNOWN, fmt.Errorf("unknown message type %q", name)
+	}
+	return messages.MessageType(t), nil
+}
+
+// Config configures a site other than the main one
+type Config struct {
+	ID  string
+	Key string
+	// Origins are the origin rules of the origins allowed to connect to the site
+	Origins []string
+	// Messages are the message types clients of the site may report. Any type is allowed if empty.
+	Messages []messages.MessageType
+	// MessageRate and MessageBurst override the message rate limit of clients of the site if MessageRate is positive
+	MessageRate  float64
+	MessageBurst int
+}
+
+// Site is a site clients are recorded for
+type Site struct {
+	ID string
+	// Origins decides the origins allowed to connect to the site
+	Origins *origin.Policy
+	// MessageRate and MessageBurst are the message rate limit of clients of the site, if MessageRate is positive
+	MessageRate  float64
+	MessageBurst int
+
+	messages map[messages.MessageType]struct{}
+}
+
+// Allows reports whether clients of the site may report messages of type t
+func (s *Site) Allows(t messages.MessageType) bool {
+	if len(s.messages) == 0 {
+		return true
+	}
+	_, ok := s.messages[t]
+	return ok
+}
+
+// Registry resolves the sites of site keys
+type Registry struct {
+	mu    sync.RWMutex
+	main  *Site
+	sites map[string]*Site
+}
+
+// New creates a Registry of the main site, whose origins are decided by main, and of the sites of configs, whose
+// origins are decided by origins with the rules of each site
+func New(main *origin.Policy, configs []Config, origins origin.Config) (*Registry, error) {
+	r := &Registry{main: &Site{ID: Main, Origins: main}}
+	if err := r.SetConfig(configs, origins); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// SetConfig replaces the sites other than the main one. The sites in effect are kept if any config is invalid.
+// Clients connected keep the site they connected with.
+func (r *Registry) SetConfig(configs []Config, origins origin.Config) error {
+	sites := make(map[string]*Site, len(configs))
+	for _, conf := range configs {
+		o := origins
+		o.Rules = conf.Origins
+		policy, err := origin.New(o)
+		if err != nil {
+			return err
+		}
+		s := &Site{
+			ID:           conf.ID,
+			Origins:      policy,
+			MessageRate:  conf.MessageRate,
+			MessageBurst: conf.MessageBurst,
+			messages:     make(map[messages.MessageType]struct{}, len(conf.Messages)),
+		}
+		for _, t := range conf.Messages {
+			s.messages[t] = struct{}{}
+		}
+		sites[conf.Key] = s
+	}
+	r.mu.Lock()
+	r.sites = sites
+	r.mu.Unlock()
+	return nil
+}
+
+// Site returns the site of key, which is the main site if key is empty, or ErrUnknownKey
+func (r *Registry) Site(key string) (*Site, error) {
+	if key == "" {
+		return r.main, nil
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	s, ok := r.sites[key]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	return s, nil
+}
+
+// CheckOrigin checks the Origin header of websocket upgrades against the origins of the site of the upgrade,
+// e.g. as websocket.Upgrader.CheckOrigin
+func (r *Registry) CheckOrigin(req *http.Request) bool {
+	s, err := r.Site(req.URL.Query().Get(KeyParam))
+	if err != nil {
+		return false
+	}
+	return s.Origins.CheckOrigin(req)
+}
+
+// AllowOrigin checks the Origin header of CORS requests, which are allowed from the origins of any site, e.g. as
+// middleware.CORSConfig.AllowOriginFunc. Rejections are counted by the policy of the main site.
+func (r *Registry) AllowOrigin(o string) (bool, error) {
+	r.mu.RLock()
+	for _, s := range r.sites {
+		if s.Origins.Allows(o) {
+			r.mu.RUnlock()
+			return true, nil
+		}
+	}
+	r.mu.RUnlock()
+	return r.main.Origins.AllowOrigin(o)
+}
@@ -0,0 +1,102 @@
+package site
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/penguin-statistics/probe/internal/pkg/messages"
+	"github.com/penguin-statistics/probe/internal/pkg/origin"
+)
+
+func TestRegistry(t *testing.T) {
+	main, err := origin.New(origin.Config{Rules: []string{"https://penguin-stats.io"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := New(main, []Config{{
+		ID:       "docs",
+		Key:      "docs-key",
+		Origins:  []string{"https://docs.example.com"},
+		Messages: []messages.MessageType{messages.MessageType_NAVIGATED},
+	}}, origin.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should resolve sites by their keys", func(t *testing.T) {
+		for key, expected := range map[string]string{"": Main, "docs-key": "docs", "unknown": ""} {
+			s, err := r.Site(key)
+			if expected == "" {
+				if err != ErrUnknownKey {
+					t.Error("expect key", key, "unknown, got", s, err)
+				}
+				continue
+			}
+			if err != nil || s.ID != expected {
+				t.Error("expect key", key, "of site", expected, "got", s, err)
+			}
+		}
+	})
+
+	t.Run("should allow the message types of the site", func(t *testing.T) {
+		s, _ := r.Site("docs-key")
+		if !s.Allows(messages.MessageType_NAVIGATED) || s.Allows(messages.MessageType_ENTERED_SEARCH_RESULT) {
+			t.Error("expect navigations allowed only")
+		}
+		s, _ = r.Site("")
+		if !s.Allows(messages.MessageType_ENTERED_SEARCH_RESULT) {
+			t.Error("expect any message type allowed for the main site")
+		}
+	})
+
+	t.Run("should check origins against the site of the upgrade", func(t *testing.T) {
+		for _, c := range []struct {
+			target, origin string
+			expected       bool
+		}{
+			{"/", "https://penguin-stats.io", true},
+			{"/", "https://docs.example.com", false},
+			{"/?s=docs-key", "https://docs.example.com", true},
+			{"/?s=docs-key", "https://penguin-stats.io", false},
+			{"/?s=unknown", "https://docs.example.com", false},
+		} {
+			req, err := http.NewRequest(http.MethodGet, c.target, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Origin", c.origin)
+			if actual := r.CheckOrigin(req); actual != c.expected {
+				t.Error("expect upgrade to", c.target, "from", c.origin, "allowed", c.expected, "got", actual)
+			}
+		}
+	})
+
+	t.Run("should allow cors requests from any site", func(t *testing.T) {
+		for o, expected := range map[string]bool{
+			"https://penguin-stats.io": true,
+			"https://docs.example.com": true,
+			"https://evil.example.com": false,
+		} {
+			if actual, _ := r.AllowOrigin(o); actual != expected {
+				t.Error("expect cors from", o, "allowed", expected, "got", actual)
+			}
+		}
+	})
+
+	t.Run("should keep the sites in effect on invalid configs", func(t *testing.T) {
+		if err := r.SetConfig([]Config{{ID: "status", Key: "status-key", Origins: []string{"https://status.example.com:port"}}}, origin.Config{}); err == nil {
+			t.Error("expect invalid origin rejected")
+		}
+		if s, err := r.Site("docs-key"); err != nil || s.ID != "docs" {
+			t.Error("expect site kept, got", s, err)
+		}
+	})
+
+	t.Run("should parse the message types clients report", func(t *testing.T) {
+		for name, ok := range map[string]bool{"NAVIGATED": true, "BATCH": false, "UNKNOWN": false, "SERVER_ACK": false, "navigated": false} {
+			if _, err := ParseMessageType(name); (err == nil) != ok {
+				t.Error("expect", name, "parsed", ok, "got", err)
+			}
+		}
+	})
+}
@@ -0,0 +1,137 @@
+// Package tracing sets OpenTelemetry tracing up and provides helpers to instrument probe with spans
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/penguin-statistics/probe/internal/pkg/version"
+)
+
+// Exporters of spans
+const (
+	// ExporterNone disables tracing
+	ExporterNone = "none"
+	// ExporterOTLP exports spans to an OTLP/HTTP collector
+	ExporterOTLP = "otlp"
+	// ExporterStdout writes spans as JSON to stdout or a file, e.g. for local runs
+	ExporterStdout = "stdout"
+)
+
+// Exporters are the exporters Setup accepts
+var Exporters = []string{ExporterNone, ExporterOTLP, ExporterStdout}
+
+// Config configures the export of spans
+type Config struct {
+	// Exporter is one of Exporters
+	Exporter string
+	// Endpoint is the host:port of the OTLP/HTTP collector. Empty uses the OTEL_EXPORTER_OTLP_* environment variables.
+	Endpoint string
+	// Insecure sends spans to the collector over plain http
+	Insecure bool
+	// Headers are sent along with spans to the collector, e.g. for authentication
+	Headers map[string]string
+	// File is the file spans are appended to by the stdout exporter. Empty writes to stdout.
+	File string
+	// SampleRatio is the ratio of traces sampled, unless the caller has sampled the trace already
+	SampleRatio float64
+	// Node identifies the instance in the spans exported
+	Node string
+}
+
+// Setup installs the global tracer provider described by conf. The function returned flushes pending spans
+// and stops the export, and shall be called on shutdown.
+func Setup(conf Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var closer io.Closer
+	switch conf.Exporter {
+	case ExporterNone, "":
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		opts := []otlptracehttp.Option{}
+		if conf.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(conf.Endpoint))
+		}
+		if conf.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		if len(conf.Headers) > 0 {
+			opts = append(opts, otlptracehttp.WithHeaders(conf.Headers))
+		}
+		e, err := otlptracehttp.New(context.Background(), opts...)
+		if err != nil {
+			return nil, err
+		}
+		exporter = e
+	case ExporterStdout:
+		var w io.Writer = os.Stdout
+		if conf.File != "" {
+			f, err := os.OpenFile(conf.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+			if err != nil {
+				return nil, err
+			}
+			w, closer = f, f
+		}
+		e, err := stdouttrace.New(stdouttrace.WithWriter(w))
+		if err != nil {
+			return nil, err
+		}
+		exporter = e
+	default:
+		return nil, fmt.Errorf("unknown exporter %q", conf.Exporter)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName("probe"),
+		semconv.ServiceVersion(version.Version),
+		semconv.ServiceInstanceID(conf.Node),
+	))
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(conf.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if closer != nil {
+			if cerr := closer.Close(); err == nil {
+				err = cerr
+			}
+		}
+		return err
+	}, nil
+}
+
+// Tracer returns the tracer of the instrumented package named name from the global tracer provider
+func Tracer(name string) trace.Tracer {
+	return otel.Tracer("github.com/penguin-statistics/probe/" + name)
+}
+
+// End records err, if any, on span and ends it
+func End(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, context.Canceled) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
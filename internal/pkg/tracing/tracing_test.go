@@ -0,0 +1,40 @@
+package tracing
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+)
+
+func TestSetup(t *testing.T) {
+	t.Run("should write spans to file with the stdout exporter", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "spans.jsonl")
+		shutdown, err := Setup(Config{Exporter: ExporterStdout, File: file, SampleRatio: 1, Node: "probe-1"})
+		if err != nil {
+			t.Fatal("unexpected error", err)
+		}
+		_, span := otel.Tracer("test").Start(context.Background(), "traced")
+		span.End()
+		if err := shutdown(context.Background()); err != nil {
+			t.Fatal("unexpected error on shutdown", err)
+		}
+
+		b, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(b), `"Name":"traced"`) || !strings.Contains(string(b), "probe-1") {
+			t.Error("expect span written along with the node, got", string(b))
+		}
+	})
+
+	t.Run("should reject unknown exporters", func(t *testing.T) {
+		if _, err := Setup(Config{Exporter: "zipkin"}); err == nil {
+			t.Error("expect error")
+		}
+	})
+}
@@ -0,0 +1,122 @@
+// Package useragent parses User-Agent strings into coarse dimensions: browser family and major version, OS family
+// and device class. The dimensions are bounded, so that they are fit to be stored and labeled in metrics.
+package useragent
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Browser families
+const (
+	BrowserChrome          = "chrome"
+	BrowserSafari          = "safari"
+	BrowserFirefox         = "firefox"
+	BrowserEdge            = "edge"
+	BrowserOpera           = "opera"
+	BrowserSamsungInternet = "samsung_internet"
+	BrowserWeChat          = "wechat"
+	BrowserQQ              = "qq"
+	BrowserUC              = "uc"
+	BrowserOther           = "other"
+)
+
+// OS families
+const (
+	OSWindows  = "windows"
+	OSMacOS    = "macos"
+	OSIOS      = "ios"
+	OSAndroid  = "android"
+	OSChromeOS = "chromeos"
+	OSLinux    = "linux"
+	OSOther    = "other"
+)
+
+// Device classes
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	// DeviceBot is never parsed, but set by callers on traffic classified as bots, e.g. by botdetect
+	DeviceBot = "bot"
+)
+
+// UserAgent is a parsed User-Agent
+type UserAgent struct {
+	Browser string
+	// BrowserVersion is the major version of the browser, or 0 if unknown
+	BrowserVersion uint16
+	OS             string
+	Device         string
+}
+
+// browsers are matched in order, as most browsers claim to be Chrome or Safari as well. The version is the first
+// submatch of the first pattern matched.
+var browsers = []struct {
+	family   string
+	patterns []*regexp.Regexp
+}{
+	{BrowserWeChat, []*regexp.Regexp{regexp.MustCompile(`MicroMessenger/(\d+)`)}},
+	{BrowserQQ, []*regexp.Regexp{regexp.MustCompile(`M?QQBrowser/(\d+)`)}},
+	{BrowserUC, []*regexp.Regexp{regexp.MustCompile(`UCBrowser/(\d+)`)}},
+	{BrowserSamsungInternet, []*regexp.Regexp{regexp.MustCompile(`SamsungBrowser/(\d+)`)}},
+	{BrowserEdge, []*regexp.Regexp{regexp.MustCompile(`Edg(?:e|A|iOS)?/(\d+)`)}},
+	{BrowserOpera, []*regexp.Regexp{regexp.MustCompile(`OP(?:R|T|iOS)/(\d+)`), regexp.MustCompile(`Opera.*Version/(\d+)`)}},
+	{BrowserFirefox, []*regexp.Regexp{regexp.MustCompile(`(?:Firefox|FxiOS)/(\d+)`)}},
+	{BrowserChrome, []*regexp.Regexp{regexp.MustCompile(`(?:Chrome|CriOS)/(\d+)`)}},
+	{BrowserSafari, []*regexp.Regexp{regexp.MustCompile(`Version/(\d+).*Safari/`)}},
+}
+
+// Parse parses ua. Bots are left to botdetect, so their device class is the one they claim.
+func Parse(ua string) UserAgent {
+	parsed := UserAgent{Browser: BrowserOther, OS: OSOther, Device: DeviceDesktop}
+	for _, b := range browsers {
+		if family, version, ok := match(ua, b.family, b.patterns); ok {
+			parsed.Browser, parsed.BrowserVersion = family, version
+			break
+		}
+	}
+
+	switch {
+	case strings.Contains(ua, "iPad"):
+		parsed.OS, parsed.Device = OSIOS, DeviceTablet
+	case strings.Contains(ua, "iPhone") || strings.Contains(ua, "iPod"):
+		parsed.OS, parsed.Device = OSIOS, DeviceMobile
+	case strings.Contains(ua, "Android"):
+		// Android tablets omit Mobile from their User-Agents
+		parsed.OS, parsed.Device = OSAndroid, DeviceTablet
+		if strings.Contains(ua, "Mobile") {
+			parsed.Device = DeviceMobile
+		}
+	case strings.Contains(ua, "Windows"):
+		parsed.OS = OSWindows
+		if strings.Contains(ua, "Windows Phone") {
+			parsed.OS, parsed.Device = OSOther, DeviceMobile
+		}
+	case strings.Contains(ua, "CrOS"):
+		parsed.OS = OSChromeOS
+	case strings.Contains(ua, "Macintosh") || strings.Contains(ua, "Mac OS X"):
+		parsed.OS = OSMacOS
+	case strings.Contains(ua, "Linux"):
+		parsed.OS = OSLinux
+	}
+	return parsed
+}
+
+// match matches ua against the patterns of a browser family
+func match(ua, family string, patterns []*regexp.Regexp) (string, uint16, bool) {
+	for _, pattern := range patterns {
+		m := pattern.FindStringSubmatch(ua)
+		if m == nil {
+			continue
+		}
+		var version uint16
+		if len(m) > 1 {
+			v, _ := strconv.ParseUint(m[1], 10, 16)
+			version = uint16(v)
+		}
+		return family, version, true
+	}
+	return "", 0, false
+}
@@ -0,0 +1,44 @@
+package useragent
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	for ua, expected := range map[string]UserAgent{
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36": {
+			BrowserChrome, 120, OSWindows, DeviceDesktop,
+		},
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 Edg/120.0.2210.91": {
+			BrowserEdge, 120, OSWindows, DeviceDesktop,
+		},
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Mobile/15E148 Safari/604.1": {
+			BrowserSafari, 17, OSIOS, DeviceMobile,
+		},
+		"Mozilla/5.0 (iPad; CPU OS 16_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/119.0.6045.169 Mobile/15E148 Safari/604.1": {
+			BrowserChrome, 119, OSIOS, DeviceTablet,
+		},
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10.15; rv:121.0) Gecko/20100101 Firefox/121.0": {
+			BrowserFirefox, 121, OSMacOS, DeviceDesktop,
+		},
+		"Mozilla/5.0 (Linux; Android 13; SM-S918B) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/23.0 Chrome/115.0.0.0 Mobile Safari/537.36": {
+			BrowserSamsungInternet, 23, OSAndroid, DeviceMobile,
+		},
+		"Mozilla/5.0 (Linux; Android 13; SM-X700) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36": {
+			BrowserChrome, 120, OSAndroid, DeviceTablet,
+		},
+		"Mozilla/5.0 (Linux; Android 12; V2049A) AppleWebKit/537.36 (KHTML, like Gecko) Version/4.0 Chrome/86.0.4240.99 XWEB/4343 MMWEBSDK/20221011 Mobile Safari/537.36 MMWEBID/1234 MicroMessenger/8.0.30.2260(0x28001E3B) WeChat/arm64 Weixin NetType/WIFI Language/zh_CN ABI/arm64": {
+			BrowserWeChat, 8, OSAndroid, DeviceMobile,
+		},
+		"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) HeadlessChrome/120.0.0.0 Safari/537.36": {
+			BrowserChrome, 120, OSLinux, DeviceDesktop,
+		},
+		"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)": {
+			BrowserOther, 0, OSOther, DeviceDesktop,
+		},
+		"curl/8.4.0": {BrowserOther, 0, OSOther, DeviceDesktop},
+		"":           {BrowserOther, 0, OSOther, DeviceDesktop},
+	} {
+		if actual := Parse(ua); actual != expected {
+			t.Errorf("expect %q parsed as %+v, got %+v", ua, expected, actual)
+		}
+	}
+}
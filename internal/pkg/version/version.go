@@ -0,0 +1,54 @@
+// Package version describes the build of probe
+package version
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// Version, Commit and BuildDate are set at build time with
+//
+//	-ldflags "-X github.com/penguin-statistics/probe/internal/pkg/version.Version=v1.2.3 ..."
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildDate = ""
+)
+
+func init() {
+	if Commit != "" {
+		return
+	}
+	// fall back to the vcs info embedded by the go toolchain
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return
+	}
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			Commit = setting.Value
+		case "vcs.time":
+			if BuildDate == "" {
+				BuildDate = setting.Value
+			}
+		}
+	}
+}
+
+// String describes the build in a single line
+func String() string {
+	commit := Commit
+	if len(commit) > 12 {
+		commit = commit[:12]
+	}
+	if commit == "" {
+		commit = "unknown"
+	}
+	date := BuildDate
+	if date == "" {
+		date = "unknown"
+	}
+	return fmt.Sprintf("probe %s (commit %s, built %s, %s %s/%s)", Version, commit, date, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
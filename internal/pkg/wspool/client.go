@@ -2,13 +2,17 @@ package wspool
 
 import (
 	"errors"
+	"math"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
-	"go.uber.org/ratelimit"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
 	"google.golang.org/protobuf/proto"
 
+	"github.com/penguin-statistics/probe/internal/pkg/logger"
 	"github.com/penguin-statistics/probe/internal/pkg/messages"
 )
 
@@ -25,11 +29,32 @@ const (
 	// Maximum message size allowed from peer.
 	maxMessageSize = 512
 
-	// Maximum messages per second
-	maxRPS = 3
+	// Maximum messages allowed in a single Batch frame
+	maxBatchSize = 16
 )
 
-var ErrInvalidMessageType = errors.New("invalid message type")
+var (
+	ErrInvalidMessageType = errors.New("invalid message type")
+
+	errInvalidSkeleton = errors.New("invalid skeleton")
+)
+
+// Reasons of invalid messages, as recorded in metrics
+const (
+	// StrikeFrameType is a frame which is not a binary frame
+	StrikeFrameType = "frame_type"
+	// StrikeDecode is a message which can't be unmarshalled
+	StrikeDecode = "decode"
+	// StrikeUnknownType is a message with an unknown message type
+	StrikeUnknownType = "unknown_type"
+	// StrikeValidation is a message which has been unmarshalled but failed the validation
+	StrikeValidation = "validation"
+	// StrikeDisallowedType is a message of a type the client is not allowed to report, e.g. by its site
+	StrikeDisallowedType = "disallowed_type"
+)
+
+// disconnectRateLimit is the reason of clients disconnected for exceeding the rate limit, as recorded in metrics
+const disconnectRateLimit = "rate_limit"
 
 // ClientRequest is the skeleton-unmarshalled client side request
 type ClientRequest struct {
@@ -37,31 +62,73 @@ type ClientRequest struct {
 	Body     []byte
 }
 
+// lastClientID is the id of the last client created
+var lastClientID uint64
+
 // Client is a intermediate module to connect user-side websocket client with hub
 type Client struct {
+	id             uint64
 	Hub            *Hub
 	Conn           *websocket.Conn
+	Protocol       *Protocol
+	Platform       string
 	Received       chan ClientRequest
 	Send           chan *websocket.PreparedMessage
 	Closed         chan struct{}
 	GoingAwayClose chan struct{}
-	rateLimiter    ratelimit.Limiter
-	closeonce      sync.Once
+	// Logger logs the events of the client. It defaults to the logger of the Hub and may be replaced
+	// with one carrying fields of the connection before Read and Write are called.
+	Logger        *logrus.Entry
+	rateLimiter   *rate.Limiter
+	ownLimit      bool
+	throttleScore score
+	closeonce     sync.Once
+	goawayonce    sync.Once
+	lastSeq       uint32
+	kick          chan []byte
 
-	InvalidCount int
+	strikemu     sync.Mutex
+	invalidCount int
+	invalidScore score
+	kicked       bool
 }
 
-func NewClient(hub *Hub, conn *websocket.Conn) *Client {
+// NewClient creates a Client on conn which speaks the negotiated protocol. platform is used to partition metrics.
+func NewClient(hub *Hub, conn *websocket.Conn, protocol *Protocol, platform string) *Client {
 	return &Client{
+		id:             atomic.AddUint64(&lastClientID, 1),
 		Hub:            hub,
 		Conn:           conn,
+		Protocol:       protocol,
+		Platform:       platform,
 		Received:       make(chan ClientRequest, 8),
 		Send:           make(chan *websocket.PreparedMessage, 8),
 		Closed:         make(chan struct{}),
 		GoingAwayClose: make(chan struct{}),
-		rateLimiter:    ratelimit.New(maxRPS),
-		InvalidCount:   0,
+		Logger:         hub.logger,
+		rateLimiter:    rate.NewLimiter(messageLimit(hub.conf())),
+		kick:           make(chan []byte, 1),
+	}
+}
+
+// messageLimit returns the per-client rate limit of config
+func messageLimit(config Config) (rate.Limit, int) {
+	if config.MessageRate <= 0 {
+		return rate.Inf, 1
+	}
+	burst := config.MessageBurst
+	if burst < 1 {
+		burst = 1
 	}
+	return rate.Limit(config.MessageRate), burst
+}
+
+// SetMessageLimit overrides the message rate limit of the hub for the client, e.g. of clients of sites limited on
+// their own. The override is kept when the limits of the hub change. It shall be called before the client is
+// registered.
+func (c *Client) SetMessageLimit(messageRate float64, messageBurst int) {
+	c.ownLimit = true
+	c.rateLimiter = rate.NewLimiter(messageLimit(Config{MessageRate: messageRate, MessageBurst: messageBurst}))
 }
 
 // Read block-reads from the underlying websocket.Conn. It also parses skeleton for further unmarshalling
@@ -74,108 +141,337 @@ func (c *Client) Read() {
 	c.Conn.SetReadLimit(maxMessageSize)
 	c.Conn.SetReadDeadline(time.Now().Add(pongWait))
 	c.Conn.SetPongHandler(func(appData string) error {
-		c.Hub.logger.Traceln("got pong from client")
+		c.Logger.Traceln("got pong from client")
 		c.Conn.SetReadDeadline(time.Now().Add(pongWait))
 		return nil
 	})
 
 	for {
-		c.rateLimiter.Take()
 		s, p, err := c.readSkeleton()
-		if err != nil {
+		if err == ErrInvalidMessageType {
+			c.Strike(StrikeFrameType)
+			continue
+		} else if err == errInvalidSkeleton {
+			c.Strike(StrikeDecode)
+			continue
+		} else if err != nil {
 			break
 		}
-		typ := s.Meta.Type
+
+		c.receive(s, p)
+	}
+}
+
+// receive forwards the frame p of skeleton s to Received and acknowledges it, unless it exceeds the rate limit.
+// Batch frames are charged for every message in them, so that batching does not raise the rate limit, and are
+// dropped as a whole once the tokens run out.
+func (c *Client) receive(s *messages.Skeleton, p []byte) {
+	var batch *messages.Batch
+	cost := 1
+	isBatch := s.GetMeta().GetType() == messages.MessageType_BATCH && c.Protocol.Supports(CapabilityBatch)
+	if isBatch {
+		// invalid batches are struck but not acknowledged, so that clients do not take them as accepted
+		if batch = c.decodeBatch(p); batch == nil {
+			return
+		}
+		if n := len(batch.Messages); n > cost {
+			cost = n
+		}
+	}
+
+	if c.throttle(s.GetMeta(), cost) {
+		return
+	}
+	if seq := s.GetMeta().GetSeq(); seq != 0 && c.Protocol.Supports(CapabilitySeqACK) {
+		// a retransmission of a message which has already been received, probably before a reconnect.
+		// acknowledge it again but do not process it twice
+		if seq <= c.LastSeq() {
+			c.ack(s.GetMeta())
+			return
+		}
+		atomic.StoreUint32(&c.lastSeq, seq)
+	}
+
+	if !isBatch {
 		c.Received <- ClientRequest{
 			Skeleton: s,
 			Body:     p,
 		}
+	} else {
+		c.receiveBatch(batch)
+	}
+
+	c.ack(s.GetMeta())
+}
 
-		c.ack(typ)
+// decodeBatch unmarshals a Batch frame. Invalid batches are struck and nil is returned.
+func (c *Client) decodeBatch(p []byte) *messages.Batch {
+	var batch messages.Batch
+	if err := proto.Unmarshal(p, &batch); err != nil || len(batch.Messages) > maxBatchSize {
+		if l, ok := logger.Sample(c.Logger, "wspool: invalid batch"); ok {
+			l.Debugln("invalid batch message received", err)
+		}
+		c.Strike(StrikeDecode)
+		return nil
 	}
+	return &batch
 }
 
-func (c *Client) ack(messageType messages.MessageType) error {
-	m := messages.ServerACK{Type: messageType}
-	b, err := proto.Marshal(&m)
+// receiveBatch forwards each message in batch as if they were sent separately
+func (c *Client) receiveBatch(batch *messages.Batch) {
+	for _, m := range batch.Messages {
+		var skeleton messages.Skeleton
+		// nested batches are not allowed
+		if err := proto.Unmarshal(m, &skeleton); err != nil || skeleton.GetMeta().GetType() == messages.MessageType_BATCH {
+			c.Logger.Debugln("invalid message in batch received", err)
+			c.Strike(StrikeDecode)
+			continue
+		}
+		c.Received <- ClientRequest{
+			Skeleton: &skeleton,
+			Body:     m,
+		}
+	}
+}
+
+// LastSeq returns the last sequence number received from a client speaking CapabilitySeqACK
+func (c *Client) LastSeq() uint32 {
+	return atomic.LoadUint32(&c.lastSeq)
+}
+
+// SetLastSeq restores the last sequence number received, e.g. from a resumed session.
+// It shall be called before Read.
+func (c *Client) SetLastSeq(seq uint32) {
+	atomic.StoreUint32(&c.lastSeq, seq)
+}
+
+func (c *Client) ack(meta *messages.Meta) error {
+	m := messages.ServerACK{Type: meta.GetType()}
+	if c.Protocol.Supports(CapabilitySeqACK) {
+		m.Seq = meta.GetSeq()
+	}
+	return c.SendMessage(&m)
+}
+
+// SendMessage marshals m and queues it to be sent to the client
+func (c *Client) SendMessage(m proto.Message) error {
+	b, err := proto.Marshal(m)
 	if err != nil {
-		c.Hub.logger.Debugln("error occurred when marshalling ack message", err)
+		c.Logger.Debugln("error occurred when marshalling message", err)
 		return err
 	}
 	p, err := websocket.NewPreparedMessage(websocket.BinaryMessage, b)
 	if err != nil {
-		c.Hub.logger.Debugln("error occurred when preparing ack message", err)
+		c.Logger.Debugln("error occurred when preparing message", err)
 		return err
 	}
-	c.Send <- p
+	c.enqueue(p)
 	return nil
 }
 
+// enqueue queues p to be sent, unless the client has been closed in the meantime
+func (c *Client) enqueue(p *websocket.PreparedMessage) {
+	select {
+	case c.Send <- p:
+	case <-c.Closed:
+	}
+}
+
+// InvalidCount returns the total amount of invalid messages the client has sent
+func (c *Client) InvalidCount() int {
+	c.strikemu.Lock()
+	defer c.strikemu.Unlock()
+	return c.invalidCount
+}
+
+// Strike records an invalid message sent by the client for reason and informs the client about it.
+// Strikes are scored with an exponential decay; once the score crosses the threshold of the Hub,
+// ErrTooManyInvalidMessages is sent and the connection is closed with a policy violation.
+// It returns whether the client has been kicked.
+func (c *Client) Strike(reason string) bool {
+	c.strikemu.Lock()
+	c.invalidCount++
+	config := c.Hub.conf()
+	exceeded := c.invalidScore.add(time.Now(), config.InvalidHalfLife, config.InvalidThreshold)
+	c.strikemu.Unlock()
+
+	c.Hub.metrics().IncInvalidMessage(reason)
+	if !exceeded {
+		c.enqueue(ErrInvalidWsMessage)
+		return false
+	}
+
+	if c.kickWith(ErrTooManyInvalidMessages, "too many invalid messages") {
+		c.Logger.Debugln("client kicked for sending too many invalid messages, last reason:", reason)
+		c.Hub.metrics().IncPolicyDisconnect(reason)
+	}
+	return true
+}
+
+// throttle reports whether a frame of n messages shall be dropped as it exceeds the rate limit. Dropped frames are
+// answered with a rate-limited ACK carrying a retry-after hint, and clients which keep exceeding the limit get
+// disconnected.
+func (c *Client) throttle(meta *messages.Meta, n int) bool {
+	now := time.Now()
+	r := c.rateLimiter.ReserveN(now, n)
+	retryAfter := r.DelayFrom(now)
+	if r.OK() && retryAfter == 0 {
+		return false
+	}
+	r.CancelAt(now)
+	if !r.OK() {
+		// frames of more messages than the burst are never admitted: hint the time to refill n tokens regardless
+		retryAfter = time.Duration(float64(n) / float64(c.rateLimiter.Limit()) * float64(time.Second))
+	}
+
+	c.Hub.metrics().IncThrottled(c.Platform)
+	config := c.Hub.conf()
+	if c.throttleScore.add(time.Now(), config.ThrottleHalfLife, config.ThrottleThreshold) {
+		if c.kickWith(ErrRateLimitExceeded, "rate limit exceeded") {
+			c.Logger.Debugln("client kicked for exceeding the rate limit")
+			c.Hub.metrics().IncPolicyDisconnect(disconnectRateLimit)
+		}
+		return true
+	}
+
+	m := &messages.ServerACK{
+		Type:       meta.GetType(),
+		Message:    "rate limited",
+		RetryAfter: uint32(math.Ceil(float64(retryAfter) / float64(time.Millisecond))),
+	}
+	if c.Protocol.Supports(CapabilitySeqACK) {
+		m.Seq = meta.GetSeq()
+	}
+	b, err := proto.Marshal(m)
+	if err != nil {
+		return true
+	}
+	p, err := websocket.NewPreparedMessage(websocket.BinaryMessage, b)
+	if err != nil {
+		return true
+	}
+	// never wait for the client to catch up on rate-limited ACKs
+	select {
+	case c.Send <- p:
+	default:
+	}
+	return true
+}
+
+// kickWith sends m and closes the connection with a policy violation. It returns false if the client has
+// been kicked already.
+func (c *Client) kickWith(m *websocket.PreparedMessage, reason string) bool {
+	c.strikemu.Lock()
+	if c.kicked {
+		c.strikemu.Unlock()
+		return false
+	}
+	c.kicked = true
+	c.strikemu.Unlock()
+
+	c.enqueue(m)
+	c.kick <- websocket.FormatCloseMessage(websocket.ClosePolicyViolation, reason)
+	return true
+}
+
 func (c *Client) readSkeleton() (s *messages.Skeleton, p []byte, err error) {
 	typ, p, err := c.Conn.ReadMessage()
 	if err != nil {
 		if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
-			c.Hub.logger.Debugln("error occurred when reading message", err)
+			c.Logger.Debugln("error occurred when reading message", err)
 		}
 		return &messages.Skeleton{}, nil, err
 	}
 	if typ != websocket.BinaryMessage && typ != websocket.PongMessage {
-		c.Hub.logger.Debugln("unexpected message type that is not a BinaryMessage type", typ)
+		if l, ok := logger.Sample(c.Logger, "wspool: unexpected frame type"); ok {
+			l.Debugln("unexpected message type that is not a BinaryMessage type", typ)
+		}
 		return &messages.Skeleton{}, nil, ErrInvalidMessageType
 	}
 
 	var skeleton messages.Skeleton
 	err = proto.Unmarshal(p, &skeleton)
 	if err != nil {
-		c.Hub.logger.Error("message either is not having common header or can't be unmarshalled to Skeleton", err)
-		return &messages.Skeleton{}, nil, err
+		if l, ok := logger.Sample(c.Logger, "wspool: invalid skeleton"); ok {
+			l.Debugln("message either is not having common header or can't be unmarshalled to Skeleton", err)
+		}
+		return &messages.Skeleton{}, nil, errInvalidSkeleton
 	}
-	c.Hub.logger.Traceln("unmarshalled skeleton as", skeleton.String())
+	c.Logger.Traceln("unmarshalled skeleton as", skeleton.String())
 
 	return &skeleton, p, nil
 }
 
+// GoAway asks the client to reconnect elsewhere: messages queued are flushed, then the connection is closed
+// with CloseGoingAway. It is safe to be called multiple times.
+func (c *Client) GoAway() {
+	c.goawayonce.Do(func() {
+		close(c.GoingAwayClose)
+	})
+}
+
 func (c *Client) Close() {
 	c.closeonce.Do(func() {
-		c.Hub.Unregister <- c
+		c.Hub.Unregister(c)
 		close(c.Closed)
 		c.Conn.Close()
 	})
 }
 
 func (c *Client) Write() {
-	c.Hub.logger.Traceln("starting ping ticker with period of", pingPeriod)
+	c.Logger.Traceln("starting ping ticker with period of", pingPeriod)
 	pingTicker := time.NewTicker(pingPeriod)
 	defer func() {
-		c.Hub.logger.Traceln("stopping writer")
+		c.Logger.Traceln("stopping writer")
 		pingTicker.Stop()
 		c.Close()
 	}()
 	for {
 		select {
 		case message := <-c.Send:
-			c.Hub.logger.Traceln("tries to send ws data", message)
+			c.Logger.Traceln("tries to send ws data", message)
 			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
 
 			err := c.Conn.WritePreparedMessage(message)
 			if err != nil {
-				c.Hub.logger.Debugln("failed to send message", err)
+				c.Logger.Debugln("failed to send message", err)
 				return
 			}
-			c.Hub.logger.Traceln("ws data sent")
+			c.Logger.Traceln("ws data sent")
 		case <-pingTicker.C:
-			c.Hub.logger.Traceln("time's up: sending ping to client")
+			c.Logger.Traceln("time's up: sending ping to client")
 
 			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
 			err := c.Conn.WriteMessage(websocket.PingMessage, nil)
 			if err != nil {
-				c.Hub.logger.Debugln("failed to write ping to client. client probably already gone. disconnecting")
+				c.Logger.Debugln("failed to write ping to client. client probably already gone. disconnecting")
+				return
+			}
+		case m := <-c.kick:
+			// flush messages queued before the client got kicked, so that it knows why
+			if c.flush() != nil {
 				return
 			}
+			c.Conn.WriteControl(websocket.CloseMessage, m, time.Now().Add(writeWait))
+			return
 		case <-c.GoingAwayClose:
-			c.Hub.logger.Traceln("server is going away. sending close message to client")
+			c.Logger.Traceln("server is going away. sending close message to client")
+			if c.flush() != nil {
+				return
+			}
 			c.Conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "server is going away"), time.Now().Add(writeWait))
 			return
 		}
 	}
 }
+
+// flush writes messages currently queued in Send
+func (c *Client) flush() error {
+	for len(c.Send) > 0 {
+		c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+		if err := c.Conn.WritePreparedMessage(<-c.Send); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package wspool
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/penguin-statistics/probe/internal/pkg/messages"
+)
+
+func TestStrike(t *testing.T) {
+	t.Run("should kick client once the threshold is crossed", func(t *testing.T) {
+		c := NewClient(NewHub(Config{InvalidThreshold: 3, InvalidHalfLife: time.Hour}), nil, nil, "web")
+		for i := 0; i < 2; i++ {
+			if c.Strike(StrikeDecode) {
+				t.Fatal("expect client not kicked on strike", i+1)
+			}
+		}
+		if !c.Strike(StrikeUnknownType) {
+			t.Fatal("expect client kicked")
+		}
+		if c.InvalidCount() != 3 {
+			t.Error("expect invalid count 3, got", c.InvalidCount())
+		}
+		if len(c.kick) != 1 {
+			t.Error("expect close message queued")
+		}
+		for _, expected := range []interface{}{ErrInvalidWsMessage, ErrInvalidWsMessage, ErrTooManyInvalidMessages} {
+			if m := <-c.Send; m != expected {
+				t.Error("unexpected message queued")
+			}
+		}
+	})
+
+	t.Run("should decay the score over time", func(t *testing.T) {
+		c := NewClient(NewHub(Config{InvalidThreshold: 2, InvalidHalfLife: time.Millisecond}), nil, nil, "web")
+		for i := 0; i < 5; i++ {
+			if c.Strike(StrikeDecode) {
+				t.Fatal("expect client not kicked on strike", i+1)
+			}
+			time.Sleep(10 * time.Millisecond)
+			<-c.Send
+		}
+	})
+}
+
+func TestThrottle(t *testing.T) {
+	c := NewClient(NewHub(Config{MessageRate: 1, MessageBurst: 2, ThrottleThreshold: 3, ThrottleHalfLife: time.Hour}), nil, nil, "web")
+	for i := 0; i < 2; i++ {
+		if c.throttle(nil, 1) {
+			t.Fatal("expect burst to be allowed")
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if !c.throttle(nil, 1) {
+			t.Fatal("expect message to be throttled")
+		}
+		if len(c.kick) != 0 {
+			t.Fatal("expect client not kicked on throttle", i+1)
+		}
+	}
+	if !c.throttle(nil, 1) || len(c.kick) != 1 {
+		t.Fatal("expect client kicked on sustained abuse")
+	}
+}
+
+func TestThrottleReload(t *testing.T) {
+	hub := NewHub(Config{})
+	c := NewClient(hub, nil, nil, "web")
+	hub.Register(c)
+	for i := 0; i < 100; i++ {
+		if c.throttle(nil, 1) {
+			t.Fatal("expect messages not to be throttled without a rate limit")
+		}
+	}
+
+	hub.SetConfig(Config{MessageRate: 1, MessageBurst: 1, ThrottleThreshold: 10, ThrottleHalfLife: time.Hour})
+	if c.throttle(nil, 1) || !c.throttle(nil, 1) {
+		t.Fatal("expect rate limit to take effect on registered clients")
+	}
+}
+
+func TestThrottleBatch(t *testing.T) {
+	protocol, err := NegotiateProtocol([]string{"probe.v2+pb"}, 0, "batch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newClient := func() *Client {
+		c := NewClient(NewHub(Config{MessageRate: 1, MessageBurst: 16, ThrottleThreshold: 10, ThrottleHalfLife: time.Hour}), nil, protocol, "web")
+		c.Received = make(chan ClientRequest, 64)
+		c.Send = make(chan *websocket.PreparedMessage, 64)
+		return c
+	}
+	navigated := &messages.Skeleton{Meta: &messages.Meta{Type: messages.MessageType_NAVIGATED}}
+	single, err := proto.Marshal(navigated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch := &messages.Batch{Meta: &messages.Meta{Type: messages.MessageType_BATCH}}
+	for i := 0; i < maxBatchSize; i++ {
+		batch.Messages = append(batch.Messages, single)
+	}
+	p, err := proto.Marshal(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	batched := &messages.Skeleton{Meta: batch.Meta}
+
+	t.Run("should limit a batch like the single frames in it", func(t *testing.T) {
+		singles, batches := newClient(), newClient()
+		for i := 0; i < maxBatchSize+1; i++ {
+			singles.receive(navigated, single)
+		}
+		batches.receive(batched, p)
+		batches.receive(navigated, single)
+		if len(singles.Received) != maxBatchSize || len(batches.Received) != maxBatchSize {
+			t.Error("expect", maxBatchSize, "messages received either way, got", len(singles.Received), "and", len(batches.Received))
+		}
+	})
+
+	t.Run("should drop a batch as a whole once the tokens run out", func(t *testing.T) {
+		c := newClient()
+		c.receive(navigated, single)
+		c.receive(batched, p)
+		if len(c.Received) != 1 {
+			t.Error("expect batch exceeding the tokens left dropped, got", len(c.Received), "messages received")
+		}
+	})
+
+	t.Run("should strike an invalid batch without acknowledging it", func(t *testing.T) {
+		c := newClient()
+		c.receive(batched, []byte{0xff})
+		if len(c.Received) != 0 || c.InvalidCount() != 1 {
+			t.Error("expect invalid batch struck, got", len(c.Received), "messages received and", c.InvalidCount(), "strikes")
+		}
+		if len(c.Send) != 1 || <-c.Send != ErrInvalidWsMessage {
+			t.Error("expect the invalid message error queued only")
+		}
+	})
+}
+
+func TestMessageLimit(t *testing.T) {
+	hub := NewHub(Config{})
+	c := NewClient(hub, nil, nil, "web")
+	c.SetMessageLimit(1, 2)
+	hub.Register(c)
+
+	hub.SetConfig(Config{ThrottleThreshold: 10, ThrottleHalfLife: time.Hour})
+	if c.throttle(nil, 1) || c.throttle(nil, 1) || !c.throttle(nil, 1) {
+		t.Fatal("expect limit of the client kept on reload")
+	}
+}
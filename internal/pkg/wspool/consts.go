@@ -12,6 +12,8 @@ var (
 	// ErrInternalError describes a server-side error
 	ErrInternalError          = mustPrepareMessage("internal server error")
 	ErrTooManyInvalidMessages = mustPrepareMessage("too many invalid messages")
+	// ErrRateLimitExceeded is sent before the client gets disconnected for exceeding the rate limit
+	ErrRateLimitExceeded = mustPrepareMessage("rate limit exceeded")
 )
 
 func mustPrepareMessage(m string) (msg *websocket.PreparedMessage) {
@@ -3,66 +3,208 @@
 package wspool
 
 import (
+	"context"
 	"sync"
+	"time"
 
+	"github.com/gorilla/websocket"
 	"github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/proto"
 
 	"github.com/penguin-statistics/probe/internal/pkg/logger"
+	"github.com/penguin-statistics/probe/internal/pkg/messages"
 )
 
+// evictInterval is the interval between batches of going-away closes sent by Evict
+const evictInterval = 100 * time.Millisecond
+
+// Metrics receives events happened within the pool to be exported as metrics
+type Metrics interface {
+	// IncInvalidMessage is called on every invalid message received
+	IncInvalidMessage(reason string)
+	// IncPolicyDisconnect is called when a client is disconnected for violating the policy
+	IncPolicyDisconnect(reason string)
+	// IncThrottled is called on every message dropped by the rate limit
+	IncThrottled(platform string)
+}
+
+type nopMetrics struct{}
+
+func (nopMetrics) IncInvalidMessage(string)   {}
+func (nopMetrics) IncPolicyDisconnect(string) {}
+func (nopMetrics) IncThrottled(string)        {}
+
+// Config configures a Hub and the clients registered to it
+type Config struct {
+	// InvalidThreshold is the invalid message score at which a client gets disconnected. Zero disables the policy.
+	InvalidThreshold float64
+	// InvalidHalfLife is the time it takes for the invalid message score to decay by half
+	InvalidHalfLife time.Duration
+	// MessageRate is the messages allowed per second per client. Zero disables the rate limit.
+	MessageRate float64
+	// MessageBurst is the messages allowed to exceed MessageRate momentarily
+	MessageBurst int
+	// ThrottleThreshold is the throttled message score at which a client gets disconnected. Zero disables the escalation.
+	ThrottleThreshold float64
+	// ThrottleHalfLife is the time it takes for the throttled message score to decay by half
+	ThrottleHalfLife time.Duration
+	// Metrics receives pool events. Optional.
+	Metrics Metrics
+}
+
 // Hub consists of current active clients
 type Hub struct {
-	Register   chan *Client
-	Unregister chan *Client
-	logger     *logrus.Entry
+	logger  *logrus.Entry
+	clients *registry
 
-	clientsmu sync.RWMutex
-	Clients   map[*Client]struct{}
+	configmu sync.RWMutex
+	config   Config
 }
 
-// NewHub creates a new Hub
-func NewHub() *Hub {
+// NewHub creates a new Hub with config
+func NewHub(config Config) *Hub {
 	return &Hub{
-		Register:   make(chan *Client),
-		Unregister: make(chan *Client),
-		logger:     logger.New("wspool"),
-		Clients:    make(map[*Client]struct{}),
+		logger:  logger.New("wspool"),
+		config:  config,
+		clients: newRegistry(),
+	}
+}
+
+func (h *Hub) conf() Config {
+	h.configmu.RLock()
+	defer h.configmu.RUnlock()
+	return h.config
+}
+
+// SetConfig replaces the limits of the hub, which take effect on the clients registered immediately.
+// Metrics is kept if not set in config.
+func (h *Hub) SetConfig(config Config) {
+	h.configmu.Lock()
+	if config.Metrics == nil {
+		config.Metrics = h.config.Metrics
+	}
+	h.config = config
+	h.configmu.Unlock()
+
+	limit, burst := messageLimit(config)
+	h.Range(func(client *Client) bool {
+		if client.ownLimit {
+			return true
+		}
+		client.rateLimiter.SetLimit(limit)
+		client.rateLimiter.SetBurst(burst)
+		return true
+	})
+}
+
+func (h *Hub) metrics() Metrics {
+	if m := h.conf().Metrics; m != nil {
+		return m
+	}
+	return nopMetrics{}
+}
+
+// Register adds client to the hub
+func (h *Hub) Register(client *Client) {
+	h.clients.add(client)
+}
+
+// Unregister removes client from the hub. Unregistering a client which is not registered is a no-op.
+func (h *Hub) Unregister(client *Client) {
+	h.clients.remove(client)
+}
+
+// Len returns the amount of clients currently registered
+func (h *Hub) Len() int {
+	return h.clients.count()
+}
+
+// Range calls f for every registered client until f returns false. f shall not block,
+// and shall not register or unregister clients, e.g. by closing them.
+func (h *Hub) Range(f func(client *Client) bool) {
+	h.clients.each(f)
+}
+
+// Snapshot returns the clients registered at the time of the call. Unlike Range,
+// the caller is free to do anything with the clients returned.
+func (h *Hub) Snapshot() []*Client {
+	return h.clients.snapshot()
+}
+
+// Broadcast sends m to all clients which negotiated CapabilityBroadcast. Clients which are not able to keep up
+// with their queue are skipped.
+func (h *Hub) Broadcast(m *messages.ServerBroadcast) {
+	m.Type = messages.MessageType_SERVER_BROADCAST
+	b, err := proto.Marshal(m)
+	if err != nil {
+		h.logger.Debugln("error occurred when marshalling broadcast message", err)
+		return
+	}
+	p, err := websocket.NewPreparedMessage(websocket.BinaryMessage, b)
+	if err != nil {
+		h.logger.Debugln("error occurred when preparing broadcast message", err)
+		return
 	}
+	h.Range(func(client *Client) bool {
+		if !client.Protocol.Supports(CapabilityBroadcast) {
+			return true
+		}
+		select {
+		case client.Send <- p:
+		default:
+		}
+		return true
+	})
 }
 
-// Run listens for channel update on client connect and disconnects
-// and reflects them on the internal Clients property
-func (h *Hub) Run() {
-	for {
+// Evict sends going-away closes to all clients in batches paced evenly over spread, so that they do not
+// reconnect to the remaining instances all at once. It returns once all clients are gone, or closes the
+// remaining ones forcibly and returns ctx.Err() once ctx is done.
+func (h *Hub) Evict(ctx context.Context, spread time.Duration) error {
+	ticker := time.NewTicker(evictInterval)
+	defer ticker.Stop()
+	wait := func() error {
 		select {
-		case client := <-h.Register:
-			h.clientsmu.Lock()
-			h.Clients[client] = struct{}{}
-			h.clientsmu.Unlock()
-		case client := <-h.Unregister:
-			h.clientsmu.Lock()
-			if _, ok := h.Clients[client]; ok {
-				delete(h.Clients, client)
+		case <-ticker.C:
+			return nil
+		case <-ctx.Done():
+			for _, client := range h.Snapshot() {
+				client.Close()
 			}
-			h.clientsmu.Unlock()
+			return ctx.Err()
 		}
 	}
-}
 
-func (h *Hub) Evict() {
-	h.clientsmu.RLock()
-	defer h.clientsmu.RUnlock()
-
-	var wg sync.WaitGroup
-	limiter := make(chan struct{}, 8)
-	for client := range h.Clients {
-		limiter <- struct{}{}
-		wg.Add(1)
-		go func(client *Client) {
-			client.Close()
-			close(client.GoingAwayClose)
-			<-limiter
-		}(client)
+	clients := h.Snapshot()
+	batches := int(spread / evictInterval)
+	if batches < 1 {
+		batches = 1
+	}
+	size := (len(clients) + batches - 1) / batches
+	for i := 0; i < len(clients); i += size {
+		end := i + size
+		if end > len(clients) {
+			end = len(clients)
+		}
+		for _, client := range clients[i:end] {
+			client.GoAway()
+		}
+		h.logger.Debugln("sent going-away close to", end, "of", len(clients), "clients")
+		if end < len(clients) {
+			if err := wait(); err != nil {
+				return err
+			}
+		}
+	}
+
+	for h.Len() > 0 {
+		if err := wait(); err != nil {
+			return err
+		}
+		// clients registered after the snapshot have not been asked to go away yet
+		for _, client := range h.Snapshot() {
+			client.GoAway()
+		}
 	}
-	wg.Wait()
+	return nil
 }
@@ -0,0 +1,117 @@
+package wspool
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestClients(hub *Hub, n int) []*Client {
+	clients := make([]*Client, n)
+	for i := range clients {
+		clients[i] = NewClient(hub, nil, nil, "web")
+	}
+	return clients
+}
+
+func TestHubRegistry(t *testing.T) {
+	hub := NewHub(Config{})
+	clients := newTestClients(hub, 1000)
+
+	var wg sync.WaitGroup
+	for _, c := range clients {
+		wg.Add(1)
+		go func(c *Client) {
+			defer wg.Done()
+			hub.Register(c)
+			hub.Register(c)
+		}(c)
+	}
+	wg.Wait()
+	if hub.Len() != len(clients) {
+		t.Fatal("expect", len(clients), "clients registered, got", hub.Len())
+	}
+	if l := len(hub.Snapshot()); l != len(clients) {
+		t.Fatal("expect snapshot of", len(clients), "clients, got", l)
+	}
+
+	for _, c := range clients[:500] {
+		wg.Add(1)
+		go func(c *Client) {
+			defer wg.Done()
+			hub.Unregister(c)
+			hub.Unregister(c)
+		}(c)
+	}
+	wg.Wait()
+	if hub.Len() != 500 {
+		t.Fatal("expect 500 clients registered, got", hub.Len())
+	}
+
+	visited := 0
+	hub.Range(func(c *Client) bool {
+		visited++
+		return visited < 10
+	})
+	if visited != 10 {
+		t.Error("expect range to stop after 10 clients, got", visited)
+	}
+}
+
+func TestHubEvict(t *testing.T) {
+	hub := NewHub(Config{})
+	clients := newTestClients(hub, 50)
+	var mu sync.Mutex
+	var wentAway []time.Time
+	for _, c := range clients {
+		hub.Register(c)
+		// stands in for Write, which unregisters the client once the going-away close is sent
+		go func(c *Client) {
+			<-c.GoingAwayClose
+			mu.Lock()
+			wentAway = append(wentAway, time.Now())
+			mu.Unlock()
+			hub.Unregister(c)
+		}(c)
+	}
+
+	start := time.Now()
+	if err := hub.Evict(context.Background(), 5*evictInterval); err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if hub.Len() != 0 {
+		t.Fatal("expect all clients gone, got", hub.Len())
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(wentAway) != len(clients) {
+		t.Fatal("expect all clients to go away, got", len(wentAway))
+	}
+	if last := wentAway[len(wentAway)-1].Sub(start); last < 4*evictInterval {
+		t.Error("expect going-away closes spread over 4 intervals at least, got", last)
+	}
+
+	// GoAway is idempotent
+	clients[0].GoAway()
+}
+
+// BenchmarkHubRegistry measures register/unregister throughput with 100k connections registered
+func BenchmarkHubRegistry(b *testing.B) {
+	hub := NewHub(Config{})
+	for _, c := range newTestClients(hub, 100000) {
+		hub.Register(c)
+	}
+	churn := newTestClients(hub, 4096)
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			c := churn[i%len(churn)]
+			hub.Register(c)
+			hub.Unregister(c)
+			i++
+		}
+	})
+}
@@ -0,0 +1,148 @@
+package wspool
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// ProtocolV1 is the original protocol: plain ACKs and no optional capabilities
+	ProtocolV1 = 1
+	// ProtocolV2 allows clients to opt in to capabilities during the upgrade
+	ProtocolV2 = 2
+
+	// ProtocolLatest is the latest protocol version the server speaks
+	ProtocolLatest = ProtocolV2
+
+	// legacySubprotocol is the subprotocol name used by clients predating version negotiation
+	legacySubprotocol = "pb"
+)
+
+// Capability is an optional protocol feature which a client may declare support for
+type Capability string
+
+const (
+	// CapabilitySeqACK makes the server echo Meta.seq back in ServerACK.seq
+	CapabilitySeqACK Capability = "seqack"
+	// CapabilityBatch allows the client to send multiple messages in a single Batch frame
+	CapabilityBatch Capability = "batch"
+	// CapabilityResume makes the server send a ServerSession with a resume token right after the upgrade
+	CapabilityResume Capability = "resume"
+	// CapabilityBroadcast makes the server push ServerBroadcast messages, which other clients never receive
+	CapabilityBroadcast Capability = "broadcast"
+)
+
+// supportedCapabilities are capabilities the server is able to enable for ProtocolV2+ clients
+var supportedCapabilities = map[Capability]struct{}{
+	CapabilitySeqACK:    {},
+	CapabilityBatch:     {},
+	CapabilityResume:    {},
+	CapabilityBroadcast: {},
+}
+
+var (
+	// ErrUnsupportedProtocol is returned when the client only offers protocol versions the server does not speak
+	ErrUnsupportedProtocol = errors.New("unsupported protocol version")
+	// ErrProtocolMismatch is returned when the subprotocol and the query param disagree on the version
+	ErrProtocolMismatch = errors.New("protocol version in subprotocol and query param mismatch")
+)
+
+// Protocol is the result of the protocol negotiation with a client
+type Protocol struct {
+	// Version is the negotiated protocol revision
+	Version int
+	// Subprotocol is the subprotocol to be selected in the upgrade response, if any
+	Subprotocol string
+
+	capabilities map[Capability]struct{}
+}
+
+// Supports reports whether the client declared support for capability c and the server enabled it
+func (p *Protocol) Supports(c Capability) bool {
+	if p == nil {
+		return false
+	}
+	_, ok := p.capabilities[c]
+	return ok
+}
+
+// Capabilities returns the enabled capabilities as a comma-separated list
+func (p *Protocol) Capabilities() string {
+	if p == nil {
+		return ""
+	}
+	caps := make([]string, 0, len(p.capabilities))
+	for c := range p.capabilities {
+		caps = append(caps, string(c))
+	}
+	sort.Strings(caps)
+	return strings.Join(caps, ",")
+}
+
+// NegotiateProtocol determines the protocol version and capabilities for a client. subprotocols are the
+// values of Sec-WebSocket-Protocol as offered by the client (e.g. "probe.v2+pb"); version and capabilities
+// are the query param equivalents for clients which are not able to set subprotocols. A client declaring
+// nothing at all is considered to be speaking ProtocolV1.
+func NegotiateProtocol(subprotocols []string, version int, capabilities string) (*Protocol, error) {
+	p := &Protocol{
+		Version:      ProtocolV1,
+		capabilities: map[Capability]struct{}{},
+	}
+
+	if len(subprotocols) > 0 {
+		// pick the highest version amongst the offered subprotocols
+		selected := 0
+		for _, s := range subprotocols {
+			v, ok := parseSubprotocol(s)
+			if !ok || v > ProtocolLatest || v <= selected {
+				continue
+			}
+			selected = v
+			p.Subprotocol = s
+		}
+		if selected == 0 {
+			return nil, ErrUnsupportedProtocol
+		}
+		if version != 0 && version != selected {
+			return nil, ErrProtocolMismatch
+		}
+		p.Version = selected
+	} else if version != 0 {
+		if version < ProtocolV1 || version > ProtocolLatest {
+			return nil, ErrUnsupportedProtocol
+		}
+		p.Version = version
+	}
+
+	if p.Version < ProtocolV2 {
+		return p, nil
+	}
+
+	// unknown capabilities are silently dropped so that newer clients are able to talk to older servers
+	for _, c := range strings.Split(capabilities, ",") {
+		c := Capability(strings.ToLower(strings.TrimSpace(c)))
+		if _, ok := supportedCapabilities[c]; ok {
+			p.capabilities[c] = struct{}{}
+		}
+	}
+
+	return p, nil
+}
+
+// parseSubprotocol parses subprotocol names in the form of "probe.v<version>+pb". The legacy "pb" subprotocol
+// is treated as ProtocolV1.
+func parseSubprotocol(s string) (int, bool) {
+	if s == legacySubprotocol {
+		return ProtocolV1, true
+	}
+	if !strings.HasPrefix(s, "probe.v") || !strings.HasSuffix(s, "+pb") {
+		return 0, false
+	}
+	v, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(s, "probe.v"), "+pb"))
+	if err != nil || v < ProtocolV1 {
+		return 0, false
+	}
+	return v, true
+}
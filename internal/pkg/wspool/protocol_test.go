@@ -0,0 +1,60 @@
+package wspool
+
+import "testing"
+
+func TestNegotiateProtocol(t *testing.T) {
+	t.Run("should default to v1 when nothing is declared", func(t *testing.T) {
+		p, err := NegotiateProtocol(nil, 0, "seqack")
+		if err != nil {
+			t.Fatal("unexpected error", err)
+		}
+		if p.Version != ProtocolV1 || p.Subprotocol != "" || p.Supports(CapabilitySeqACK) {
+			t.Fatal("expect plain v1 protocol, got", p.Version, p.Subprotocol, p.Capabilities())
+		}
+	})
+
+	t.Run("should treat legacy subprotocol as v1", func(t *testing.T) {
+		p, err := NegotiateProtocol([]string{"pb"}, 0, "")
+		if err != nil {
+			t.Fatal("unexpected error", err)
+		}
+		if p.Version != ProtocolV1 || p.Subprotocol != "pb" {
+			t.Fatal("expect v1 with pb subprotocol, got", p.Version, p.Subprotocol)
+		}
+	})
+
+	t.Run("should pick the highest supported subprotocol", func(t *testing.T) {
+		p, err := NegotiateProtocol([]string{"pb", "probe.v99+pb", "probe.v2+pb"}, 0, "batch, SEQACK,unknown")
+		if err != nil {
+			t.Fatal("unexpected error", err)
+		}
+		if p.Version != ProtocolV2 || p.Subprotocol != "probe.v2+pb" {
+			t.Fatal("expect v2 with probe.v2+pb subprotocol, got", p.Version, p.Subprotocol)
+		}
+		if p.Capabilities() != "batch,seqack" {
+			t.Fatal("expect capabilities batch,seqack, got", p.Capabilities())
+		}
+	})
+
+	t.Run("should accept version from query param", func(t *testing.T) {
+		p, err := NegotiateProtocol(nil, 2, "seqack")
+		if err != nil {
+			t.Fatal("unexpected error", err)
+		}
+		if p.Version != ProtocolV2 || !p.Supports(CapabilitySeqACK) || p.Supports(CapabilityBatch) {
+			t.Fatal("expect v2 with seqack only, got", p.Version, p.Capabilities())
+		}
+	})
+
+	t.Run("should reject unsupported versions", func(t *testing.T) {
+		if _, err := NegotiateProtocol([]string{"probe.v99+pb", "chat"}, 0, ""); err != ErrUnsupportedProtocol {
+			t.Error("expect ErrUnsupportedProtocol, got", err)
+		}
+		if _, err := NegotiateProtocol(nil, 99, ""); err != ErrUnsupportedProtocol {
+			t.Error("expect ErrUnsupportedProtocol, got", err)
+		}
+		if _, err := NegotiateProtocol([]string{"probe.v2+pb"}, 1, ""); err != ErrProtocolMismatch {
+			t.Error("expect ErrProtocolMismatch, got", err)
+		}
+	})
+}
@@ -0,0 +1,92 @@
+package wspool
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// registryShards is the amount of shards of a registry. Must be a power of two.
+const registryShards = 64
+
+// registry is a sharded set of clients. Clients are distributed over the shards by their id,
+// so that registrations and unregistrations of different clients rarely contend on the same lock.
+type registry struct {
+	shards [registryShards]registryShard
+	len    int64
+}
+
+type registryShard struct {
+	mu      sync.RWMutex
+	clients map[*Client]struct{}
+	// pad to a cache line to avoid false sharing between neighbouring shards
+	_ [32]byte
+}
+
+func newRegistry() *registry {
+	r := &registry{}
+	for i := range r.shards {
+		r.shards[i].clients = make(map[*Client]struct{})
+	}
+	return r
+}
+
+func (r *registry) shard(c *Client) *registryShard {
+	return &r.shards[c.id&(registryShards-1)]
+}
+
+// add adds c to the registry. It reports whether c was not registered before.
+func (r *registry) add(c *Client) bool {
+	s := r.shard(c)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.clients[c]; ok {
+		return false
+	}
+	s.clients[c] = struct{}{}
+	atomic.AddInt64(&r.len, 1)
+	return true
+}
+
+// remove removes c from the registry. It reports whether c was registered.
+func (r *registry) remove(c *Client) bool {
+	s := r.shard(c)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.clients[c]; !ok {
+		return false
+	}
+	delete(s.clients, c)
+	atomic.AddInt64(&r.len, -1)
+	return true
+}
+
+// count returns the amount of clients registered
+func (r *registry) count() int {
+	return int(atomic.LoadInt64(&r.len))
+}
+
+// each calls f for every registered client until f returns false. Each shard is read-locked
+// while its clients are visited, thus f shall not register or unregister clients.
+func (r *registry) each(f func(c *Client) bool) {
+	for i := range r.shards {
+		s := &r.shards[i]
+		s.mu.RLock()
+		for c := range s.clients {
+			if !f(c) {
+				s.mu.RUnlock()
+				return
+			}
+		}
+		s.mu.RUnlock()
+	}
+}
+
+// snapshot returns the clients registered at the time of the call
+func (r *registry) snapshot() []*Client {
+	clients := make([]*Client, 0, r.count())
+	r.each(func(c *Client) bool {
+		clients = append(clients, c)
+		return true
+	})
+	return clients
+}
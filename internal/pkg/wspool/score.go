@@ -0,0 +1,26 @@
+package wspool
+
+import (
+	"math"
+	"time"
+)
+
+// scoreEpsilon is the tolerance of scores so that events in quick succession are not saved by the decay
+const scoreEpsilon = 1e-2
+
+// score is a counter which decays by half every halfLife
+type score struct {
+	value float64
+	last  time.Time
+}
+
+// add decays the score until now, increments it by one and reports whether it has reached threshold.
+// A zero threshold is never reached.
+func (s *score) add(now time.Time, halfLife time.Duration, threshold float64) bool {
+	if !s.last.IsZero() && halfLife > 0 {
+		s.value *= math.Exp2(-float64(now.Sub(s.last)) / float64(halfLife))
+	}
+	s.value++
+	s.last = now
+	return threshold > 0 && s.value+scoreEpsilon >= threshold
+}
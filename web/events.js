@@ -64,7 +64,10 @@ $root.PenguinProbe = (function() {
      * @property {number} NAVIGATED=1 NAVIGATED value
      * @property {number} ENTERED_SEARCH_RESULT=2 ENTERED_SEARCH_RESULT value
      * @property {number} EXECUTED_ADVANCED_QUERY=3 EXECUTED_ADVANCED_QUERY value
+     * @property {number} BATCH=4 BATCH value
      * @property {number} SERVER_ACK=64 SERVER_ACK value
+     * @property {number} SERVER_SESSION=65 SERVER_SESSION value
+     * @property {number} SERVER_BROADCAST=66 SERVER_BROADCAST value
      */
     PenguinProbe.MessageType = (function() {
         var valuesById = {}, values = Object.create(valuesById);
@@ -72,7 +75,10 @@ $root.PenguinProbe = (function() {
         values[valuesById[1] = "NAVIGATED"] = 1;
         values[valuesById[2] = "ENTERED_SEARCH_RESULT"] = 2;
         values[valuesById[3] = "EXECUTED_ADVANCED_QUERY"] = 3;
+        values[valuesById[4] = "BATCH"] = 4;
         values[valuesById[64] = "SERVER_ACK"] = 64;
+        values[valuesById[65] = "SERVER_SESSION"] = 65;
+        values[valuesById[66] = "SERVER_BROADCAST"] = 66;
         return values;
     })();
 
@@ -84,6 +90,7 @@ $root.PenguinProbe = (function() {
          * @interface IMeta
          * @property {PenguinProbe.MessageType|null} [type] Meta type
          * @property {PenguinProbe.Language|null} [language] Meta language
+         * @property {number|null} [seq] Meta seq
          */
 
         /**
@@ -117,6 +124,14 @@ $root.PenguinProbe = (function() {
          */
         Meta.prototype.language = 0;
 
+        /**
+         * Meta seq.
+         * @member {number} seq
+         * @memberof PenguinProbe.Meta
+         * @instance
+         */
+        Meta.prototype.seq = 0;
+
         /**
          * Creates a new Meta instance using the specified properties.
          * @function create
@@ -145,6 +160,8 @@ $root.PenguinProbe = (function() {
                 writer.uint32(/* id 1, wireType 0 =*/8).int32(message.type);
             if (message.language != null && Object.hasOwnProperty.call(message, "language"))
                 writer.uint32(/* id 2, wireType 0 =*/16).int32(message.language);
+            if (message.seq != null && Object.hasOwnProperty.call(message, "seq"))
+                writer.uint32(/* id 3, wireType 0 =*/24).uint32(message.seq);
             return writer;
         };
 
@@ -185,6 +202,9 @@ $root.PenguinProbe = (function() {
                 case 2:
                     message.language = reader.int32();
                     break;
+                case 3:
+                    message.seq = reader.uint32();
+                    break;
                 default:
                     reader.skipType(tag & 7);
                     break;
@@ -228,7 +248,10 @@ $root.PenguinProbe = (function() {
                 case 1:
                 case 2:
                 case 3:
+                case 4:
                 case 64:
+                case 65:
+                case 66:
                     break;
                 }
             if (message.language != null && message.hasOwnProperty("language"))
@@ -242,6 +265,9 @@ $root.PenguinProbe = (function() {
                 case 4:
                     break;
                 }
+            if (message.seq != null && message.hasOwnProperty("seq"))
+                if (!$util.isInteger(message.seq))
+                    return "seq: integer expected";
             return null;
         };
 
@@ -274,10 +300,22 @@ $root.PenguinProbe = (function() {
             case 3:
                 message.type = 3;
                 break;
+            case "BATCH":
+            case 4:
+                message.type = 4;
+                break;
             case "SERVER_ACK":
             case 64:
                 message.type = 64;
                 break;
+            case "SERVER_SESSION":
+            case 65:
+                message.type = 65;
+                break;
+            case "SERVER_BROADCAST":
+            case 66:
+                message.type = 66;
+                break;
             }
             switch (object.language) {
             case "ZH_CN":
@@ -301,6 +339,8 @@ $root.PenguinProbe = (function() {
                 message.language = 4;
                 break;
             }
+            if (object.seq != null)
+                message.seq = object.seq >>> 0;
             return message;
         };
 
@@ -320,11 +360,14 @@ $root.PenguinProbe = (function() {
             if (options.defaults) {
                 object.type = options.enums === String ? "UNKNOWN" : 0;
                 object.language = options.enums === String ? "ZH_CN" : 0;
+                object.seq = 0;
             }
             if (message.type != null && message.hasOwnProperty("type"))
                 object.type = options.enums === String ? $root.PenguinProbe.MessageType[message.type] : message.type;
             if (message.language != null && message.hasOwnProperty("language"))
                 object.language = options.enums === String ? $root.PenguinProbe.Language[message.language] : message.language;
+            if (message.seq != null && message.hasOwnProperty("seq"))
+                object.seq = message.seq;
             return object;
         };
 
@@ -1693,6 +1736,240 @@ $root.PenguinProbe = (function() {
         return Navigated;
     })();
 
+    PenguinProbe.Batch = (function() {
+
+        /**
+         * Properties of a Batch.
+         * @memberof PenguinProbe
+         * @interface IBatch
+         * @property {PenguinProbe.IMeta|null} [meta] Batch meta
+         * @property {Array.<Uint8Array>|null} [messages] Batch messages
+         */
+
+        /**
+         * Constructs a new Batch.
+         * @memberof PenguinProbe
+         * @classdesc Represents a Batch.
+         * @implements IBatch
+         * @constructor
+         * @param {PenguinProbe.IBatch=} [properties] Properties to set
+         */
+        function Batch(properties) {
+            this.messages = [];
+            if (properties)
+                for (var keys = Object.keys(properties), i = 0; i < keys.length; ++i)
+                    if (properties[keys[i]] != null)
+                        this[keys[i]] = properties[keys[i]];
+        }
+
+        /**
+         * Batch meta.
+         * @member {PenguinProbe.IMeta|null|undefined} meta
+         * @memberof PenguinProbe.Batch
+         * @instance
+         */
+        Batch.prototype.meta = null;
+
+        /**
+         * Batch messages.
+         * @member {Array.<Uint8Array>} messages
+         * @memberof PenguinProbe.Batch
+         * @instance
+         */
+        Batch.prototype.messages = $util.emptyArray;
+
+        /**
+         * Creates a new Batch instance using the specified properties.
+         * @function create
+         * @memberof PenguinProbe.Batch
+         * @static
+         * @param {PenguinProbe.IBatch=} [properties] Properties to set
+         * @returns {PenguinProbe.Batch} Batch instance
+         */
+        Batch.create = function create(properties) {
+            return new Batch(properties);
+        };
+
+        /**
+         * Encodes the specified Batch message. Does not implicitly {@link PenguinProbe.Batch.verify|verify} messages.
+         * @function encode
+         * @memberof PenguinProbe.Batch
+         * @static
+         * @param {PenguinProbe.IBatch} message Batch message or plain object to encode
+         * @param {$protobuf.Writer} [writer] Writer to encode to
+         * @returns {$protobuf.Writer} Writer
+         */
+        Batch.encode = function encode(message, writer) {
+            if (!writer)
+                writer = $Writer.create();
+            if (message.meta != null && Object.hasOwnProperty.call(message, "meta"))
+                $root.PenguinProbe.Meta.encode(message.meta, writer.uint32(/* id 1, wireType 2 =*/10).fork()).ldelim();
+            if (message.messages != null && message.messages.length)
+                for (var i = 0; i < message.messages.length; ++i)
+                    writer.uint32(/* id 2, wireType 2 =*/18).bytes(message.messages[i]);
+            return writer;
+        };
+
+        /**
+         * Encodes the specified Batch message, length delimited. Does not implicitly {@link PenguinProbe.Batch.verify|verify} messages.
+         * @function encodeDelimited
+         * @memberof PenguinProbe.Batch
+         * @static
+         * @param {PenguinProbe.IBatch} message Batch message or plain object to encode
+         * @param {$protobuf.Writer} [writer] Writer to encode to
+         * @returns {$protobuf.Writer} Writer
+         */
+        Batch.encodeDelimited = function encodeDelimited(message, writer) {
+            return this.encode(message, writer).ldelim();
+        };
+
+        /**
+         * Decodes a Batch message from the specified reader or buffer.
+         * @function decode
+         * @memberof PenguinProbe.Batch
+         * @static
+         * @param {$protobuf.Reader|Uint8Array} reader Reader or buffer to decode from
+         * @param {number} [length] Message length if known beforehand
+         * @returns {PenguinProbe.Batch} Batch
+         * @throws {Error} If the payload is not a reader or valid buffer
+         * @throws {$protobuf.util.ProtocolError} If required fields are missing
+         */
+        Batch.decode = function decode(reader, length) {
+            if (!(reader instanceof $Reader))
+                reader = $Reader.create(reader);
+            var end = length === undefined ? reader.len : reader.pos + length, message = new $root.PenguinProbe.Batch();
+            while (reader.pos < end) {
+                var tag = reader.uint32();
+                switch (tag >>> 3) {
+                case 1:
+                    message.meta = $root.PenguinProbe.Meta.decode(reader, reader.uint32());
+                    break;
+                case 2:
+                    if (!(message.messages && message.messages.length))
+                        message.messages = [];
+                    message.messages.push(reader.bytes());
+                    break;
+                default:
+                    reader.skipType(tag & 7);
+                    break;
+                }
+            }
+            return message;
+        };
+
+        /**
+         * Decodes a Batch message from the specified reader or buffer, length delimited.
+         * @function decodeDelimited
+         * @memberof PenguinProbe.Batch
+         * @static
+         * @param {$protobuf.Reader|Uint8Array} reader Reader or buffer to decode from
+         * @returns {PenguinProbe.Batch} Batch
+         * @throws {Error} If the payload is not a reader or valid buffer
+         * @throws {$protobuf.util.ProtocolError} If required fields are missing
+         */
+        Batch.decodeDelimited = function decodeDelimited(reader) {
+            if (!(reader instanceof $Reader))
+                reader = new $Reader(reader);
+            return this.decode(reader, reader.uint32());
+        };
+
+        /**
+         * Verifies a Batch message.
+         * @function verify
+         * @memberof PenguinProbe.Batch
+         * @static
+         * @param {Object.<string,*>} message Plain object to verify
+         * @returns {string|null} `null` if valid, otherwise the reason why it is not
+         */
+        Batch.verify = function verify(message) {
+            if (typeof message !== "object" || message === null)
+                return "object expected";
+            if (message.meta != null && message.hasOwnProperty("meta")) {
+                var error = $root.PenguinProbe.Meta.verify(message.meta);
+                if (error)
+                    return "meta." + error;
+            }
+            if (message.messages != null && message.hasOwnProperty("messages")) {
+                if (!Array.isArray(message.messages))
+                    return "messages: array expected";
+                for (var i = 0; i < message.messages.length; ++i)
+                    if (!(message.messages[i] && typeof message.messages[i].length === "number" || $util.isString(message.messages[i])))
+                        return "messages: buffer[] expected";
+            }
+            return null;
+        };
+
+        /**
+         * Creates a Batch message from a plain object. Also converts values to their respective internal types.
+         * @function fromObject
+         * @memberof PenguinProbe.Batch
+         * @static
+         * @param {Object.<string,*>} object Plain object
+         * @returns {PenguinProbe.Batch} Batch
+         */
+        Batch.fromObject = function fromObject(object) {
+            if (object instanceof $root.PenguinProbe.Batch)
+                return object;
+            var message = new $root.PenguinProbe.Batch();
+            if (object.meta != null) {
+                if (typeof object.meta !== "object")
+                    throw TypeError(".PenguinProbe.Batch.meta: object expected");
+                message.meta = $root.PenguinProbe.Meta.fromObject(object.meta);
+            }
+            if (object.messages) {
+                if (!Array.isArray(object.messages))
+                    throw TypeError(".PenguinProbe.Batch.messages: array expected");
+                message.messages = [];
+                for (var i = 0; i < object.messages.length; ++i)
+                    if (typeof object.messages[i] === "string")
+                        $util.base64.decode(object.messages[i], message.messages[i] = $util.newBuffer($util.base64.length(object.messages[i])), 0);
+                    else if (object.messages[i].length)
+                        message.messages[i] = object.messages[i];
+            }
+            return message;
+        };
+
+        /**
+         * Creates a plain object from a Batch message. Also converts values to other types if specified.
+         * @function toObject
+         * @memberof PenguinProbe.Batch
+         * @static
+         * @param {PenguinProbe.Batch} message Batch
+         * @param {$protobuf.IConversionOptions} [options] Conversion options
+         * @returns {Object.<string,*>} Plain object
+         */
+        Batch.toObject = function toObject(message, options) {
+            if (!options)
+                options = {};
+            var object = {};
+            if (options.arrays || options.defaults)
+                object.messages = [];
+            if (options.defaults)
+                object.meta = null;
+            if (message.meta != null && message.hasOwnProperty("meta"))
+                object.meta = $root.PenguinProbe.Meta.toObject(message.meta, options);
+            if (message.messages && message.messages.length) {
+                object.messages = [];
+                for (var j = 0; j < message.messages.length; ++j)
+                    object.messages[j] = options.bytes === String ? $util.base64.encode(message.messages[j], 0, message.messages[j].length) : options.bytes === Array ? Array.prototype.slice.call(message.messages[j]) : message.messages[j];
+            }
+            return object;
+        };
+
+        /**
+         * Converts this Batch to JSON.
+         * @function toJSON
+         * @memberof PenguinProbe.Batch
+         * @instance
+         * @returns {Object.<string,*>} JSON object
+         */
+        Batch.prototype.toJSON = function toJSON() {
+            return this.constructor.toObject(this, $protobuf.util.toJSONOptions);
+        };
+
+        return Batch;
+    })();
+
     PenguinProbe.ServerACK = (function() {
 
         /**
@@ -1701,6 +1978,8 @@ $root.PenguinProbe = (function() {
          * @interface IServerACK
          * @property {PenguinProbe.MessageType|null} [type] ServerACK type
          * @property {string|null} [message] ServerACK message
+         * @property {number|null} [seq] ServerACK seq
+         * @property {number|null} [retryAfter] ServerACK retryAfter
          */
 
         /**
@@ -1734,6 +2013,22 @@ $root.PenguinProbe = (function() {
          */
         ServerACK.prototype.message = "";
 
+        /**
+         * ServerACK seq.
+         * @member {number} seq
+         * @memberof PenguinProbe.ServerACK
+         * @instance
+         */
+        ServerACK.prototype.seq = 0;
+
+        /**
+         * ServerACK retryAfter.
+         * @member {number} retryAfter
+         * @memberof PenguinProbe.ServerACK
+         * @instance
+         */
+        ServerACK.prototype.retryAfter = 0;
+
         /**
          * Creates a new ServerACK instance using the specified properties.
          * @function create
@@ -1762,6 +2057,10 @@ $root.PenguinProbe = (function() {
                 writer.uint32(/* id 1, wireType 0 =*/8).int32(message.type);
             if (message.message != null && Object.hasOwnProperty.call(message, "message"))
                 writer.uint32(/* id 2, wireType 2 =*/18).string(message.message);
+            if (message.seq != null && Object.hasOwnProperty.call(message, "seq"))
+                writer.uint32(/* id 3, wireType 0 =*/24).uint32(message.seq);
+            if (message.retryAfter != null && Object.hasOwnProperty.call(message, "retryAfter"))
+                writer.uint32(/* id 4, wireType 0 =*/32).uint32(message.retryAfter);
             return writer;
         };
 
@@ -1802,6 +2101,12 @@ $root.PenguinProbe = (function() {
                 case 2:
                     message.message = reader.string();
                     break;
+                case 3:
+                    message.seq = reader.uint32();
+                    break;
+                case 4:
+                    message.retryAfter = reader.uint32();
+                    break;
                 default:
                     reader.skipType(tag & 7);
                     break;
@@ -1845,12 +2150,21 @@ $root.PenguinProbe = (function() {
                 case 1:
                 case 2:
                 case 3:
+                case 4:
                 case 64:
+                case 65:
+                case 66:
                     break;
                 }
             if (message.message != null && message.hasOwnProperty("message"))
                 if (!$util.isString(message.message))
                     return "message: string expected";
+            if (message.seq != null && message.hasOwnProperty("seq"))
+                if (!$util.isInteger(message.seq))
+                    return "seq: integer expected";
+            if (message.retryAfter != null && message.hasOwnProperty("retryAfter"))
+                if (!$util.isInteger(message.retryAfter))
+                    return "retryAfter: integer expected";
             return null;
         };
 
@@ -1883,13 +2197,29 @@ $root.PenguinProbe = (function() {
             case 3:
                 message.type = 3;
                 break;
+            case "BATCH":
+            case 4:
+                message.type = 4;
+                break;
             case "SERVER_ACK":
             case 64:
                 message.type = 64;
                 break;
+            case "SERVER_SESSION":
+            case 65:
+                message.type = 65;
+                break;
+            case "SERVER_BROADCAST":
+            case 66:
+                message.type = 66;
+                break;
             }
             if (object.message != null)
                 message.message = String(object.message);
+            if (object.seq != null)
+                message.seq = object.seq >>> 0;
+            if (object.retryAfter != null)
+                message.retryAfter = object.retryAfter >>> 0;
             return message;
         };
 
@@ -1909,11 +2239,17 @@ $root.PenguinProbe = (function() {
             if (options.defaults) {
                 object.type = options.enums === String ? "UNKNOWN" : 0;
                 object.message = "";
+                object.seq = 0;
+                object.retryAfter = 0;
             }
             if (message.type != null && message.hasOwnProperty("type"))
                 object.type = options.enums === String ? $root.PenguinProbe.MessageType[message.type] : message.type;
             if (message.message != null && message.hasOwnProperty("message"))
                 object.message = message.message;
+            if (message.seq != null && message.hasOwnProperty("seq"))
+                object.seq = message.seq;
+            if (message.retryAfter != null && message.hasOwnProperty("retryAfter"))
+                object.retryAfter = message.retryAfter;
             return object;
         };
 
@@ -1931,6 +2267,556 @@ $root.PenguinProbe = (function() {
         return ServerACK;
     })();
 
+    PenguinProbe.ServerSession = (function() {
+
+        /**
+         * Properties of a ServerSession.
+         * @memberof PenguinProbe
+         * @interface IServerSession
+         * @property {PenguinProbe.MessageType|null} [type] ServerSession type
+         * @property {string|null} [resumeToken] ServerSession resumeToken
+         * @property {boolean|null} [resumed] ServerSession resumed
+         * @property {number|null} [lastSeq] ServerSession lastSeq
+         */
+
+        /**
+         * Constructs a new ServerSession.
+         * @memberof PenguinProbe
+         * @classdesc Represents a ServerSession.
+         * @implements IServerSession
+         * @constructor
+         * @param {PenguinProbe.IServerSession=} [properties] Properties to set
+         */
+        function ServerSession(properties) {
+            if (properties)
+                for (var keys = Object.keys(properties), i = 0; i < keys.length; ++i)
+                    if (properties[keys[i]] != null)
+                        this[keys[i]] = properties[keys[i]];
+        }
+
+        /**
+         * ServerSession type.
+         * @member {PenguinProbe.MessageType} type
+         * @memberof PenguinProbe.ServerSession
+         * @instance
+         */
+        ServerSession.prototype.type = 0;
+
+        /**
+         * ServerSession resumeToken.
+         * @member {string} resumeToken
+         * @memberof PenguinProbe.ServerSession
+         * @instance
+         */
+        ServerSession.prototype.resumeToken = "";
+
+        /**
+         * ServerSession resumed.
+         * @member {boolean} resumed
+         * @memberof PenguinProbe.ServerSession
+         * @instance
+         */
+        ServerSession.prototype.resumed = false;
+
+        /**
+         * ServerSession lastSeq.
+         * @member {number} lastSeq
+         * @memberof PenguinProbe.ServerSession
+         * @instance
+         */
+        ServerSession.prototype.lastSeq = 0;
+
+        /**
+         * Creates a new ServerSession instance using the specified properties.
+         * @function create
+         * @memberof PenguinProbe.ServerSession
+         * @static
+         * @param {PenguinProbe.IServerSession=} [properties] Properties to set
+         * @returns {PenguinProbe.ServerSession} ServerSession instance
+         */
+        ServerSession.create = function create(properties) {
+            return new ServerSession(properties);
+        };
+
+        /**
+         * Encodes the specified ServerSession message. Does not implicitly {@link PenguinProbe.ServerSession.verify|verify} messages.
+         * @function encode
+         * @memberof PenguinProbe.ServerSession
+         * @static
+         * @param {PenguinProbe.IServerSession} message ServerSession message or plain object to encode
+         * @param {$protobuf.Writer} [writer] Writer to encode to
+         * @returns {$protobuf.Writer} Writer
+         */
+        ServerSession.encode = function encode(message, writer) {
+            if (!writer)
+                writer = $Writer.create();
+            if (message.type != null && Object.hasOwnProperty.call(message, "type"))
+                writer.uint32(/* id 1, wireType 0 =*/8).int32(message.type);
+            if (message.resumeToken != null && Object.hasOwnProperty.call(message, "resumeToken"))
+                writer.uint32(/* id 2, wireType 2 =*/18).string(message.resumeToken);
+            if (message.resumed != null && Object.hasOwnProperty.call(message, "resumed"))
+                writer.uint32(/* id 3, wireType 0 =*/24).bool(message.resumed);
+            if (message.lastSeq != null && Object.hasOwnProperty.call(message, "lastSeq"))
+                writer.uint32(/* id 4, wireType 0 =*/32).uint32(message.lastSeq);
+            return writer;
+        };
+
+        /**
+         * Encodes the specified ServerSession message, length delimited. Does not implicitly {@link PenguinProbe.ServerSession.verify|verify} messages.
+         * @function encodeDelimited
+         * @memberof PenguinProbe.ServerSession
+         * @static
+         * @param {PenguinProbe.IServerSession} message ServerSession message or plain object to encode
+         * @param {$protobuf.Writer} [writer] Writer to encode to
+         * @returns {$protobuf.Writer} Writer
+         */
+        ServerSession.encodeDelimited = function encodeDelimited(message, writer) {
+            return this.encode(message, writer).ldelim();
+        };
+
+        /**
+         * Decodes a ServerSession message from the specified reader or buffer.
+         * @function decode
+         * @memberof PenguinProbe.ServerSession
+         * @static
+         * @param {$protobuf.Reader|Uint8Array} reader Reader or buffer to decode from
+         * @param {number} [length] Message length if known beforehand
+         * @returns {PenguinProbe.ServerSession} ServerSession
+         * @throws {Error} If the payload is not a reader or valid buffer
+         * @throws {$protobuf.util.ProtocolError} If required fields are missing
+         */
+        ServerSession.decode = function decode(reader, length) {
+            if (!(reader instanceof $Reader))
+                reader = $Reader.create(reader);
+            var end = length === undefined ? reader.len : reader.pos + length, message = new $root.PenguinProbe.ServerSession();
+            while (reader.pos < end) {
+                var tag = reader.uint32();
+                switch (tag >>> 3) {
+                case 1:
+                    message.type = reader.int32();
+                    break;
+                case 2:
+                    message.resumeToken = reader.string();
+                    break;
+                case 3:
+                    message.resumed = reader.bool();
+                    break;
+                case 4:
+                    message.lastSeq = reader.uint32();
+                    break;
+                default:
+                    reader.skipType(tag & 7);
+                    break;
+                }
+            }
+            return message;
+        };
+
+        /**
+         * Decodes a ServerSession message from the specified reader or buffer, length delimited.
+         * @function decodeDelimited
+         * @memberof PenguinProbe.ServerSession
+         * @static
+         * @param {$protobuf.Reader|Uint8Array} reader Reader or buffer to decode from
+         * @returns {PenguinProbe.ServerSession} ServerSession
+         * @throws {Error} If the payload is not a reader or valid buffer
+         * @throws {$protobuf.util.ProtocolError} If required fields are missing
+         */
+        ServerSession.decodeDelimited = function decodeDelimited(reader) {
+            if (!(reader instanceof $Reader))
+                reader = new $Reader(reader);
+            return this.decode(reader, reader.uint32());
+        };
+
+        /**
+         * Verifies a ServerSession message.
+         * @function verify
+         * @memberof PenguinProbe.ServerSession
+         * @static
+         * @param {Object.<string,*>} message Plain object to verify
+         * @returns {string|null} `null` if valid, otherwise the reason why it is not
+         */
+        ServerSession.verify = function verify(message) {
+            if (typeof message !== "object" || message === null)
+                return "object expected";
+            if (message.type != null && message.hasOwnProperty("type"))
+                switch (message.type) {
+                default:
+                    return "type: enum value expected";
+                case 0:
+                case 1:
+                case 2:
+                case 3:
+                case 4:
+                case 64:
+                case 65:
+                case 66:
+                    break;
+                }
+            if (message.resumeToken != null && message.hasOwnProperty("resumeToken"))
+                if (!$util.isString(message.resumeToken))
+                    return "resumeToken: string expected";
+            if (message.resumed != null && message.hasOwnProperty("resumed"))
+                if (typeof message.resumed !== "boolean")
+                    return "resumed: boolean expected";
+            if (message.lastSeq != null && message.hasOwnProperty("lastSeq"))
+                if (!$util.isInteger(message.lastSeq))
+                    return "lastSeq: integer expected";
+            return null;
+        };
+
+        /**
+         * Creates a ServerSession message from a plain object. Also converts values to their respective internal types.
+         * @function fromObject
+         * @memberof PenguinProbe.ServerSession
+         * @static
+         * @param {Object.<string,*>} object Plain object
+         * @returns {PenguinProbe.ServerSession} ServerSession
+         */
+        ServerSession.fromObject = function fromObject(object) {
+            if (object instanceof $root.PenguinProbe.ServerSession)
+                return object;
+            var message = new $root.PenguinProbe.ServerSession();
+            switch (object.type) {
+            case "UNKNOWN":
+            case 0:
+                message.type = 0;
+                break;
+            case "NAVIGATED":
+            case 1:
+                message.type = 1;
+                break;
+            case "ENTERED_SEARCH_RESULT":
+            case 2:
+                message.type = 2;
+                break;
+            case "EXECUTED_ADVANCED_QUERY":
+            case 3:
+                message.type = 3;
+                break;
+            case "BATCH":
+            case 4:
+                message.type = 4;
+                break;
+            case "SERVER_ACK":
+            case 64:
+                message.type = 64;
+                break;
+            case "SERVER_SESSION":
+            case 65:
+                message.type = 65;
+                break;
+            case "SERVER_BROADCAST":
+            case 66:
+                message.type = 66;
+                break;
+            }
+            if (object.resumeToken != null)
+                message.resumeToken = String(object.resumeToken);
+            if (object.resumed != null)
+                message.resumed = Boolean(object.resumed);
+            if (object.lastSeq != null)
+                message.lastSeq = object.lastSeq >>> 0;
+            return message;
+        };
+
+        /**
+         * Creates a plain object from a ServerSession message. Also converts values to other types if specified.
+         * @function toObject
+         * @memberof PenguinProbe.ServerSession
+         * @static
+         * @param {PenguinProbe.ServerSession} message ServerSession
+         * @param {$protobuf.IConversionOptions} [options] Conversion options
+         * @returns {Object.<string,*>} Plain object
+         */
+        ServerSession.toObject = function toObject(message, options) {
+            if (!options)
+                options = {};
+            var object = {};
+            if (options.defaults) {
+                object.type = options.enums === String ? "UNKNOWN" : 0;
+                object.resumeToken = "";
+                object.resumed = false;
+                object.lastSeq = 0;
+            }
+            if (message.type != null && message.hasOwnProperty("type"))
+                object.type = options.enums === String ? $root.PenguinProbe.MessageType[message.type] : message.type;
+            if (message.resumeToken != null && message.hasOwnProperty("resumeToken"))
+                object.resumeToken = message.resumeToken;
+            if (message.resumed != null && message.hasOwnProperty("resumed"))
+                object.resumed = message.resumed;
+            if (message.lastSeq != null && message.hasOwnProperty("lastSeq"))
+                object.lastSeq = message.lastSeq;
+            return object;
+        };
+
+        /**
+         * Converts this ServerSession to JSON.
+         * @function toJSON
+         * @memberof PenguinProbe.ServerSession
+         * @instance
+         * @returns {Object.<string,*>} JSON object
+         */
+        ServerSession.prototype.toJSON = function toJSON() {
+            return this.constructor.toObject(this, $protobuf.util.toJSONOptions);
+        };
+
+        return ServerSession;
+    })();
+
+    PenguinProbe.ServerBroadcast = (function() {
+
+        /**
+         * Properties of a ServerBroadcast.
+         * @memberof PenguinProbe
+         * @interface IServerBroadcast
+         * @property {PenguinProbe.MessageType|null} [type] ServerBroadcast type
+         * @property {string|null} [message] ServerBroadcast message
+         */
+
+        /**
+         * Constructs a new ServerBroadcast.
+         * @memberof PenguinProbe
+         * @classdesc Represents a ServerBroadcast.
+         * @implements IServerBroadcast
+         * @constructor
+         * @param {PenguinProbe.IServerBroadcast=} [properties] Properties to set
+         */
+        function ServerBroadcast(properties) {
+            if (properties)
+                for (var keys = Object.keys(properties), i = 0; i < keys.length; ++i)
+                    if (properties[keys[i]] != null)
+                        this[keys[i]] = properties[keys[i]];
+        }
+
+        /**
+         * ServerBroadcast type.
+         * @member {PenguinProbe.MessageType} type
+         * @memberof PenguinProbe.ServerBroadcast
+         * @instance
+         */
+        ServerBroadcast.prototype.type = 0;
+
+        /**
+         * ServerBroadcast message.
+         * @member {string} message
+         * @memberof PenguinProbe.ServerBroadcast
+         * @instance
+         */
+        ServerBroadcast.prototype.message = "";
+
+        /**
+         * Creates a new ServerBroadcast instance using the specified properties.
+         * @function create
+         * @memberof PenguinProbe.ServerBroadcast
+         * @static
+         * @param {PenguinProbe.IServerBroadcast=} [properties] Properties to set
+         * @returns {PenguinProbe.ServerBroadcast} ServerBroadcast instance
+         */
+        ServerBroadcast.create = function create(properties) {
+            return new ServerBroadcast(properties);
+        };
+
+        /**
+         * Encodes the specified ServerBroadcast message. Does not implicitly {@link PenguinProbe.ServerBroadcast.verify|verify} messages.
+         * @function encode
+         * @memberof PenguinProbe.ServerBroadcast
+         * @static
+         * @param {PenguinProbe.IServerBroadcast} message ServerBroadcast message or plain object to encode
+         * @param {$protobuf.Writer} [writer] Writer to encode to
+         * @returns {$protobuf.Writer} Writer
+         */
+        ServerBroadcast.encode = function encode(message, writer) {
+            if (!writer)
+                writer = $Writer.create();
+            if (message.type != null && Object.hasOwnProperty.call(message, "type"))
+                writer.uint32(/* id 1, wireType 0 =*/8).int32(message.type);
+            if (message.message != null && Object.hasOwnProperty.call(message, "message"))
+                writer.uint32(/* id 2, wireType 2 =*/18).string(message.message);
+            return writer;
+        };
+
+        /**
+         * Encodes the specified ServerBroadcast message, length delimited. Does not implicitly {@link PenguinProbe.ServerBroadcast.verify|verify} messages.
+         * @function encodeDelimited
+         * @memberof PenguinProbe.ServerBroadcast
+         * @static
+         * @param {PenguinProbe.IServerBroadcast} message ServerBroadcast message or plain object to encode
+         * @param {$protobuf.Writer} [writer] Writer to encode to
+         * @returns {$protobuf.Writer} Writer
+         */
+        ServerBroadcast.encodeDelimited = function encodeDelimited(message, writer) {
+            return this.encode(message, writer).ldelim();
+        };
+
+        /**
+         * Decodes a ServerBroadcast message from the specified reader or buffer.
+         * @function decode
+         * @memberof PenguinProbe.ServerBroadcast
+         * @static
+         * @param {$protobuf.Reader|Uint8Array} reader Reader or buffer to decode from
+         * @param {number} [length] Message length if known beforehand
+         * @returns {PenguinProbe.ServerBroadcast} ServerBroadcast
+         * @throws {Error} If the payload is not a reader or valid buffer
+         * @throws {$protobuf.util.ProtocolError} If required fields are missing
+         */
+        ServerBroadcast.decode = function decode(reader, length) {
+            if (!(reader instanceof $Reader))
+                reader = $Reader.create(reader);
+            var end = length === undefined ? reader.len : reader.pos + length, message = new $root.PenguinProbe.ServerBroadcast();
+            while (reader.pos < end) {
+                var tag = reader.uint32();
+                switch (tag >>> 3) {
+                case 1:
+                    message.type = reader.int32();
+                    break;
+                case 2:
+                    message.message = reader.string();
+                    break;
+                default:
+                    reader.skipType(tag & 7);
+                    break;
+                }
+            }
+            return message;
+        };
+
+        /**
+         * Decodes a ServerBroadcast message from the specified reader or buffer, length delimited.
+         * @function decodeDelimited
+         * @memberof PenguinProbe.ServerBroadcast
+         * @static
+         * @param {$protobuf.Reader|Uint8Array} reader Reader or buffer to decode from
+         * @returns {PenguinProbe.ServerBroadcast} ServerBroadcast
+         * @throws {Error} If the payload is not a reader or valid buffer
+         * @throws {$protobuf.util.ProtocolError} If required fields are missing
+         */
+        ServerBroadcast.decodeDelimited = function decodeDelimited(reader) {
+            if (!(reader instanceof $Reader))
+                reader = new $Reader(reader);
+            return this.decode(reader, reader.uint32());
+        };
+
+        /**
+         * Verifies a ServerBroadcast message.
+         * @function verify
+         * @memberof PenguinProbe.ServerBroadcast
+         * @static
+         * @param {Object.<string,*>} message Plain object to verify
+         * @returns {string|null} `null` if valid, otherwise the reason why it is not
+         */
+        ServerBroadcast.verify = function verify(message) {
+            if (typeof message !== "object" || message === null)
+                return "object expected";
+            if (message.type != null && message.hasOwnProperty("type"))
+                switch (message.type) {
+                default:
+                    return "type: enum value expected";
+                case 0:
+                case 1:
+                case 2:
+                case 3:
+                case 4:
+                case 64:
+                case 65:
+                case 66:
+                    break;
+                }
+            if (message.message != null && message.hasOwnProperty("message"))
+                if (!$util.isString(message.message))
+                    return "message: string expected";
+            return null;
+        };
+
+        /**
+         * Creates a ServerBroadcast message from a plain object. Also converts values to their respective internal types.
+         * @function fromObject
+         * @memberof PenguinProbe.ServerBroadcast
+         * @static
+         * @param {Object.<string,*>} object Plain object
+         * @returns {PenguinProbe.ServerBroadcast} ServerBroadcast
+         */
+        ServerBroadcast.fromObject = function fromObject(object) {
+            if (object instanceof $root.PenguinProbe.ServerBroadcast)
+                return object;
+            var message = new $root.PenguinProbe.ServerBroadcast();
+            switch (object.type) {
+            case "UNKNOWN":
+            case 0:
+                message.type = 0;
+                break;
+            case "NAVIGATED":
+            case 1:
+                message.type = 1;
+                break;
+            case "ENTERED_SEARCH_RESULT":
+            case 2:
+                message.type = 2;
+                break;
+            case "EXECUTED_ADVANCED_QUERY":
+            case 3:
+                message.type = 3;
+                break;
+            case "BATCH":
+            case 4:
+                message.type = 4;
+                break;
+            case "SERVER_ACK":
+            case 64:
+                message.type = 64;
+                break;
+            case "SERVER_SESSION":
+            case 65:
+                message.type = 65;
+                break;
+            case "SERVER_BROADCAST":
+            case 66:
+                message.type = 66;
+                break;
+            }
+            if (object.message != null)
+                message.message = String(object.message);
+            return message;
+        };
+
+        /**
+         * Creates a plain object from a ServerBroadcast message. Also converts values to other types if specified.
+         * @function toObject
+         * @memberof PenguinProbe.ServerBroadcast
+         * @static
+         * @param {PenguinProbe.ServerBroadcast} message ServerBroadcast
+         * @param {$protobuf.IConversionOptions} [options] Conversion options
+         * @returns {Object.<string,*>} Plain object
+         */
+        ServerBroadcast.toObject = function toObject(message, options) {
+            if (!options)
+                options = {};
+            var object = {};
+            if (options.defaults) {
+                object.type = options.enums === String ? "UNKNOWN" : 0;
+                object.message = "";
+            }
+            if (message.type != null && message.hasOwnProperty("type"))
+                object.type = options.enums === String ? $root.PenguinProbe.MessageType[message.type] : message.type;
+            if (message.message != null && message.hasOwnProperty("message"))
+                object.message = message.message;
+            return object;
+        };
+
+        /**
+         * Converts this ServerBroadcast to JSON.
+         * @function toJSON
+         * @memberof PenguinProbe.ServerBroadcast
+         * @instance
+         * @returns {Object.<string,*>} JSON object
+         */
+        ServerBroadcast.prototype.toJSON = function toJSON() {
+            return this.constructor.toObject(this, $protobuf.util.toJSONOptions);
+        };
+
+        return ServerBroadcast;
+    })();
+
     return PenguinProbe;
 })();
 